@@ -0,0 +1,178 @@
+// Package abi implements the Solidity contract ABI encoding used to call contracts and decode their data
+package abi
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+type Argument struct {
+	Name    string
+	Type    Type
+	Indexed bool
+}
+
+type Method struct {
+	Name    string
+	Inputs  []Argument
+	Outputs []Argument
+}
+
+// Selector returns the 4-byte function selector for a canonical signature such as "transfer(address,uint256)".
+func Selector(signature string) []byte {
+	return Keccak256([]byte(signature))[:4]
+}
+
+// ParseMethod parses a human readable method description of the form "name(inputs)(outputs)",
+// e.g. "balanceOf(address owner)(uint256)". Argument names and the outputs list are optional.
+func ParseMethod(description string) (Method, error) {
+	description = strings.TrimSpace(description)
+	open := strings.Index(description, "(")
+	if open <= 0 {
+		return Method{}, fmt.Errorf("invalid method %q", description)
+	}
+
+	inputs, rest, err := parseArgumentList(description[open:])
+	if err != nil {
+		return Method{}, fmt.Errorf("invalid method %q: %w", description, err)
+	}
+
+	var outputs []Argument
+	if rest = strings.TrimSpace(rest); rest != "" {
+		if outputs, rest, err = parseArgumentList(rest); err != nil {
+			return Method{}, fmt.Errorf("invalid method %q: %w", description, err)
+		}
+		if strings.TrimSpace(rest) != "" {
+			return Method{}, fmt.Errorf("invalid method %q: unexpected %q", description, rest)
+		}
+	}
+
+	return Method{Name: description[:open], Inputs: inputs, Outputs: outputs}, nil
+}
+
+// MustParseMethod is like ParseMethod but panics on error. It is intended for package level method definitions.
+func MustParseMethod(description string) Method {
+	method, err := ParseMethod(description)
+	if err != nil {
+		panic(err)
+	}
+	return method
+}
+
+// parseArgumentList parses a parenthesised argument list at the start of s and returns the remainder.
+func parseArgumentList(s string) ([]Argument, string, error) {
+	depth := 0
+	for i, r := range s {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		}
+		if depth != 0 {
+			continue
+		}
+
+		parts, err := splitTopLevel(s[1:i])
+		if err != nil {
+			return nil, "", err
+		}
+		args := make([]Argument, 0, len(parts))
+		for _, part := range parts {
+			arg, err := parseArgument(part)
+			if err != nil {
+				return nil, "", err
+			}
+			args = append(args, arg)
+		}
+		return args, s[i+1:], nil
+	}
+	return nil, "", fmt.Errorf("unbalanced parentheses")
+}
+
+func parseArgument(s string) (Argument, error) {
+	// the type may itself contain spaces inside a tuple, so the name is whatever follows the last closing token
+	typ, name := s, ""
+	if idx := strings.LastIndex(s, " "); idx > strings.LastIndexAny(s, ")]") {
+		typ, name = strings.TrimSpace(s[:idx]), strings.TrimSpace(s[idx+1:])
+	}
+	indexed := false
+	if name == "indexed" {
+		name, indexed = "", true
+	} else if strings.HasSuffix(typ, " indexed") {
+		typ, indexed = strings.TrimSpace(strings.TrimSuffix(typ, " indexed")), true
+	}
+
+	t, err := ParseType(typ)
+	if err != nil {
+		return Argument{}, err
+	}
+	return Argument{Name: name, Type: t, Indexed: indexed}, nil
+}
+
+func argumentTypes(args []Argument) []Type {
+	types := make([]Type, len(args))
+	for i, arg := range args {
+		types[i] = arg.Type
+	}
+	return types
+}
+
+func signature(name string, args []Argument) string {
+	names := make([]string, len(args))
+	for i, arg := range args {
+		names[i] = arg.Type.String()
+	}
+	return name + "(" + strings.Join(names, ",") + ")"
+}
+
+// Signature returns the canonical signature, e.g. "transfer(address,uint256)".
+func (m Method) Signature() string {
+	return signature(m.Name, m.Inputs)
+}
+
+// ID returns the 4-byte selector of the method.
+func (m Method) ID() []byte {
+	return Selector(m.Signature())
+}
+
+// Pack returns the calldata for invoking the method with the given arguments.
+func (m Method) Pack(args ...interface{}) ([]byte, error) {
+	encoded, err := Encode(argumentTypes(m.Inputs), args)
+	if err != nil {
+		return nil, fmt.Errorf("packing %s: %w", m.Name, err)
+	}
+	return append(m.ID(), encoded...), nil
+}
+
+// UnpackInput decodes calldata for the method, checking that it starts with the method selector.
+func (m Method) UnpackInput(data []byte) ([]interface{}, error) {
+	if len(data) < 4 || !bytes.Equal(data[:4], m.ID()) {
+		return nil, fmt.Errorf("calldata does not match selector of %s", m.Signature())
+	}
+	return Decode(argumentTypes(m.Inputs), data[4:])
+}
+
+// DecodeInput decodes calldata for the method into its arguments keyed by name, or "argN" for unnamed ones.
+func (m Method) DecodeInput(data []byte) (map[string]interface{}, error) {
+	values, err := m.UnpackInput(data)
+	if err != nil {
+		return nil, err
+	}
+
+	args := make(map[string]interface{}, len(values))
+	for i, value := range values {
+		args[argumentName(m.Inputs[i], i)] = value
+	}
+	return args, nil
+}
+
+// Unpack decodes the return data of the method.
+func (m Method) Unpack(data []byte) ([]interface{}, error) {
+	values, err := Decode(argumentTypes(m.Outputs), data)
+	if err != nil {
+		return nil, fmt.Errorf("unpacking %s: %w", m.Name, err)
+	}
+	return values, nil
+}
@@ -0,0 +1,174 @@
+package abi
+
+import (
+	"encoding/hex"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeccak256(t *testing.T) {
+	assert.Equal(t, "c5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470", hex.EncodeToString(Keccak256(nil)))
+	assert.Equal(t, "ddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef",
+		hex.EncodeToString(Keccak256([]byte("Transfer(address,address,uint256)"))))
+
+	// input longer than a single block of the sponge
+	long := []byte(strings.Repeat("a", 200))
+	assert.Equal(t, 32, len(Keccak256(long)))
+	assert.NotEqual(t, Keccak256(long[:136]), Keccak256(long))
+}
+
+func TestSelector(t *testing.T) {
+	assert.Equal(t, "a9059cbb", hex.EncodeToString(Selector("transfer(address,uint256)")))
+	assert.Equal(t, "70a08231", hex.EncodeToString(Selector("balanceOf(address)")))
+}
+
+func TestParseType(t *testing.T) {
+	for _, s := range []string{"uint256", "int8", "address", "bool", "bytes32", "bytes", "string", "uint256[]", "address[3]", "(address,(uint256,bytes)[])[2]"} {
+		typ, err := ParseType(s)
+		assert.NoError(t, err, s)
+		assert.Equal(t, s, typ.String())
+	}
+
+	typ, err := ParseType("uint")
+	assert.NoError(t, err)
+	assert.Equal(t, "uint256", typ.String())
+
+	for _, s := range []string{"uint7", "bytes33", "foo", "(uint256", "uint256[0]"} {
+		_, err := ParseType(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestPackStatic(t *testing.T) {
+	method := MustParseMethod("baz(uint32,bool)(bool)")
+	data, err := method.Pack(69, true)
+	assert.NoError(t, err)
+	assert.Equal(t, "cdcd77c0"+
+		"0000000000000000000000000000000000000000000000000000000000000045"+
+		"0000000000000000000000000000000000000000000000000000000000000001", hex.EncodeToString(data))
+}
+
+func TestPackDynamic(t *testing.T) {
+	// example from the Solidity ABI specification
+	method := MustParseMethod("f(uint256,uint32[],bytes10,bytes)")
+	data, err := method.Pack(big.NewInt(0x123), []int{0x456, 0x789}, []byte("1234567890"), []byte("Hello, world!"))
+	assert.NoError(t, err)
+	assert.Equal(t, "8be65246"+
+		"0000000000000000000000000000000000000000000000000000000000000123"+
+		"0000000000000000000000000000000000000000000000000000000000000080"+
+		"3132333435363738393000000000000000000000000000000000000000000000"+
+		"00000000000000000000000000000000000000000000000000000000000000e0"+
+		"0000000000000000000000000000000000000000000000000000000000000002"+
+		"0000000000000000000000000000000000000000000000000000000000000456"+
+		"0000000000000000000000000000000000000000000000000000000000000789"+
+		"000000000000000000000000000000000000000000000000000000000000000d"+
+		"48656c6c6f2c20776f726c642100000000000000000000000000000000000000", hex.EncodeToString(data))
+
+	values, err := method.UnpackInput(data)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, big.NewInt(0x123).Cmp(values[0].(*big.Int)))
+	assert.Len(t, values[1], 2)
+	assert.Equal(t, []byte("1234567890"), values[2])
+	assert.Equal(t, []byte("Hello, world!"), values[3])
+}
+
+func TestDecodeInput(t *testing.T) {
+	method := MustParseMethod("transfer(address to,uint256)")
+	data, err := method.Pack("0x14574a6dff2ddf9e07828b4345d3040919af5652", big.NewInt(5))
+	assert.NoError(t, err)
+
+	args, err := method.DecodeInput(data)
+	assert.NoError(t, err)
+	assert.Equal(t, "0x14574a6dff2ddf9e07828b4345d3040919af5652", args["to"])
+	assert.Equal(t, 0, big.NewInt(5).Cmp(args["arg1"].(*big.Int)))
+
+	_, err = MustParseMethod("approve(address,uint256)").DecodeInput(data)
+	assert.Error(t, err)
+}
+
+func TestRoundTrip(t *testing.T) {
+	types := []Type{}
+	for _, s := range []string{"int256", "address", "string", "(uint8,string[])", "bytes4[2]"} {
+		typ, err := ParseType(s)
+		assert.NoError(t, err)
+		types = append(types, typ)
+	}
+
+	values := []interface{}{
+		big.NewInt(-5),
+		"0x00000000000000000000000000000000000000ff",
+		"evmos",
+		[]interface{}{7, []string{"a", "bc"}},
+		[][]byte{{1, 2, 3, 4}, {5, 6, 7, 8}},
+	}
+
+	encoded, err := Encode(types, values)
+	assert.NoError(t, err)
+
+	decoded, err := Decode(types, encoded)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, big.NewInt(-5).Cmp(decoded[0].(*big.Int)))
+	assert.Equal(t, "0x00000000000000000000000000000000000000ff", decoded[1])
+	assert.Equal(t, "evmos", decoded[2])
+	tuple := decoded[3].([]interface{})
+	assert.Equal(t, 0, big.NewInt(7).Cmp(tuple[0].(*big.Int)))
+	assert.Equal(t, []interface{}{"a", "bc"}, tuple[1])
+	assert.Equal(t, []interface{}{[]byte{1, 2, 3, 4}, []byte{5, 6, 7, 8}}, decoded[4])
+}
+
+func TestEncodeRangeChecks(t *testing.T) {
+	uint8Type, _ := ParseType("uint8")
+	int8Type, _ := ParseType("int8")
+
+	_, err := Encode([]Type{uint8Type}, []interface{}{256})
+	assert.Error(t, err)
+	_, err = Encode([]Type{uint8Type}, []interface{}{-1})
+	assert.Error(t, err)
+	_, err = Encode([]Type{int8Type}, []interface{}{-128})
+	assert.NoError(t, err)
+	_, err = Encode([]Type{int8Type}, []interface{}{128})
+	assert.Error(t, err)
+}
+
+func TestDecodeShortData(t *testing.T) {
+	stringType, _ := ParseType("string")
+	_, err := Decode([]Type{stringType}, []byte{0x01})
+	assert.Error(t, err)
+}
+
+func TestParseJSON(t *testing.T) {
+	parsed, err := ParseJSON([]byte(`{"abi":[
+		{"type":"function","name":"submit","inputs":[{"name":"order","type":"tuple[]","components":[
+			{"name":"maker","type":"address"},{"name":"amounts","type":"uint256[]"}]}],"outputs":[]},
+		{"type":"event","name":"Named","anonymous":false,"inputs":[
+			{"name":"id","type":"uint256","indexed":true},
+			{"name":"label","type":"string","indexed":true},
+			{"name":"","type":"string","indexed":false}]},
+		{"type":"constructor","inputs":[]}
+	]}`))
+	assert.NoError(t, err)
+	assert.Len(t, parsed.Methods, 1)
+	assert.Len(t, parsed.Events, 1)
+	assert.Equal(t, "submit((address,uint256[])[])", parsed.Methods[0].Signature())
+
+	method, ok := parsed.MethodByID(Selector("submit((address,uint256[])[])"))
+	assert.True(t, ok)
+	assert.Equal(t, "submit", method.Name)
+
+	event := parsed.Events[0]
+	labelHash := Keccak256([]byte("hello"))
+	data, err := Encode([]Type{{Kind: StringKind}}, []interface{}{"payload"})
+	assert.NoError(t, err)
+
+	args, err := event.DecodeLog([][]byte{event.ID(), leftPad([]byte{7}), labelHash}, data)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, big.NewInt(7).Cmp(args["id"].(*big.Int)))
+	assert.Equal(t, labelHash, args["label"])
+	assert.Equal(t, "payload", args["arg2"])
+
+	_, err = event.DecodeLog([][]byte{event.ID()}, data)
+	assert.Error(t, err)
+}
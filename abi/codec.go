@@ -0,0 +1,355 @@
+package abi
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+)
+
+const wordSize = 32
+
+var (
+	twoTo256  = new(big.Int).Lsh(big.NewInt(1), 256)
+	maxOffset = big.NewInt(1 << 32)
+)
+
+// FromHex decodes a hex string with an optional 0x prefix.
+func FromHex(s string) ([]byte, error) {
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+	if len(s)%2 == 1 {
+		s = "0" + s
+	}
+	return hex.DecodeString(s)
+}
+
+// ToHex encodes bytes as a 0x prefixed hex string.
+func ToHex(b []byte) string {
+	return "0x" + hex.EncodeToString(b)
+}
+
+// Encode ABI-encodes values as a tuple of the given types.
+//
+// Integers accept *big.Int, Go integer types and decimal or 0x-prefixed strings, addresses accept hex strings
+// or 20-byte slices, byte types accept []byte or hex strings, and arrays and tuples accept any slice.
+func Encode(types []Type, values []interface{}) ([]byte, error) {
+	if len(types) != len(values) {
+		return nil, fmt.Errorf("expected %d values, got %d", len(types), len(values))
+	}
+
+	headLen := 0
+	for _, t := range types {
+		headLen += t.headSize()
+	}
+
+	head := make([]byte, 0, headLen)
+	var tail []byte
+	for i, t := range types {
+		encoded, err := encodeValue(t, values[i])
+		if err != nil {
+			return nil, fmt.Errorf("argument %d (%s): %w", i, t, err)
+		}
+		if t.IsDynamic() {
+			head = append(head, encodeUint(big.NewInt(int64(headLen+len(tail))))...)
+			tail = append(tail, encoded...)
+		} else {
+			head = append(head, encoded...)
+		}
+	}
+
+	return append(head, tail...), nil
+}
+
+func encodeValue(t Type, value interface{}) ([]byte, error) {
+	switch t.Kind {
+	case UintKind, IntKind:
+		n, err := toBigInt(value)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkIntRange(t, n); err != nil {
+			return nil, err
+		}
+		if n.Sign() < 0 {
+			n = new(big.Int).Add(n, twoTo256)
+		}
+		return encodeUint(n), nil
+
+	case AddressKind:
+		b, err := toBytes(value)
+		if err != nil {
+			return nil, err
+		}
+		if len(b) != 20 {
+			return nil, fmt.Errorf("address must be 20 bytes, got %d", len(b))
+		}
+		return leftPad(b), nil
+
+	case BoolKind:
+		b, ok := value.(bool)
+		if !ok {
+			return nil, fmt.Errorf("expected bool, got %T", value)
+		}
+		word := make([]byte, wordSize)
+		if b {
+			word[wordSize-1] = 1
+		}
+		return word, nil
+
+	case FixedBytesKind:
+		b, err := toBytes(value)
+		if err != nil {
+			return nil, err
+		}
+		if len(b) > t.Size {
+			return nil, fmt.Errorf("value has %d bytes, exceeds bytes%d", len(b), t.Size)
+		}
+		return rightPad(b), nil
+
+	case BytesKind, StringKind:
+		var b []byte
+		if s, ok := value.(string); ok && t.Kind == StringKind {
+			b = []byte(s)
+		} else {
+			var err error
+			if b, err = toBytes(value); err != nil {
+				return nil, err
+			}
+		}
+		encoded := encodeUint(big.NewInt(int64(len(b))))
+		if len(b) > 0 {
+			encoded = append(encoded, rightPad(b)...)
+		}
+		return encoded, nil
+
+	case SliceKind, ArrayKind:
+		items, err := toSlice(value)
+		if err != nil {
+			return nil, err
+		}
+		if t.Kind == ArrayKind && len(items) != t.Size {
+			return nil, fmt.Errorf("expected %d elements, got %d", t.Size, len(items))
+		}
+		types := make([]Type, len(items))
+		for i := range types {
+			types[i] = *t.Elem
+		}
+		encoded, err := Encode(types, items)
+		if err != nil {
+			return nil, err
+		}
+		if t.Kind == SliceKind {
+			return append(encodeUint(big.NewInt(int64(len(items)))), encoded...), nil
+		}
+		return encoded, nil
+
+	case TupleKind:
+		items, err := toSlice(value)
+		if err != nil {
+			return nil, err
+		}
+		return Encode(t.Components, items)
+	}
+
+	return nil, fmt.Errorf("unsupported type %s", t)
+}
+
+func checkIntRange(t Type, n *big.Int) error {
+	if t.Kind == UintKind {
+		if n.Sign() < 0 || n.BitLen() > t.Size {
+			return fmt.Errorf("value %s out of range for %s", n, t)
+		}
+		return nil
+	}
+
+	limit := new(big.Int).Lsh(big.NewInt(1), uint(t.Size-1))
+	if n.Cmp(limit) >= 0 || n.Cmp(new(big.Int).Neg(limit)) < 0 {
+		return fmt.Errorf("value %s out of range for %s", n, t)
+	}
+	return nil
+}
+
+func encodeUint(n *big.Int) []byte {
+	return leftPad(n.Bytes())
+}
+
+func leftPad(b []byte) []byte {
+	word := make([]byte, wordSize)
+	copy(word[wordSize-len(b):], b)
+	return word
+}
+
+func rightPad(b []byte) []byte {
+	padded := make([]byte, (len(b)+wordSize-1)/wordSize*wordSize)
+	copy(padded, b)
+	return padded
+}
+
+func toBigInt(value interface{}) (*big.Int, error) {
+	switch v := value.(type) {
+	case *big.Int:
+		return v, nil
+	case big.Int:
+		return &v, nil
+	case string:
+		n, ok := new(big.Int).SetString(v, 0)
+		if !ok {
+			return nil, fmt.Errorf("invalid integer %q", v)
+		}
+		return n, nil
+	}
+
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return big.NewInt(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return new(big.Int).SetUint64(rv.Uint()), nil
+	}
+	return nil, fmt.Errorf("expected integer, got %T", value)
+}
+
+func toBytes(value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		return FromHex(v)
+	}
+
+	rv := reflect.ValueOf(value)
+	if rv.Kind() == reflect.Array && rv.Type().Elem().Kind() == reflect.Uint8 {
+		b := make([]byte, rv.Len())
+		reflect.Copy(reflect.ValueOf(b), rv)
+		return b, nil
+	}
+	return nil, fmt.Errorf("expected bytes, got %T", value)
+}
+
+func toSlice(value interface{}) ([]interface{}, error) {
+	if items, ok := value.([]interface{}); ok {
+		return items, nil
+	}
+
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, fmt.Errorf("expected slice, got %T", value)
+	}
+	items := make([]interface{}, rv.Len())
+	for i := range items {
+		items[i] = rv.Index(i).Interface()
+	}
+	return items, nil
+}
+
+// Decode decodes ABI-encoded data as a tuple of the given types.
+//
+// Integers decode to *big.Int, addresses to lowercase 0x-prefixed strings, bool to bool, bytes types to []byte,
+// string to string, and arrays and tuples to []interface{}.
+func Decode(types []Type, data []byte) ([]interface{}, error) {
+	values := make([]interface{}, len(types))
+	pos := 0
+	for i, t := range types {
+		start, size := pos, t.headSize()
+		if t.IsDynamic() {
+			offset, err := readOffset(data, pos)
+			if err != nil {
+				return nil, err
+			}
+			start = offset
+		} else if pos > len(data) {
+			return nil, fmt.Errorf("data too short for %s", t)
+		}
+
+		value, err := decodeValue(t, data[start:])
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+		pos += size
+	}
+	return values, nil
+}
+
+func decodeValue(t Type, data []byte) (interface{}, error) {
+	switch t.Kind {
+	case UintKind, IntKind, AddressKind, BoolKind, FixedBytesKind:
+		if len(data) < wordSize {
+			return nil, fmt.Errorf("data too short for %s", t)
+		}
+	}
+
+	switch t.Kind {
+	case UintKind:
+		return new(big.Int).SetBytes(data[:wordSize]), nil
+
+	case IntKind:
+		n := new(big.Int).SetBytes(data[:wordSize])
+		if data[0]&0x80 != 0 {
+			n.Sub(n, twoTo256)
+		}
+		return n, nil
+
+	case AddressKind:
+		return ToHex(data[12:wordSize]), nil
+
+	case BoolKind:
+		return data[wordSize-1] != 0, nil
+
+	case FixedBytesKind:
+		b := make([]byte, t.Size)
+		copy(b, data[:t.Size])
+		return b, nil
+
+	case BytesKind, StringKind:
+		length, err := readOffset(data, 0)
+		if err != nil {
+			return nil, err
+		}
+		if wordSize+length > len(data) {
+			return nil, fmt.Errorf("data too short for %s of length %d", t, length)
+		}
+		b := make([]byte, length)
+		copy(b, data[wordSize:wordSize+length])
+		if t.Kind == StringKind {
+			return string(b), nil
+		}
+		return b, nil
+
+	case SliceKind, ArrayKind:
+		length := t.Size
+		if t.Kind == SliceKind {
+			var err error
+			if length, err = readOffset(data, 0); err != nil {
+				return nil, err
+			}
+			data = data[wordSize:]
+		}
+		if length*wordSize > len(data) {
+			return nil, fmt.Errorf("data too short for %d elements of %s", length, t.Elem)
+		}
+		types := make([]Type, length)
+		for i := range types {
+			types[i] = *t.Elem
+		}
+		return Decode(types, data)
+
+	case TupleKind:
+		return Decode(t.Components, data)
+	}
+
+	return nil, fmt.Errorf("unsupported type %s", t)
+}
+
+// readOffset reads the word at pos as an offset or length and checks that it is within data.
+func readOffset(data []byte, pos int) (int, error) {
+	if pos+wordSize > len(data) {
+		return 0, fmt.Errorf("data too short to read offset at %d", pos)
+	}
+	n := new(big.Int).SetBytes(data[pos : pos+wordSize])
+	if n.Cmp(maxOffset) >= 0 || int(n.Int64()) > len(data) {
+		return 0, fmt.Errorf("offset %s out of bounds", n)
+	}
+	return int(n.Int64()), nil
+}
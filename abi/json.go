@@ -0,0 +1,191 @@
+package abi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+type Event struct {
+	Name      string
+	Inputs    []Argument
+	Anonymous bool
+}
+
+// ABI is a parsed contract ABI. Overloaded functions and events are kept as separate entries.
+type ABI struct {
+	Methods []Method
+	Events  []Event
+}
+
+type jsonArgument struct {
+	Name       string         `json:"name"`
+	Type       string         `json:"type"`
+	Indexed    bool           `json:"indexed"`
+	Components []jsonArgument `json:"components"`
+}
+
+type jsonEntry struct {
+	Type      string         `json:"type"`
+	Name      string         `json:"name"`
+	Inputs    []jsonArgument `json:"inputs"`
+	Outputs   []jsonArgument `json:"outputs"`
+	Anonymous bool           `json:"anonymous"`
+}
+
+// ParseJSON parses a contract ABI in the JSON format emitted by the Solidity compiler.
+// Both a bare array of entries and an artifact object with an "abi" field are accepted.
+func ParseJSON(data []byte) (*ABI, error) {
+	var entries []jsonEntry
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		var artifact struct {
+			ABI []jsonEntry `json:"abi"`
+		}
+		if err := json.Unmarshal(trimmed, &artifact); err != nil {
+			return nil, err
+		}
+		entries = artifact.ABI
+	} else if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+
+	parsed := &ABI{}
+	for _, entry := range entries {
+		inputs, err := argumentsFromJSON(entry.Inputs)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s: %w", entry.Type, entry.Name, err)
+		}
+
+		switch entry.Type {
+		case "function", "":
+			outputs, err := argumentsFromJSON(entry.Outputs)
+			if err != nil {
+				return nil, fmt.Errorf("function %s: %w", entry.Name, err)
+			}
+			parsed.Methods = append(parsed.Methods, Method{Name: entry.Name, Inputs: inputs, Outputs: outputs})
+		case "event":
+			parsed.Events = append(parsed.Events, Event{Name: entry.Name, Inputs: inputs, Anonymous: entry.Anonymous})
+		}
+	}
+
+	return parsed, nil
+}
+
+func argumentsFromJSON(args []jsonArgument) ([]Argument, error) {
+	parsed := make([]Argument, 0, len(args))
+	for _, arg := range args {
+		typ, err := typeFromJSON(arg)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, Argument{Name: arg.Name, Type: typ, Indexed: arg.Indexed})
+	}
+	return parsed, nil
+}
+
+// typeFromJSON resolves "tuple" types, including arrays of tuples, from their components.
+func typeFromJSON(arg jsonArgument) (Type, error) {
+	if !strings.HasPrefix(arg.Type, "tuple") {
+		return ParseType(arg.Type)
+	}
+
+	components := make([]string, 0, len(arg.Components))
+	for _, component := range arg.Components {
+		typ, err := typeFromJSON(component)
+		if err != nil {
+			return Type{}, err
+		}
+		components = append(components, typ.String())
+	}
+	return ParseType("(" + strings.Join(components, ",") + ")" + strings.TrimPrefix(arg.Type, "tuple"))
+}
+
+// MethodByID returns the method matching a 4-byte selector.
+func (a *ABI) MethodByID(selector []byte) (Method, bool) {
+	for _, method := range a.Methods {
+		if len(selector) >= 4 && bytes.Equal(method.ID(), selector[:4]) {
+			return method, true
+		}
+	}
+	return Method{}, false
+}
+
+// EventByID returns the event whose signature hash matches topic.
+func (a *ABI) EventByID(topic []byte) (Event, bool) {
+	for _, event := range a.Events {
+		if !event.Anonymous && bytes.Equal(event.ID(), topic) {
+			return event, true
+		}
+	}
+	return Event{}, false
+}
+
+// Signature returns the canonical event signature, e.g. "Transfer(address,address,uint256)".
+func (e Event) Signature() string {
+	return signature(e.Name, e.Inputs)
+}
+
+// ID returns the topic hash identifying the event.
+func (e Event) ID() []byte {
+	return Keccak256([]byte(e.Signature()))
+}
+
+// DecodeLog decodes the topics and data of a log emitted by the event into its named arguments.
+// Unnamed arguments are keyed by position. Indexed arguments of dynamic types are only stored as their
+// hash, so they decode to the raw topic.
+func (e Event) DecodeLog(topics [][]byte, data []byte) (map[string]interface{}, error) {
+	if !e.Anonymous {
+		if len(topics) == 0 || !bytes.Equal(topics[0], e.ID()) {
+			return nil, fmt.Errorf("log does not match event %s", e.Signature())
+		}
+		topics = topics[1:]
+	}
+
+	var indexed, nonIndexed []int
+	for i, arg := range e.Inputs {
+		if arg.Indexed {
+			indexed = append(indexed, i)
+		} else {
+			nonIndexed = append(nonIndexed, i)
+		}
+	}
+	if len(topics) != len(indexed) {
+		return nil, fmt.Errorf("event %s expects %d indexed topics, got %d", e.Signature(), len(indexed), len(topics))
+	}
+
+	types := make([]Type, len(nonIndexed))
+	for i, pos := range nonIndexed {
+		types[i] = e.Inputs[pos].Type
+	}
+	values, err := Decode(types, data)
+	if err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", e.Signature(), err)
+	}
+
+	args := make(map[string]interface{}, len(e.Inputs))
+	for i, pos := range indexed {
+		arg := e.Inputs[pos]
+		if arg.Type.IsDynamic() || arg.Type.Kind == ArrayKind || arg.Type.Kind == TupleKind {
+			args[argumentName(arg, pos)] = topics[i]
+			continue
+		}
+		value, err := decodeValue(arg.Type, topics[i])
+		if err != nil {
+			return nil, fmt.Errorf("decoding %s: %w", e.Signature(), err)
+		}
+		args[argumentName(arg, pos)] = value
+	}
+	for i, pos := range nonIndexed {
+		args[argumentName(e.Inputs[pos], pos)] = values[i]
+	}
+
+	return args, nil
+}
+
+func argumentName(arg Argument, pos int) string {
+	if arg.Name != "" {
+		return arg.Name
+	}
+	return fmt.Sprintf("arg%d", pos)
+}
@@ -0,0 +1,216 @@
+package abi
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type Kind int
+
+const (
+	UintKind Kind = iota
+	IntKind
+	AddressKind
+	BoolKind
+	FixedBytesKind
+	BytesKind
+	StringKind
+	SliceKind
+	ArrayKind
+	TupleKind
+)
+
+// Type describes a single Solidity ABI type.
+// Size holds the bit width for integers, the byte length for fixed bytes and the element count for fixed arrays.
+type Type struct {
+	Kind       Kind
+	Size       int
+	Elem       *Type
+	Components []Type
+}
+
+// ParseType parses a canonical type string such as "uint256", "bytes32[]" or "(address,uint256)[2]".
+func ParseType(s string) (Type, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Type{}, fmt.Errorf("empty type")
+	}
+
+	if strings.HasSuffix(s, "]") {
+		open := strings.LastIndex(s, "[")
+		if open < 0 {
+			return Type{}, fmt.Errorf("invalid array type %q", s)
+		}
+		elem, err := ParseType(s[:open])
+		if err != nil {
+			return Type{}, err
+		}
+		length := s[open+1 : len(s)-1]
+		if length == "" {
+			return Type{Kind: SliceKind, Elem: &elem}, nil
+		}
+		n, err := strconv.Atoi(length)
+		if err != nil || n <= 0 {
+			return Type{}, fmt.Errorf("invalid array length in %q", s)
+		}
+		return Type{Kind: ArrayKind, Size: n, Elem: &elem}, nil
+	}
+
+	if strings.HasPrefix(s, "(") {
+		if !strings.HasSuffix(s, ")") {
+			return Type{}, fmt.Errorf("invalid tuple type %q", s)
+		}
+		parts, err := splitTopLevel(s[1 : len(s)-1])
+		if err != nil {
+			return Type{}, err
+		}
+		components := make([]Type, 0, len(parts))
+		for _, part := range parts {
+			component, err := ParseType(part)
+			if err != nil {
+				return Type{}, err
+			}
+			components = append(components, component)
+		}
+		return Type{Kind: TupleKind, Components: components}, nil
+	}
+
+	switch {
+	case s == "address":
+		return Type{Kind: AddressKind, Size: 160}, nil
+	case s == "bool":
+		return Type{Kind: BoolKind}, nil
+	case s == "string":
+		return Type{Kind: StringKind}, nil
+	case s == "bytes":
+		return Type{Kind: BytesKind}, nil
+	case strings.HasPrefix(s, "bytes"):
+		n, err := strconv.Atoi(s[len("bytes"):])
+		if err != nil || n < 1 || n > 32 {
+			return Type{}, fmt.Errorf("invalid fixed bytes type %q", s)
+		}
+		return Type{Kind: FixedBytesKind, Size: n}, nil
+	case strings.HasPrefix(s, "uint"):
+		n, err := parseIntSize(s[len("uint"):])
+		if err != nil {
+			return Type{}, fmt.Errorf("invalid type %q: %w", s, err)
+		}
+		return Type{Kind: UintKind, Size: n}, nil
+	case strings.HasPrefix(s, "int"):
+		n, err := parseIntSize(s[len("int"):])
+		if err != nil {
+			return Type{}, fmt.Errorf("invalid type %q: %w", s, err)
+		}
+		return Type{Kind: IntKind, Size: n}, nil
+	}
+
+	return Type{}, fmt.Errorf("unsupported type %q", s)
+}
+
+func parseIntSize(s string) (int, error) {
+	if s == "" {
+		return 256, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 8 || n > 256 || n%8 != 0 {
+		return 0, fmt.Errorf("invalid integer size %q", s)
+	}
+	return n, nil
+}
+
+// splitTopLevel splits a comma separated list, ignoring commas nested inside parentheses.
+func splitTopLevel(s string) ([]string, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	var parts []string
+	depth, start := 0, 0
+	for i, r := range s {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth < 0 {
+				return nil, fmt.Errorf("unbalanced parentheses in %q", s)
+			}
+		case ',':
+			if depth == 0 {
+				parts = append(parts, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("unbalanced parentheses in %q", s)
+	}
+	return append(parts, strings.TrimSpace(s[start:])), nil
+}
+
+// String returns the canonical representation used when computing selectors.
+func (t Type) String() string {
+	switch t.Kind {
+	case UintKind:
+		return fmt.Sprintf("uint%d", t.Size)
+	case IntKind:
+		return fmt.Sprintf("int%d", t.Size)
+	case AddressKind:
+		return "address"
+	case BoolKind:
+		return "bool"
+	case FixedBytesKind:
+		return fmt.Sprintf("bytes%d", t.Size)
+	case BytesKind:
+		return "bytes"
+	case StringKind:
+		return "string"
+	case SliceKind:
+		return t.Elem.String() + "[]"
+	case ArrayKind:
+		return fmt.Sprintf("%s[%d]", t.Elem.String(), t.Size)
+	case TupleKind:
+		names := make([]string, len(t.Components))
+		for i, component := range t.Components {
+			names[i] = component.String()
+		}
+		return "(" + strings.Join(names, ",") + ")"
+	}
+	return "unknown"
+}
+
+// IsDynamic reports whether values of the type are encoded out of place in the tail section.
+func (t Type) IsDynamic() bool {
+	switch t.Kind {
+	case BytesKind, StringKind, SliceKind:
+		return true
+	case ArrayKind:
+		return t.Elem.IsDynamic()
+	case TupleKind:
+		for _, component := range t.Components {
+			if component.IsDynamic() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// headSize is the number of bytes the type occupies in the head section of an enclosing tuple.
+func (t Type) headSize() int {
+	if t.IsDynamic() {
+		return 32
+	}
+	switch t.Kind {
+	case ArrayKind:
+		return t.Size * t.Elem.headSize()
+	case TupleKind:
+		size := 0
+		for _, component := range t.Components {
+			size += component.headSize()
+		}
+		return size
+	}
+	return 32
+}
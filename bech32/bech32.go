@@ -0,0 +1,177 @@
+// Package bech32 converts between hex and bech32 (evmos1...) account addresses
+package bech32
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// AccountPrefix is the human readable part of Evmos account addresses.
+const AccountPrefix = "evmos"
+
+const charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+var generator = [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+
+func polymod(values []byte) uint32 {
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>uint(i))&1 == 1 {
+				chk ^= generator[i]
+			}
+		}
+	}
+	return chk
+}
+
+func hrpExpand(hrp string) []byte {
+	expanded := make([]byte, 0, len(hrp)*2+1)
+	for _, c := range hrp {
+		expanded = append(expanded, byte(c>>5))
+	}
+	expanded = append(expanded, 0)
+	for _, c := range hrp {
+		expanded = append(expanded, byte(c&31))
+	}
+	return expanded
+}
+
+func checksum(hrp string, data []byte) []byte {
+	values := append(hrpExpand(hrp), data...)
+	values = append(values, 0, 0, 0, 0, 0, 0)
+	mod := polymod(values) ^ 1
+	sum := make([]byte, 6)
+	for i := range sum {
+		sum[i] = byte((mod >> uint(5*(5-i))) & 31)
+	}
+	return sum
+}
+
+// convertBits regroups a byte slice from fromBits to toBits bits per element.
+func convertBits(data []byte, fromBits, toBits uint, pad bool) ([]byte, error) {
+	var (
+		acc    uint32
+		bits   uint
+		result []byte
+	)
+	maxValue := uint32(1)<<toBits - 1
+	for _, value := range data {
+		if uint32(value)>>fromBits != 0 {
+			return nil, fmt.Errorf("invalid data value %d", value)
+		}
+		acc = acc<<fromBits | uint32(value)
+		bits += fromBits
+		for bits >= toBits {
+			bits -= toBits
+			result = append(result, byte(acc>>bits&maxValue))
+		}
+	}
+	if pad {
+		if bits > 0 {
+			result = append(result, byte(acc<<(toBits-bits)&maxValue))
+		}
+	} else if bits >= fromBits || acc<<(toBits-bits)&maxValue != 0 {
+		return nil, fmt.Errorf("invalid padding")
+	}
+	return result, nil
+}
+
+// Encode encodes data as a bech32 string with the given human readable part.
+func Encode(hrp string, data []byte) (string, error) {
+	converted, err := convertBits(data, 8, 5, true)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	sb.WriteString(hrp)
+	sb.WriteByte('1')
+	for _, value := range append(converted, checksum(hrp, converted)...) {
+		sb.WriteByte(charset[value])
+	}
+	return sb.String(), nil
+}
+
+// Decode decodes a bech32 string into its human readable part and data, verifying the checksum.
+func Decode(s string) (string, []byte, error) {
+	if len(s) > 90 {
+		return "", nil, fmt.Errorf("bech32 string too long")
+	}
+	if strings.ToLower(s) != s && strings.ToUpper(s) != s {
+		return "", nil, fmt.Errorf("bech32 string has mixed case")
+	}
+	s = strings.ToLower(s)
+
+	separator := strings.LastIndex(s, "1")
+	if separator < 1 || separator+7 > len(s) {
+		return "", nil, fmt.Errorf("invalid bech32 separator position")
+	}
+
+	hrp := s[:separator]
+	for _, c := range hrp {
+		if c < 33 || c > 126 {
+			return "", nil, fmt.Errorf("invalid character in human readable part")
+		}
+	}
+
+	values := make([]byte, 0, len(s)-separator-1)
+	for _, c := range s[separator+1:] {
+		idx := strings.IndexRune(charset, c)
+		if idx < 0 {
+			return "", nil, fmt.Errorf("invalid bech32 character %q", c)
+		}
+		values = append(values, byte(idx))
+	}
+
+	if polymod(append(hrpExpand(hrp), values...)) != 1 {
+		return "", nil, fmt.Errorf("invalid bech32 checksum")
+	}
+
+	data, err := convertBits(values[:len(values)-6], 5, 8, false)
+	if err != nil {
+		return "", nil, err
+	}
+	return hrp, data, nil
+}
+
+// FromHex converts a 0x-prefixed hex address into its evmos1 bech32 form.
+func FromHex(address string) (string, error) {
+	raw, err := hex.DecodeString(strings.TrimPrefix(strings.TrimPrefix(address, "0x"), "0X"))
+	if err != nil || len(raw) != 20 {
+		return "", fmt.Errorf("invalid hex address %q", address)
+	}
+	return Encode(AccountPrefix, raw)
+}
+
+// ToHex converts an evmos1 bech32 address into its lowercase 0x-prefixed hex form.
+func ToHex(address string) (string, error) {
+	hrp, raw, err := Decode(address)
+	if err != nil {
+		return "", fmt.Errorf("invalid bech32 address %q: %w", address, err)
+	}
+	if hrp != AccountPrefix {
+		return "", fmt.Errorf("invalid bech32 address %q: expected prefix %s, got %s", address, AccountPrefix, hrp)
+	}
+	if len(raw) != 20 {
+		return "", fmt.Errorf("invalid bech32 address %q: expected 20 bytes, got %d", address, len(raw))
+	}
+	return "0x" + hex.EncodeToString(raw), nil
+}
+
+// NormalizeAddress accepts an address in either hex or evmos1 bech32 form and returns its lowercase hex form.
+func NormalizeAddress(address string) (string, error) {
+	address = strings.TrimSpace(address)
+	if strings.HasPrefix(strings.ToLower(address), AccountPrefix+"1") {
+		return ToHex(address)
+	}
+
+	raw, err := hex.DecodeString(strings.TrimPrefix(strings.TrimPrefix(address, "0x"), "0X"))
+	if err != nil || len(raw) != 20 || !strings.HasPrefix(strings.ToLower(address), "0x") {
+		return "", fmt.Errorf("invalid address %q", address)
+	}
+	return "0x" + hex.EncodeToString(raw), nil
+}
@@ -0,0 +1,63 @@
+package bech32
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeValidVectors(t *testing.T) {
+	// valid test vectors from BIP-173
+	for _, s := range []string{
+		"A12UEL5L",
+		"a12uel5l",
+		"abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxw",
+		"split1checkupstagehandshakeupstreamerranterredcaperred2y9e3w",
+	} {
+		_, _, err := Decode(s)
+		assert.NoError(t, err, s)
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	for _, s := range []string{
+		"a12UEL5L",      // mixed case
+		"pzry9x0s0muk",  // no separator
+		"1pzry9x0s0muk", // empty hrp
+		"abcdef1qpzry9x8gf2tvdw0s3jn54khce6mua7lmqqqxx", // bad checksum
+		"a1b2c3", // too short checksum
+	} {
+		_, _, err := Decode(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestAddressConversion(t *testing.T) {
+	bech, err := FromHex("0x14574a6DFF2Ddf9e07828b4345d3040919AF5652")
+	assert.NoError(t, err)
+	assert.Equal(t, "evmos1z3t55m0l9h0eupuz3dp5t5cypyv674jj7mz2jw", bech)
+
+	hexAddress, err := ToHex(bech)
+	assert.NoError(t, err)
+	assert.Equal(t, "0x14574a6dff2ddf9e07828b4345d3040919af5652", hexAddress)
+
+	_, err = ToHex("cosmos1z3t55m0l9h0eupuz3dp5t5cypyv674jjn4d6nn")
+	assert.Error(t, err)
+}
+
+func TestNormalizeAddress(t *testing.T) {
+	for _, input := range []string{
+		"0x14574a6DFF2Ddf9e07828b4345d3040919AF5652",
+		"evmos1z3t55m0l9h0eupuz3dp5t5cypyv674jj7mz2jw",
+		"EVMOS1Z3T55M0L9H0EUPUZ3DP5T5CYPYV674JJ7MZ2JW",
+	} {
+		address, err := NormalizeAddress(input)
+		assert.NoError(t, err, input)
+		assert.Equal(t, "0x14574a6dff2ddf9e07828b4345d3040919af5652", address)
+	}
+
+	for _, input := range []string{"", "0x1234", "14574a6DFF2Ddf9e07828b4345d3040919AF5652", "evmos1invalid"} {
+		_, err := NormalizeAddress(input)
+		assert.Error(t, err, input)
+	}
+}
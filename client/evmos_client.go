@@ -3,162 +3,241 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
+	"onchain-stats/logging"
+	"onchain-stats/metrics"
+	"time"
 )
 
 type EvmosClient struct {
 	BaseURL string
 }
 
-func closeBody(body io.Closer) {
-	if err := body.Close(); err != nil {
-		fmt.Printf("Error closing response body: %v\n", err)
-	}
+// RPCError is the error object returned by the node for a failed JSON-RPC request.
+// For reverted calls Data usually holds the hex encoded revert payload.
+type RPCError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
 }
 
-func (c *EvmosClient) GetAccounts() ([]string, error) {
-	requestBody, err := json.Marshal(map[string]interface{}{
-		"method":  "eth_accounts",
-		"params":  []interface{}{},
-		"id":      1,
-		"jsonrpc": "2.0",
-	})
-	if err != nil {
-		return nil, err
-	}
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
+
+var (
+	nodeRequests = metrics.NewCounter("evmos_node_requests_total",
+		"HTTP requests sent to the node, by JSON-RPC method. A batch counts once, as \"batch\" when it mixes methods.", "method")
+	nodeErrors = metrics.NewCounter("evmos_node_request_errors_total",
+		"Requests to the node that failed in transport or returned an error object, by JSON-RPC method.", "method")
+	nodeDuration = metrics.NewHistogram("evmos_node_request_duration_seconds",
+		"Round trip time of HTTP requests to the node, by JSON-RPC method.", metrics.DefaultBuckets, "method")
+)
 
-	resp, err := http.Post(c.BaseURL, "application/json", bytes.NewBuffer(requestBody))
+// post sends a JSON-RPC request body to the node, recording its latency and transport or HTTP errors under
+// method. Batches mixing methods are recorded as "batch". The request ID carried by ctx is forwarded to the
+// node in the X-Request-ID header and logged with the call, so node calls can be traced back to the API
+// request that made them.
+func (c *EvmosClient) post(ctx context.Context, method string, requestBody []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL, bytes.NewReader(requestBody))
 	if err != nil {
 		return nil, err
 	}
-	defer closeBody(resp.Body)
-
-	var result struct {
-		Result []string `json:"result"`
+	req.Header.Set("Content-Type", "application/json")
+	if id := logging.RequestID(ctx); id != "" {
+		req.Header.Set("X-Request-ID", id)
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, err
+
+	nodeRequests.Inc(method)
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	elapsed := time.Since(start)
+	nodeDuration.Observe(elapsed.Seconds(), method)
+	switch {
+	case err != nil:
+		nodeErrors.Inc(method)
+		slog.WarnContext(ctx, "node call failed", "method", method, "duration", elapsed, "error", err)
+	case resp.StatusCode >= http.StatusBadRequest:
+		nodeErrors.Inc(method)
+		slog.WarnContext(ctx, "node call failed", "method", method, "duration", elapsed, "status", resp.StatusCode)
+	default:
+		slog.DebugContext(ctx, "node call", "method", method, "duration", elapsed, "bytes", len(requestBody))
 	}
+	return resp, err
+}
 
-	return result.Result, nil
+func closeBody(body io.Closer) {
+	if err := body.Close(); err != nil {
+		slog.Warn("closing response body", "error", err)
+	}
 }
 
-func (c *EvmosClient) GetBalance(address string, blockNumber string) (string, error) {
+// call sends a JSON-RPC request to the node and decodes its result into out.
+// Unlike a missing result, an error object in the response is returned as *RPCError.
+func (c *EvmosClient) call(ctx context.Context, method string, params []interface{}, out interface{}) error {
 	requestBody, err := json.Marshal(map[string]interface{}{
-		"method":  "eth_getBalance",
-		"params":  []interface{}{address, blockNumber},
+		"method":  method,
+		"params":  params,
 		"id":      1,
 		"jsonrpc": "2.0",
 	})
 	if err != nil {
-		return "", err
+		return err
 	}
 
-	resp, err := http.Post(c.BaseURL, "application/json", bytes.NewBuffer(requestBody))
+	resp, err := c.post(ctx, method, requestBody)
 	if err != nil {
-		return "", err
+		return err
 	}
 	defer closeBody(resp.Body)
 
 	var result struct {
-		Result string `json:"result"`
+		Result json.RawMessage `json:"result"`
+		Error  *RPCError       `json:"error"`
 	}
 	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", err
+		return err
+	}
+	if result.Error != nil {
+		nodeErrors.Inc(method)
+		return result.Error
+	}
+	if out == nil || len(result.Result) == 0 {
+		return nil
 	}
 
-	return result.Result, nil
+	return json.Unmarshal(result.Result, out)
 }
 
-func (c *EvmosClient) GetBlockNumber() (string, error) {
-	requestBody, err := json.Marshal(map[string]interface{}{
-		"method":  "eth_blockNumber",
-		"params":  []interface{}{},
-		"id":      1,
-		"jsonrpc": "2.0",
-	})
-	if err != nil {
-		return "", err
-	}
+// maxBatchSize bounds the number of requests sent in a single JSON-RPC batch.
+const maxBatchSize = 100
 
-	resp, err := http.Post(c.BaseURL, "application/json", bytes.NewBuffer(requestBody))
-	if err != nil {
-		return "", err
-	}
-	defer closeBody(resp.Body)
+type batchRequest struct {
+	method string
+	params []interface{}
+}
 
-	var result struct {
-		Result string `json:"result"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return "", err
+// batchCall sends the requests as JSON-RPC batches of at most maxBatchSize and decodes each result into
+// the entry of out at the same position. The first error object returned by the node is returned as *RPCError.
+func (c *EvmosClient) batchCall(ctx context.Context, requests []batchRequest, out []interface{}) error {
+	for start := 0; start < len(requests); start += maxBatchSize {
+		end := start + maxBatchSize
+		if end > len(requests) {
+			end = len(requests)
+		}
+
+		batch := make([]map[string]interface{}, 0, end-start)
+		method := requests[start].method
+		for id := start; id < end; id++ {
+			if requests[id].method != method {
+				method = "batch"
+			}
+			batch = append(batch, map[string]interface{}{
+				"method":  requests[id].method,
+				"params":  requests[id].params,
+				"id":      id,
+				"jsonrpc": "2.0",
+			})
+		}
+		requestBody, err := json.Marshal(batch)
+		if err != nil {
+			return err
+		}
+
+		resp, err := c.post(ctx, method, requestBody)
+		if err != nil {
+			return err
+		}
+
+		var results []struct {
+			ID     int             `json:"id"`
+			Result json.RawMessage `json:"result"`
+			Error  *RPCError       `json:"error"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&results)
+		closeBody(resp.Body)
+		if err != nil {
+			return err
+		}
+		if len(results) != end-start {
+			return fmt.Errorf("batch returned %d results for %d requests", len(results), end-start)
+		}
+
+		// responses may arrive in any order, so they are matched to requests by id
+		for _, result := range results {
+			if result.ID < start || result.ID >= end {
+				return fmt.Errorf("batch returned unexpected id %d", result.ID)
+			}
+			if result.Error != nil {
+				nodeErrors.Inc(method)
+				return result.Error
+			}
+			if err := json.Unmarshal(result.Result, out[result.ID]); err != nil {
+				return err
+			}
+		}
 	}
 
-	return result.Result, nil
+	return nil
 }
 
-func (c *EvmosClient) GetBlock(blockNumber string) (map[string]interface{}, error) {
-	requestBody, err := json.Marshal(map[string]interface{}{
-		"method":  "eth_getBlockByNumber",
-		"params":  []interface{}{blockNumber, true},
-		"id":      1,
-		"jsonrpc": "2.0",
-	})
-	if err != nil {
+func (c *EvmosClient) GetAccounts(ctx context.Context) ([]string, error) {
+	var result []string
+	if err := c.call(ctx, "eth_accounts", []interface{}{}, &result); err != nil {
 		return nil, err
 	}
 
-	resp, err := http.Post(c.BaseURL, "application/json", bytes.NewBuffer(requestBody))
-	if err != nil {
-		return nil, err
-	}
-	defer closeBody(resp.Body)
+	return result, nil
+}
 
-	var result struct {
-		Result map[string]interface{} `json:"result"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, err
+func (c *EvmosClient) GetBalance(ctx context.Context, address string, blockNumber string) (string, error) {
+	var result string
+	if err := c.call(ctx, "eth_getBalance", []interface{}{address, blockNumber}, &result); err != nil {
+		return "", err
 	}
 
-	return result.Result, nil
+	return result, nil
 }
 
-func (c *EvmosClient) GetTransactionTrace(txHash string) (map[string]interface{}, error) {
-	requestBody, err := json.Marshal(map[string]interface{}{
-		"method":  "debug_traceTransaction",
-		"params":  []interface{}{txHash, map[string]string{"tracer": "callTracer"}},
-		"id":      1,
-		"jsonrpc": "2.0",
-	})
-	if err != nil {
-		return nil, err
+func (c *EvmosClient) GetBlockNumber(ctx context.Context) (string, error) {
+	var result string
+	if err := c.call(ctx, "eth_blockNumber", []interface{}{}, &result); err != nil {
+		return "", err
 	}
 
-	resp, err := http.Post(c.BaseURL, "application/json", bytes.NewBuffer(requestBody))
-	if err != nil {
+	return result, nil
+}
+
+// GetBlock returns the block with its full transactions, or nil when the node does not have it.
+func (c *EvmosClient) GetBlock(ctx context.Context, blockNumber string) (map[string]interface{}, error) {
+	var result map[string]interface{}
+	if err := c.call(ctx, "eth_getBlockByNumber", []interface{}{blockNumber, true}, &result); err != nil {
 		return nil, err
 	}
-	defer closeBody(resp.Body)
 
-	var result struct {
-		Result map[string]interface{} `json:"result"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+	return result, nil
+}
+
+func (c *EvmosClient) GetTransactionTrace(ctx context.Context, txHash string) (map[string]interface{}, error) {
+	var result map[string]interface{}
+	params := []interface{}{txHash, map[string]string{"tracer": "callTracer"}}
+	if err := c.call(ctx, "debug_traceTransaction", params, &result); err != nil {
 		return nil, err
 	}
 
-	return result.Result, nil
+	return result, nil
 }
 
-func (c *EvmosClient) GetBlocksInRange(start, end int) ([]map[string]interface{}, error) {
+func (c *EvmosClient) GetBlocksInRange(ctx context.Context, start, end int) ([]map[string]interface{}, error) {
 	var blocks []map[string]interface{}
 	for i := start; i <= end; i++ {
 		blockNumber := fmt.Sprintf("0x%x", i)
-		block, err := c.GetBlock(blockNumber)
+		block, err := c.GetBlock(ctx, blockNumber)
 		if err != nil {
 			return nil, err
 		}
@@ -167,31 +246,101 @@ func (c *EvmosClient) GetBlocksInRange(start, end int) ([]map[string]interface{}
 	return blocks, nil
 }
 
-func (c *EvmosClient) GetCode(address, blockNumber string) (string, error) {
-	requestBody, err := json.Marshal(map[string]interface{}{
-		"method":  "eth_getCode",
-		"params":  []interface{}{address, blockNumber},
-		"id":      1,
-		"jsonrpc": "2.0",
-	})
+func (c *EvmosClient) GetCode(ctx context.Context, address, blockNumber string) (string, error) {
+	var result string
+	if err := c.call(ctx, "eth_getCode", []interface{}{address, blockNumber}, &result); err != nil {
+		return "", err
+	}
+
+	return result, nil
+}
 
+// Call executes a read-only message call (eth_call) against the contract at address and returns the raw hex output.
+func (c *EvmosClient) Call(ctx context.Context, to, data, blockNumber string) (string, error) {
+	var result string
+	err := c.call(ctx, "eth_call", []interface{}{map[string]string{"to": to, "data": data}, blockNumber}, &result)
 	if err != nil {
 		return "", err
 	}
 
-	resp, err := http.Post(c.BaseURL, "application/json", bytes.NewBuffer(requestBody))
-	if err != nil {
+	return result, nil
+}
+
+// GetLogs returns the logs emitted by the contract at address between fromBlock and toBlock inclusive.
+func (c *EvmosClient) GetLogs(ctx context.Context, address, fromBlock, toBlock string) ([]map[string]interface{}, error) {
+	var result []map[string]interface{}
+	filter := map[string]string{"address": address, "fromBlock": fromBlock, "toBlock": toBlock}
+	if err := c.call(ctx, "eth_getLogs", []interface{}{filter}, &result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// GetStorageAt returns the 32-byte storage word at slot of the contract at address.
+func (c *EvmosClient) GetStorageAt(ctx context.Context, address, slot, blockNumber string) (string, error) {
+	var result string
+	if err := c.call(ctx, "eth_getStorageAt", []interface{}{address, slot, blockNumber}, &result); err != nil {
 		return "", err
 	}
 
-	defer closeBody(resp.Body)
+	return result, nil
+}
 
-	var result struct {
-		Result string `json:"result"`
+// GetTransactionByHash returns a transaction by its hash, or nil when the node does not know it.
+func (c *EvmosClient) GetTransactionByHash(ctx context.Context, txHash string) (map[string]interface{}, error) {
+	var result map[string]interface{}
+	if err := c.call(ctx, "eth_getTransactionByHash", []interface{}{txHash}, &result); err != nil {
+		return nil, err
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+
+	return result, nil
+}
+
+// GetTransactionReceipt returns the receipt of a mined transaction.
+func (c *EvmosClient) GetTransactionReceipt(ctx context.Context, txHash string) (map[string]interface{}, error) {
+	var result map[string]interface{}
+	if err := c.call(ctx, "eth_getTransactionReceipt", []interface{}{txHash}, &result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// GetFeeHistory returns base fees, gas used ratios and priority fee percentiles for blockCount blocks up to newestBlock.
+func (c *EvmosClient) GetFeeHistory(ctx context.Context, blockCount int, newestBlock string, rewardPercentiles []float64) (map[string]interface{}, error) {
+	var result map[string]interface{}
+	params := []interface{}{fmt.Sprintf("0x%x", blockCount), newestBlock, rewardPercentiles}
+	if err := c.call(ctx, "eth_feeHistory", params, &result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// GetTransactionCount returns the nonce of address at the given block, i.e. the number of transactions it has sent.
+func (c *EvmosClient) GetTransactionCount(ctx context.Context, address, blockNumber string) (string, error) {
+	var result string
+	if err := c.call(ctx, "eth_getTransactionCount", []interface{}{address, blockNumber}, &result); err != nil {
 		return "", err
 	}
 
-	return result.Result, nil
+	return result, nil
+}
+
+// GetBalanceHistory returns the balance of address at each of the given blocks, fetched in JSON-RPC batches.
+func (c *EvmosClient) GetBalanceHistory(ctx context.Context, address string, blockNumbers []string) ([]string, error) {
+	requests := make([]batchRequest, len(blockNumbers))
+	balances := make([]string, len(blockNumbers))
+	out := make([]interface{}, len(blockNumbers))
+	for i, blockNumber := range blockNumbers {
+		requests[i] = batchRequest{method: "eth_getBalance", params: []interface{}{address, blockNumber}}
+		out[i] = &balances[i]
+	}
+
+	if err := c.batchCall(ctx, requests, out); err != nil {
+		return nil, err
+	}
+
+	return balances, nil
 }
@@ -0,0 +1,82 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"onchain-stats/logging"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestIDPropagation(t *testing.T) {
+	var forwarded []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = append(forwarded, r.Header.Get("X-Request-ID"))
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x10"}`))
+	}))
+	defer server.Close()
+
+	var logs bytes.Buffer
+	logger, err := logging.NewLogger(&logs, "debug", "json")
+	assert.NoError(t, err)
+	defaultLogger := slog.Default()
+	slog.SetDefault(logger)
+	defer slog.SetDefault(defaultLogger)
+
+	c := &EvmosClient{BaseURL: server.URL}
+	number, err := c.GetBlockNumber(logging.WithRequestID(context.Background(), "req-1"))
+	assert.NoError(t, err)
+	assert.Equal(t, "0x10", number)
+	_, err = c.GetBlockNumber(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"req-1", ""}, forwarded)
+
+	var record map[string]interface{}
+	assert.NoError(t, json.NewDecoder(&logs).Decode(&record))
+	assert.Equal(t, "node call", record["msg"])
+	assert.Equal(t, "eth_blockNumber", record["method"])
+	assert.Equal(t, "req-1", record["request_id"])
+
+	// canceling the request context aborts its node calls
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = c.GetBlockNumber(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestRPCErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"node unavailable"}}`))
+	}))
+	defer server.Close()
+	c := &EvmosClient{BaseURL: server.URL}
+	ctx := context.Background()
+
+	calls := map[string]func() error{
+		"eth_accounts": func() error { _, err := c.GetAccounts(ctx); return err },
+		"eth_getBalance": func() error {
+			_, err := c.GetBalance(ctx, "0x00000000000000000000000000000000000000aa", "latest")
+			return err
+		},
+		"eth_blockNumber":        func() error { _, err := c.GetBlockNumber(ctx); return err },
+		"eth_getBlockByNumber":   func() error { _, err := c.GetBlock(ctx, "0x1"); return err },
+		"debug_traceTransaction": func() error { _, err := c.GetTransactionTrace(ctx, "0xTxHash"); return err },
+		"eth_getCode": func() error {
+			_, err := c.GetCode(ctx, "0x00000000000000000000000000000000000000aa", "latest")
+			return err
+		},
+	}
+	for method, call := range calls {
+		errors := nodeErrors.Value(method)
+		err := call()
+		var rpcErr *RPCError
+		assert.ErrorAs(t, err, &rpcErr, method)
+		assert.Equal(t, "node unavailable", rpcErr.Message, method)
+		assert.Equal(t, errors+1, nodeErrors.Value(method), method)
+	}
+}
@@ -0,0 +1,264 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// minReconnectDelay and maxReconnectDelay bound the exponential backoff between reconnection attempts.
+	minReconnectDelay = time.Second
+	maxReconnectDelay = 30 * time.Second
+	// subscriptionIdleTimeout is how long a connection may stay silent before it is considered dead. Evmos
+	// produces a block every few seconds, so a healthy newHeads subscription is never silent that long.
+	subscriptionIdleTimeout = time.Minute
+)
+
+// Subscription is an eth_subscribe request and the handler of its notifications. Backfill, when set, is
+// called once the subscription is active on every (re)connection, to deliver the notifications missed while
+// disconnected; the connection is retried when it fails.
+type Subscription struct {
+	Params   []interface{}
+	Handle   func(result json.RawMessage)
+	Backfill func(ctx context.Context) error
+}
+
+// NewHeads subscribes to the headers of new blocks.
+func NewHeads(handle func(head map[string]interface{})) Subscription {
+	return Subscription{Params: []interface{}{"newHeads"}, Handle: func(result json.RawMessage) {
+		var head map[string]interface{}
+		if err := json.Unmarshal(result, &head); err == nil {
+			handle(head)
+		}
+	}}
+}
+
+// Logs subscribes to the logs emitted by the contract at address. On every (re)connection, the logs emitted
+// since the last one delivered are fetched from node with eth_getLogs up to the current head, so no log is
+// lost while disconnected, and logs already delivered are not delivered again. Logs are delivered in order.
+func Logs(node *EvmosClient, address string, handle func(log map[string]interface{})) Subscription {
+	tracker := &logTracker{handle: handle}
+	return Subscription{
+		Params: []interface{}{"logs", map[string]interface{}{"address": address}},
+		Handle: func(result json.RawMessage) {
+			var log map[string]interface{}
+			if err := json.Unmarshal(result, &log); err == nil {
+				tracker.deliver(log)
+			}
+		},
+		Backfill: func(ctx context.Context) error {
+			head, err := node.GetBlockNumber(ctx)
+			if err != nil {
+				return err
+			}
+			headNumber, err := parseQuantity(head)
+			if err != nil {
+				return fmt.Errorf("parsing head %q: %w", head, err)
+			}
+
+			tracker.mu.Lock()
+			from, started := tracker.block, tracker.started
+			tracker.mu.Unlock()
+			if started && from <= headNumber {
+				logs, err := node.GetLogs(ctx, address, fmt.Sprintf("0x%x", from), head)
+				if err != nil {
+					return err
+				}
+				sort.SliceStable(logs, func(i, j int) bool {
+					a, b := logPosition(logs[i]), logPosition(logs[j])
+					return a[0] < b[0] || a[0] == b[0] && a[1] < b[1]
+				})
+				for _, log := range logs {
+					tracker.deliver(log)
+				}
+			}
+			// every log up to the head has been delivered, or predates the first connection
+			tracker.advance(headNumber)
+			return nil
+		},
+	}
+}
+
+// logTracker remembers the position of the last log delivered, so logs received both from the subscription
+// and from a backfill are delivered once.
+type logTracker struct {
+	mu      sync.Mutex
+	handle  func(log map[string]interface{})
+	started bool
+	block   uint64
+	index   uint64
+}
+
+// deliver hands a log to the handler unless it is not after the last one delivered.
+func (t *logTracker) deliver(log map[string]interface{}) {
+	position := logPosition(log)
+	t.mu.Lock()
+	if t.started && (position[0] < t.block || position[0] == t.block && position[1] <= t.index) {
+		t.mu.Unlock()
+		return
+	}
+	t.started, t.block, t.index = true, position[0], position[1]
+	t.mu.Unlock()
+	t.handle(log)
+}
+
+// advance marks every log up to the end of block as delivered.
+func (t *logTracker) advance(block uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.started || block > t.block || block == t.block && t.index != ^uint64(0) {
+		t.started, t.block, t.index = true, block, ^uint64(0)
+	}
+}
+
+// logPosition returns the block number and log index of a log.
+func logPosition(log map[string]interface{}) [2]uint64 {
+	block, _ := log["blockNumber"].(string)
+	index, _ := log["logIndex"].(string)
+	blockNumber, _ := parseQuantity(block)
+	logIndex, _ := parseQuantity(index)
+	return [2]uint64{blockNumber, logIndex}
+}
+
+func parseQuantity(quantity string) (uint64, error) {
+	return strconv.ParseUint(strings.TrimPrefix(quantity, "0x"), 16, 64)
+}
+
+// Subscriber keeps eth_subscribe subscriptions open over a WebSocket connection to the node, reconnecting
+// with exponential backoff whenever the connection fails. Notifications sent while disconnected are lost, so
+// the subscriptions backfill them and OnConnect is called after every (re)connection to let the caller
+// backfill what it missed.
+type Subscriber struct {
+	URL           string
+	Subscriptions []Subscription
+	OnConnect     func()
+}
+
+// Run connects and dispatches notifications until ctx is done.
+func (s *Subscriber) Run(ctx context.Context) {
+	delay := minReconnectDelay
+	for {
+		subscribed, err := s.session(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if subscribed {
+			delay = minReconnectDelay
+		}
+		slog.WarnContext(ctx, "node subscription failed", "error", err, "retry_in", delay)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > maxReconnectDelay {
+			delay = maxReconnectDelay
+		}
+	}
+}
+
+// session subscribes over a new connection and dispatches notifications until it fails, reporting whether
+// every subscription was accepted.
+func (s *Subscriber) session(ctx context.Context) (bool, error) {
+	conn, err := dialWebSocket(ctx, s.URL)
+	if err != nil {
+		return false, err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		_ = conn.close() // unblocks the read loop, whose error is reported instead
+	}()
+
+	for i, subscription := range s.Subscriptions {
+		request, err := json.Marshal(map[string]interface{}{
+			"method":  "eth_subscribe",
+			"params":  subscription.Params,
+			"id":      i + 1,
+			"jsonrpc": "2.0",
+		})
+		if err != nil {
+			return false, err
+		}
+		if err := conn.writeMessage(request); err != nil {
+			return false, err
+		}
+	}
+
+	handlers := make(map[string]func(json.RawMessage))
+	subscribed := len(s.Subscriptions) == 0
+	connected := func() error {
+		for _, subscription := range s.Subscriptions {
+			if subscription.Backfill != nil {
+				if err := subscription.Backfill(ctx); err != nil {
+					return fmt.Errorf("backfilling: %w", err)
+				}
+			}
+		}
+		if s.OnConnect != nil {
+			s.OnConnect()
+		}
+		return nil
+	}
+	if subscribed {
+		if err := connected(); err != nil {
+			return subscribed, err
+		}
+	}
+	for {
+		if err := conn.conn.SetReadDeadline(time.Now().Add(subscriptionIdleTimeout)); err != nil {
+			return subscribed, err
+		}
+		message, err := conn.readMessage()
+		if err != nil {
+			return subscribed, err
+		}
+
+		var response struct {
+			ID     int             `json:"id"`
+			Result json.RawMessage `json:"result"`
+			Error  *RPCError       `json:"error"`
+			Method string          `json:"method"`
+			Params struct {
+				Subscription string          `json:"subscription"`
+				Result       json.RawMessage `json:"result"`
+			} `json:"params"`
+		}
+		if err := json.Unmarshal(message, &response); err != nil {
+			return subscribed, err
+		}
+
+		switch {
+		case response.Method == "eth_subscription":
+			if handle, exists := handlers[response.Params.Subscription]; exists {
+				handle(response.Params.Result)
+			}
+		case response.Error != nil:
+			return subscribed, response.Error
+		case response.ID >= 1 && response.ID <= len(s.Subscriptions):
+			var id string
+			if err := json.Unmarshal(response.Result, &id); err != nil {
+				return subscribed, err
+			}
+			handlers[id] = s.Subscriptions[response.ID-1].Handle
+			if !subscribed && len(handlers) == len(s.Subscriptions) {
+				subscribed = true
+				if err := connected(); err != nil {
+					return subscribed, err
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// acceptWebSocket upgrades a test server request, returning a wsConn reading the client frames.
+func acceptWebSocket(t *testing.T, w http.ResponseWriter, r *http.Request) *wsConn {
+	conn, rw, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + acceptKey(r.Header.Get("Sec-WebSocket-Key")) + "\r\n\r\n")
+	_ = rw.Flush()
+	return &wsConn{conn: conn, reader: rw.Reader}
+}
+
+// writeServerFrame writes a short (under 126 bytes) unmasked text frame, as servers do.
+func writeServerFrame(conn net.Conn, message string) {
+	frame := []byte{0x81, byte(len(message))}
+	_, _ = conn.Write(append(frame, message...))
+}
+
+func TestSubscriber(t *testing.T) {
+	var (
+		mu          sync.Mutex
+		connections int
+		heads       []string
+		connects    int
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws := acceptWebSocket(t, w, r)
+		defer ws.conn.Close()
+
+		message, err := ws.readMessage()
+		if err != nil {
+			return
+		}
+		var request map[string]interface{}
+		_ = json.Unmarshal(message, &request)
+		assert.Equal(t, "eth_subscribe", request["method"])
+		assert.Equal(t, []interface{}{"newHeads"}, request["params"])
+
+		mu.Lock()
+		connections++
+		number := connections
+		mu.Unlock()
+
+		writeServerFrame(ws.conn, `{"jsonrpc":"2.0","id":1,"result":"0xsub"}`)
+		writeServerFrame(ws.conn, fmt.Sprintf(
+			`{"jsonrpc":"2.0","method":"eth_subscription","params":{"subscription":"0xsub","result":{"number":"0x%x"}}}`, number))
+		if number == 1 {
+			return // drop the first connection to force a reconnect
+		}
+		_, _ = ws.readMessage() // hold the second connection open until the subscriber closes it
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	subscriber := &Subscriber{
+		URL: "ws" + strings.TrimPrefix(server.URL, "http"),
+		Subscriptions: []Subscription{NewHeads(func(head map[string]interface{}) {
+			mu.Lock()
+			defer mu.Unlock()
+			heads = append(heads, head["number"].(string))
+		})},
+		OnConnect: func() {
+			mu.Lock()
+			defer mu.Unlock()
+			connects++
+		},
+	}
+	go subscriber.Run(ctx)
+
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(heads) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"0x1", "0x2"}, heads)
+	assert.Equal(t, 2, connects)
+}
+
+func TestLogsBackfill(t *testing.T) {
+	const contract = "0x00000000000000000000000000000000000000cc"
+	logFrame := func(block, index string) string {
+		// kept under 126 bytes for writeServerFrame
+		return `{"method":"eth_subscription","params":{"subscription":"0xlogs","result":` +
+			`{"blockNumber":"` + block + `","logIndex":"` + index + `"}}}`
+	}
+	var (
+		mu          sync.Mutex
+		connections int
+		heads       = []string{"0x4", "0x9"}
+		delivered   []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "websocket" {
+			var request struct {
+				Method string        `json:"method"`
+				Params []interface{} `json:"params"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&request)
+			mu.Lock()
+			defer mu.Unlock()
+			switch request.Method {
+			case "eth_blockNumber":
+				head := heads[0]
+				heads = heads[1:]
+				_, _ = fmt.Fprintf(w, `{"jsonrpc":"2.0","id":1,"result":%q}`, head)
+			case "eth_getLogs":
+				assert.Equal(t, map[string]interface{}{"address": contract, "fromBlock": "0x5", "toBlock": "0x9"}, request.Params[0])
+				// the log received before the disconnection is returned again, with the ones emitted meanwhile
+				_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":[{"blockNumber":"0x7","logIndex":"0x1"},{"blockNumber":"0x5","logIndex":"0x0"},{"blockNumber":"0x9","logIndex":"0x0"}]}`))
+			}
+			return
+		}
+
+		ws := acceptWebSocket(t, w, r)
+		defer ws.conn.Close()
+		message, err := ws.readMessage()
+		if err != nil {
+			return
+		}
+		var request map[string]interface{}
+		_ = json.Unmarshal(message, &request)
+		assert.Equal(t, []interface{}{"logs", map[string]interface{}{"address": contract}}, request["params"])
+
+		mu.Lock()
+		connections++
+		number := connections
+		mu.Unlock()
+
+		writeServerFrame(ws.conn, `{"jsonrpc":"2.0","id":1,"result":"0xlogs"}`)
+		if number == 1 {
+			writeServerFrame(ws.conn, logFrame("0x5", "0x0"))
+			return // drop the first connection, missing the log of block 7
+		}
+		// the log of block 9 was backfilled already and is not delivered twice
+		writeServerFrame(ws.conn, logFrame("0x9", "0x0"))
+		writeServerFrame(ws.conn, logFrame("0xa", "0x0"))
+		_, _ = ws.readMessage()
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	node := &EvmosClient{BaseURL: server.URL}
+	subscriber := &Subscriber{
+		URL: "ws" + strings.TrimPrefix(server.URL, "http"),
+		Subscriptions: []Subscription{Logs(node, contract, func(log map[string]interface{}) {
+			mu.Lock()
+			defer mu.Unlock()
+			delivered = append(delivered, log["blockNumber"].(string)+":"+log["logIndex"].(string))
+		})},
+	}
+	go subscriber.Run(ctx)
+
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(delivered) >= 4
+	}, 5*time.Second, 10*time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"0x5:0x0", "0x7:0x1", "0x9:0x0", "0xa:0x0"}, delivered)
+}
+
+func TestWebSocketFrames(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	clientConn := &wsConn{conn: client, reader: bufio.NewReader(client)}
+	serverConn := &wsConn{conn: server, reader: bufio.NewReader(server)}
+
+	// payloads above 125 bytes use the 16-bit extended length
+	long := strings.Repeat("x", 300)
+	go func() { _ = clientConn.writeMessage([]byte(long)) }()
+	message, err := serverConn.readMessage()
+	assert.NoError(t, err)
+	assert.Equal(t, long, string(message))
+
+	// fragmented messages are reassembled and pings answered in between
+	go func() {
+		_, _ = server.Write([]byte{0x01, 0x03, 'f', 'o', 'o'})
+		_, _ = server.Write([]byte{0x89, 0x00})
+		_, _ = server.Write([]byte{0x80, 0x03, 'b', 'a', 'r'})
+	}()
+	go func() {
+		_, opcode, _, err := serverConn.readFrame()
+		assert.NoError(t, err)
+		assert.Equal(t, byte(opPong), opcode)
+	}()
+	message, err = clientConn.readMessage()
+	assert.NoError(t, err)
+	assert.Equal(t, "foobar", string(message))
+}
@@ -0,0 +1,255 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1" // #nosec G505 -- required by the WebSocket handshake, not used for security
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// websocketGUID is appended to the handshake key to compute Sec-WebSocket-Accept (RFC 6455 section 1.3).
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// maxMessageSize bounds the size of a message read from the node.
+const maxMessageSize = 16 << 20
+
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+)
+
+var errConnectionClosed = errors.New("websocket connection closed")
+
+// wsConn is a minimal client side WebSocket connection (RFC 6455), enough to exchange JSON-RPC messages with
+// the node. It does not negotiate extensions, so frames are never compressed.
+type wsConn struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	writeMu sync.Mutex
+}
+
+// dialWebSocket opens a WebSocket connection to a ws:// or wss:// URL.
+func dialWebSocket(ctx context.Context, rawURL string) (*wsConn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	host := u.Host
+	switch u.Scheme {
+	case "ws":
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "80")
+		}
+	case "wss":
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "443")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported websocket scheme %q, expected ws or wss", u.Scheme)
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "wss" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			_ = conn.Close() // the handshake error is reported instead
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	ws, err := handshake(conn, u)
+	if err != nil {
+		_ = conn.Close() // the handshake error is reported instead
+		return nil, err
+	}
+	return ws, nil
+}
+
+// handshake upgrades an open connection to the WebSocket protocol.
+func handshake(conn net.Conn, u *url.URL) (*wsConn, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	req := &http.Request{
+		Method:     http.MethodGet,
+		URL:        u,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header: http.Header{
+			"Upgrade":               {"websocket"},
+			"Connection":            {"Upgrade"},
+			"Sec-WebSocket-Key":     {key},
+			"Sec-WebSocket-Version": {"13"},
+		},
+		Host: u.Host,
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return nil, fmt.Errorf("websocket handshake failed: %s", resp.Status)
+	}
+	if resp.Header.Get("Sec-WebSocket-Accept") != acceptKey(key) {
+		return nil, errors.New("websocket handshake failed: invalid Sec-WebSocket-Accept")
+	}
+
+	return &wsConn{conn: conn, reader: reader}, nil
+}
+
+func acceptKey(key string) string {
+	digest := sha1.Sum([]byte(key + websocketGUID)) // #nosec G401 -- mandated by RFC 6455
+	return base64.StdEncoding.EncodeToString(digest[:])
+}
+
+// writeMessage sends a text message in a single frame.
+func (c *wsConn) writeMessage(data []byte) error {
+	return c.writeFrame(opText, data)
+}
+
+// writeFrame sends a final frame. Client frames are always masked.
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	header := []byte{0x80 | opcode}
+	switch length := len(payload); {
+	case length < 126:
+		header = append(header, 0x80|byte(length))
+	case length <= 0xffff:
+		header = append(header, 0x80|126, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(length))
+	default:
+		header = append(header, 0x80|127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(header[2:], uint64(length))
+	}
+
+	mask := make([]byte, 4)
+	if _, err := rand.Read(mask); err != nil {
+		return err
+	}
+	frame := make([]byte, 0, len(header)+len(mask)+len(payload))
+	frame = append(frame, header...)
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+// readMessage returns the next text or binary message, reassembling fragmented messages and answering pings
+// along the way. A close frame from the node is answered and reported as errConnectionClosed.
+func (c *wsConn) readMessage() ([]byte, error) {
+	var message []byte
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+
+		switch opcode {
+		case opPing:
+			if err := c.writeFrame(opPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			_ = c.writeFrame(opClose, nil) // best effort, the connection is going away anyway
+			return nil, errConnectionClosed
+		case opText, opBinary, opContinuation:
+		default:
+			return nil, fmt.Errorf("unknown websocket opcode %#x", opcode)
+		}
+
+		message = append(message, payload...)
+		if len(message) > maxMessageSize {
+			return nil, fmt.Errorf("websocket message exceeds %d bytes", maxMessageSize)
+		}
+		if fin {
+			return message, nil
+		}
+	}
+}
+
+func (c *wsConn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(c.reader, header); err != nil {
+		return false, 0, nil, err
+	}
+	fin, opcode = header[0]&0x80 != 0, header[0]&0x0f
+	masked := header[1]&0x80 != 0
+
+	length := uint64(header[1] & 0x7f)
+	switch length {
+	case 126:
+		extended := make([]byte, 2)
+		if _, err := io.ReadFull(c.reader, extended); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(extended))
+	case 127:
+		extended := make([]byte, 8)
+		if _, err := io.ReadFull(c.reader, extended); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(extended)
+	}
+	if length > maxMessageSize {
+		return false, 0, nil, fmt.Errorf("websocket frame exceeds %d bytes", maxMessageSize)
+	}
+
+	var mask []byte
+	if masked {
+		mask = make([]byte, 4)
+		if _, err := io.ReadFull(c.reader, mask); err != nil {
+			return false, 0, nil, err
+		}
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return fin, opcode, payload, nil
+}
+
+// close sends a close frame and closes the underlying connection.
+func (c *wsConn) close() error {
+	_ = c.writeFrame(opClose, nil) // best effort, the connection is closed regardless
+	return c.conn.Close()
+}
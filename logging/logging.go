@@ -0,0 +1,76 @@
+// Package logging configures structured logging with log/slog and carries request IDs through contexts, so
+// every record logged while serving a request, including the node calls it makes, can be correlated.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+type requestIDKey struct{}
+
+// WithRequestID returns a context carrying the request ID.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID carried by ctx, or "" when there is none.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// NewRequestID returns a random 16 character hex request ID.
+func NewRequestID() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(id)
+}
+
+// contextHandler adds the request ID of the context to every record logged with one.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		record.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// NewLogger returns a logger writing records at or above level to w, as JSON or as key=value text, and adding
+// the request ID of the context passed to the *Context logging methods.
+func NewLogger(w io.Writer, level, format string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q, expected debug, info, warn or error", level)
+	}
+
+	options := &slog.HandlerOptions{Level: lvl}
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case "json":
+		handler = slog.NewJSONHandler(w, options)
+	case "text":
+		handler = slog.NewTextHandler(w, options)
+	default:
+		return nil, fmt.Errorf("invalid log format %q, expected json or text", format)
+	}
+	return slog.New(contextHandler{handler}), nil
+}
@@ -0,0 +1,38 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewLogger(t *testing.T) {
+	var b bytes.Buffer
+	logger, err := NewLogger(&b, "info", "json")
+	assert.NoError(t, err)
+
+	ctx := WithRequestID(context.Background(), "abc123")
+	assert.Equal(t, "abc123", RequestID(ctx))
+	assert.Equal(t, "", RequestID(context.Background()))
+
+	logger.DebugContext(ctx, "dropped")
+	logger.With("component", "test").InfoContext(ctx, "node call", "method", "eth_blockNumber")
+
+	var record map[string]interface{}
+	assert.NoError(t, json.Unmarshal(b.Bytes(), &record))
+	assert.Equal(t, "node call", record["msg"])
+	assert.Equal(t, "abc123", record["request_id"])
+	assert.Equal(t, "test", record["component"])
+	assert.Equal(t, "eth_blockNumber", record["method"])
+
+	_, err = NewLogger(&b, "verbose", "json")
+	assert.Error(t, err)
+	_, err = NewLogger(&b, "info", "xml")
+	assert.Error(t, err)
+
+	assert.Len(t, NewRequestID(), 16)
+	assert.NotEqual(t, NewRequestID(), NewRequestID())
+}
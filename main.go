@@ -2,19 +2,181 @@
 package main
 
 import (
+	"context"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
 	"onchain-stats/client"
+	"onchain-stats/logging"
+	"onchain-stats/metrics"
 	"onchain-stats/service"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 )
 
 const BaseURL = "http://localhost:8545"
 
+// maxPageSize bounds the page size accepted by paginated endpoints.
+const maxPageSize = 100
+
+// maxABISize bounds the body accepted when uploading a contract ABI.
+const maxABISize = 1 << 20
+
+// streamHeartbeat is the interval of the comments keeping idle event streams open through proxies.
+const streamHeartbeat = 15 * time.Second
+
+// shutdownTimeout bounds the time given to requests in flight to complete on shutdown.
+const shutdownTimeout = 10 * time.Second
+
+// maxEntrySize bounds the body accepted when setting an address label or adding a watch.
+const maxEntrySize = 1 << 12
+
+var (
+	httpRequests = metrics.NewCounter("http_requests_total", "HTTP requests handled, by route and status code.", "handler", "code")
+	httpDuration = metrics.NewHistogram("http_request_duration_seconds", "Time spent handling HTTP requests, by route.",
+		metrics.DefaultBuckets, "handler")
+)
+
+// errInvalidParam marks errors caused by a malformed query parameter.
+var errInvalidParam = errors.New("invalid parameter")
+
+// maxBlockSpan bounds the number of blocks an endpoint fetches for a single request.
+const maxBlockSpan = 10000
+
+// blockRange is sampledBlockRange for endpoints fetching every block of the range, which may span at most
+// maxBlockSpan blocks.
+func blockRange(r *http.Request, defaultStart, defaultEnd int) (int, int, error) {
+	start, end, err := sampledBlockRange(r, defaultStart, defaultEnd)
+	if err != nil {
+		return 0, 0, err
+	}
+	if span := end - start + 1; span > maxBlockSpan {
+		return 0, 0, fmt.Errorf("%w: range of %d blocks exceeds the limit of %d", errInvalidParam, span, maxBlockSpan)
+	}
+	return start, end, nil
+}
+
+// sampledBlockRange reads the start and end block query parameters, falling back to the given defaults.
+// fromTime and toTime may be given instead, as RFC 3339 or unix seconds, and are resolved to the first block
+// at or after fromTime and the last block at or before toTime. The span of the range is not bounded, so it
+// is only meant for endpoints sampling a bounded number of blocks within it.
+func sampledBlockRange(r *http.Request, defaultStart, defaultEnd int) (int, int, error) {
+	start, end := defaultStart, defaultEnd
+	if value := r.URL.Query().Get("start"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return 0, 0, fmt.Errorf("%w: start block %q", errInvalidParam, value)
+		}
+		start = n
+	}
+	if value := r.URL.Query().Get("end"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return 0, 0, fmt.Errorf("%w: end block %q", errInvalidParam, value)
+		}
+		end = n
+	}
+
+	fromTime, err := timeParam(r, "fromTime")
+	if err != nil {
+		return 0, 0, err
+	}
+	toTime, err := timeParam(r, "toTime")
+	if err != nil {
+		return 0, 0, err
+	}
+	if !fromTime.IsZero() || !toTime.IsZero() {
+		start, end, err = service.BlockRangeForTimes(r.Context(), fromTime, toTime, start, end)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	if start > end {
+		return 0, 0, fmt.Errorf("%w: start block %d is after end block %d", errInvalidParam, start, end)
+	}
+
+	return start, end, nil
+}
+
+// rangeErrorStatus returns the status code for an error returned by blockRange. Resolving times to blocks
+// queries the node, whose failures are not the client's fault.
+func rangeErrorStatus(err error) int {
+	if errors.Is(err, errInvalidParam) || errors.Is(err, service.ErrNoBlockAtTime) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// timeParam reads a time query parameter given as RFC 3339 or unix seconds. The zero time is returned when
+// it is absent.
+func timeParam(r *http.Request, name string) (time.Time, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil && seconds >= 0 {
+		return time.Unix(seconds, 0).UTC(), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %s %q, expected RFC 3339 or unix seconds", errInvalidParam, name, value)
+	}
+	return t, nil
+}
+
+// intParam reads a positive integer query parameter, falling back to defaultValue when it is absent.
+func intParam(r *http.Request, name string, defaultValue int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid %s %q", name, value)
+	}
+	return n, nil
+}
+
+// listParam reads a comma separated query parameter, dropping empty entries.
+func listParam(r *http.Request, name string) []string {
+	var values []string
+	for _, value := range strings.Split(r.URL.Query().Get(name), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
 func GetSmartContractsHandler(w http.ResponseWriter, r *http.Request) {
-	contractInteractions, err := service.GetSmartContracts(100, 200)
+	sortBy := r.URL.Query().Get("sort")
+	if sortBy == "" {
+		sortBy = "interactions"
+	}
+
+	start, end, err := blockRange(r, 100, 200)
+	if err != nil {
+		http.Error(w, err.Error(), rangeErrorStatus(err))
+		return
+	}
 
+	contractInteractions, err := service.GetSmartContracts(r.Context(), start, end, sortBy)
+	if errors.Is(err, service.ErrUnknownSortField) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Error fetching smart contracts: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -27,22 +189,117 @@ func GetSmartContractsHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func GetRichestUsersHandler(w http.ResponseWriter, r *http.Request) {
-	// TODO: get blocks range from query params
-	richestUsers, err := service.CalculateRichestUsers(200)
+	mode := r.URL.Query().Get("mode")
+	switch mode {
+	case "", "balance", "entity":
+	case "change":
+		GetBalanceChangesHandler(w, r)
+		return
+	default:
+		http.Error(w, fmt.Sprintf("unknown mode %q, expected balance, change or entity", mode), http.StatusBadRequest)
+		return
+	}
+
+	unit := r.URL.Query().Get("unit")
+	if unit == "" {
+		unit = "wei"
+	}
 
+	// balances are taken at the end of the range the clusters are built over
+	start, end, err := blockRange(r, 100, 200)
+	if err != nil {
+		http.Error(w, err.Error(), rangeErrorStatus(err))
+		return
+	}
+	richestUsers, err := service.CalculateRichestUsers(r.Context(), end, unit)
+	if errors.Is(err, service.ErrUnknownUnit) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Error fetching richest users: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	richestUsers = service.ExcludeCategories(richestUsers, listParam(r, "exclude"))
+
+	var response interface{} = richestUsers
+	if mode == "entity" || r.URL.Query().Get("clusters") == "true" {
+		clustering, err := service.GetClusters(r.Context(), start, end)
+		if err != nil {
+			http.Error(w, "Error fetching clusters: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		clustering.Annotate(richestUsers)
+		if mode == "entity" {
+			if response, err = clustering.RichestEntities(richestUsers, unit); err != nil {
+				http.Error(w, "Error fetching richest entities: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Error encoding response: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func GetClustersHandler(w http.ResponseWriter, r *http.Request) {
+	start, end, err := blockRange(r, 100, 200)
+	if err != nil {
+		http.Error(w, err.Error(), rangeErrorStatus(err))
+		return
+	}
+
+	clustering, err := service.GetClusters(r.Context(), start, end)
+	if err != nil {
+		http.Error(w, "Error fetching clusters: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(clustering); err != nil {
+		http.Error(w, "Error encoding response: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// GetBalanceChangesHandler serves /richestusers?mode=change, ranking the wallets active between start and end
+// by how much their balance grew or shrank.
+func GetBalanceChangesHandler(w http.ResponseWriter, r *http.Request) {
+	start, end, err := blockRange(r, 100, 200)
+	if err != nil {
+		http.Error(w, err.Error(), rangeErrorStatus(err))
+		return
+	}
+	limit, err := intParam(r, "limit", 10)
+	if err != nil || limit > maxPageSize {
+		http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxPageSize), http.StatusBadRequest)
+		return
+	}
+	sortBy := r.URL.Query().Get("sort")
+	if sortBy == "" {
+		sortBy = "absolute"
+	}
+
+	changes, err := service.GetBalanceChanges(r.Context(), start, end, sortBy, limit, listParam(r, "exclude"))
+	if errors.Is(err, service.ErrUnknownSortField) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error fetching balance changes: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(richestUsers); err != nil {
+	if err := json.NewEncoder(w).Encode(changes); err != nil {
 		http.Error(w, "Error encoding response: "+err.Error(), http.StatusInternalServerError)
 	}
 }
 
 func GetAccountsHandler(w http.ResponseWriter, r *http.Request) {
-	accounts, err := service.GetAccounts()
+	accounts, err := service.GetAccounts(r.Context())
 	if err != nil {
 		http.Error(w, "Error fetching accounts: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -61,12 +318,21 @@ func GetBalanceHandler(w http.ResponseWriter, r *http.Request) {
 		block = "latest"
 	}
 
+	unit := r.URL.Query().Get("unit")
+	if unit == "" {
+		unit = "wei"
+	}
+
 	if address == "" {
 		http.Error(w, "Missing address", http.StatusBadRequest)
 		return
 	}
 
-	balance, err := service.GetBalance(address, block)
+	balance, err := service.GetWalletBalance(r.Context(), address, block, unit)
+	if errors.Is(err, service.ErrInvalidAddress) || errors.Is(err, service.ErrUnknownUnit) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Error fetching balance: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -78,6 +344,50 @@ func GetBalanceHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func GetBalanceHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	address := r.URL.Query().Get("address")
+	if address == "" {
+		http.Error(w, "Missing address parameter", http.StatusBadRequest)
+		return
+	}
+
+	// the history samples a bounded number of balances and only fetches the sampled blocks, or binary searches
+	// for them by time, so its range may span more than maxBlockSpan
+	start, end, err := sampledBlockRange(r, 100, 200)
+	if err != nil {
+		http.Error(w, err.Error(), rangeErrorStatus(err))
+		return
+	}
+	interval, err := intParam(r, "interval", 1)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var timeInterval time.Duration
+	if value := r.URL.Query().Get("timeInterval"); value != "" {
+		timeInterval, err = time.ParseDuration(value)
+		if err != nil || timeInterval < time.Second {
+			http.Error(w, fmt.Sprintf("invalid timeInterval %q, expected a duration of at least 1s", value), http.StatusBadRequest)
+			return
+		}
+	}
+
+	history, err := service.GetBalanceHistory(r.Context(), address, start, end, interval, timeInterval)
+	if errors.Is(err, service.ErrInvalidAddress) || errors.Is(err, service.ErrTooManyPoints) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error fetching balance history: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(history); err != nil {
+		http.Error(w, "Error encoding response: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
 func GetBlockHandler(w http.ResponseWriter, r *http.Request) {
 	blockNumber := r.URL.Query().Get("blockNumber")
 	if blockNumber == "" {
@@ -85,7 +395,34 @@ func GetBlockHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	block, err := service.GetBlock(blockNumber)
+	block, err := service.GetBlock(r.Context(), blockNumber)
+	if err != nil {
+		http.Error(w, "Error fetching block: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(block); err != nil {
+		http.Error(w, "Error encoding response: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func GetBlockByTimeHandler(w http.ResponseWriter, r *http.Request) {
+	t, err := timeParam(r, "time")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if t.IsZero() {
+		http.Error(w, "Missing time", http.StatusBadRequest)
+		return
+	}
+
+	block, err := service.GetBlockByTime(r.Context(), t)
+	if errors.Is(err, service.ErrNoBlockAtTime) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Error fetching block: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -98,7 +435,7 @@ func GetBlockHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func GetBlockNumberHandler(w http.ResponseWriter, r *http.Request) {
-	blockNumber, err := service.GetLatestBlock()
+	blockNumber, err := service.GetLatestBlock(r.Context())
 	if err != nil {
 		http.Error(w, "Error fetching block number: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -117,7 +454,7 @@ func GetTransactionTraceHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	trace, err := service.GetTransactionTrace(txHash)
+	trace, err := service.GetTransactionTrace(r.Context(), txHash)
 	if err != nil {
 		http.Error(w, "Error fetching transaction trace: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -129,36 +466,744 @@ func GetTransactionTraceHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func GetTransactionHandler(w http.ResponseWriter, r *http.Request) {
+	txHash := strings.TrimPrefix(r.URL.Path, "/tx/")
+	if txHash == "" || strings.Contains(txHash, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	detail, err := service.GetTransactionDetail(r.Context(), txHash)
+	if errors.Is(err, service.ErrInvalidTxHash) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, service.ErrTransactionNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error fetching transaction: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(detail); err != nil {
+		http.Error(w, "Error encoding response: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// ABIsHandler lists the contracts with a registered ABI on GET. ABIs are registered with a POST of the
+// JSON ABI for ?address=, which requires the ABIS_TOKEN bearer token.
+func ABIsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(service.GetRegisteredABIs()); err != nil {
+			http.Error(w, "Error encoding response: "+err.Error(), http.StatusInternalServerError)
+		}
+	case http.MethodPost:
+		if !authorized(w, r, "ABIS_TOKEN") {
+			return
+		}
+		address := r.URL.Query().Get("address")
+		if address == "" {
+			http.Error(w, "Missing address", http.StatusBadRequest)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxABISize))
+		if err != nil {
+			http.Error(w, "Error reading ABI: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := service.RegisterABI(address, body); err != nil {
+			http.Error(w, "Error registering ABI: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// authorized checks that the request carries the bearer token set in the tokenEnv environment variable,
+// writing an error response when it does not. Requests are refused when the variable is unset, which
+// disables the protected operations.
+func authorized(w http.ResponseWriter, r *http.Request, tokenEnv string) bool {
+	token := os.Getenv(tokenEnv)
+	if token == "" {
+		http.Error(w, "Disabled, set "+tokenEnv+" to enable it", http.StatusForbidden)
+		return false
+	}
+	given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// LabelsHandler lists address labels on GET. Labels are set with a POST or PUT of a JSON
+// {"address", "name", "category"} object and removed with a DELETE of ?address=, both of which require the
+// LABELS_TOKEN bearer token. Edits are written back to LABELS_FILE when it is a JSON file, and an edit that
+// cannot be saved is undone.
+func LabelsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(service.GetLabels()); err != nil {
+			http.Error(w, "Error encoding response: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	if r.Method != http.MethodPost && r.Method != http.MethodPut && r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !authorized(w, r, "LABELS_TOKEN") {
+		return
+	}
+
+	status := http.StatusNoContent
+	if r.Method == http.MethodDelete {
+		address := r.URL.Query().Get("address")
+		if address == "" {
+			http.Error(w, "Missing address", http.StatusBadRequest)
+			return
+		}
+		deleted, err := service.DeleteLabel(address)
+		if errors.Is(err, service.ErrLabelsNotSaved) {
+			http.Error(w, "Error saving labels: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !deleted {
+			http.NotFound(w, r)
+			return
+		}
+	} else {
+		var entry service.LabeledAddress
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxEntrySize)).Decode(&entry); err != nil {
+			http.Error(w, "Error reading label: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		err := service.SetLabel(entry.Address, entry.Label)
+		if errors.Is(err, service.ErrLabelsNotSaved) {
+			http.Error(w, "Error saving labels: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Error setting label: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		status = http.StatusCreated
+	}
+	w.WriteHeader(status)
+}
+
+// WatchlistHandler lists the watches on GET. Watches are added with a POST of a JSON Watch, answered with
+// the watch and its ID, and removed with a DELETE of ?id=. Every method requires the WATCHLIST_TOKEN bearer
+// token, since webhook URLs often carry their credential.
+func WatchlistHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		if !authorized(w, r, "WATCHLIST_TOKEN") {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(service.GetWatches()); err != nil {
+			http.Error(w, "Error encoding response: "+err.Error(), http.StatusInternalServerError)
+		}
+	case http.MethodPost:
+		if !authorized(w, r, "WATCHLIST_TOKEN") {
+			return
+		}
+		var watch service.Watch
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxEntrySize)).Decode(&watch); err != nil {
+			http.Error(w, "Error reading watch: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		watch, err := service.AddWatch(watch)
+		if err != nil {
+			http.Error(w, "Error adding watch: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		if err := json.NewEncoder(w).Encode(watch); err != nil {
+			http.Error(w, "Error encoding response: "+err.Error(), http.StatusInternalServerError)
+		}
+	case http.MethodDelete:
+		if !authorized(w, r, "WATCHLIST_TOKEN") {
+			return
+		}
+		id := r.URL.Query().Get("id")
+		if id == "" {
+			http.Error(w, "Missing id", http.StatusBadRequest)
+			return
+		}
+		if !service.RemoveWatch(id) {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// GetDeliveriesHandler returns the recent webhook delivery attempts. It requires the WATCHLIST_TOKEN bearer
+// token, as deliveries carry the webhook URLs.
+func GetDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	if !authorized(w, r, "WATCHLIST_TOKEN") {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(service.GetDeliveries()); err != nil {
+		http.Error(w, "Error encoding response: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// StreamHandler serves /stream as Server-Sent Events: new block summaries, rolling contract interaction counts
+// and watchlist alerts, as the follower ingests blocks. Clients resume after the event given in the
+// Last-Event-ID header (or lastEventId parameter) from the recent backlog, and types filters the event types.
+func StreamHandler(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("lastEventId")
+	}
+	var after uint64
+	if lastEventID != "" {
+		id, err := strconv.ParseUint(lastEventID, 10, 64)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid Last-Event-ID %q", lastEventID), http.StatusBadRequest)
+			return
+		}
+		after = id
+	}
+	types := make(map[string]bool)
+	for _, eventType := range listParam(r, "types") {
+		if eventType != service.StreamBlock && eventType != service.StreamStats && eventType != service.StreamAlert {
+			http.Error(w, fmt.Sprintf("unknown event type %q, expected block, stats or alert", eventType), http.StatusBadRequest)
+			return
+		}
+		types[eventType] = true
+	}
+
+	// the stream outlives the server write timeout
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		http.Error(w, "Error starting stream: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	backlog, updates, cancel := service.Subscribe(after)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	write := func(event service.StreamEvent) error {
+		if len(types) > 0 && !types[event.Type] {
+			return nil
+		}
+		data, err := json.Marshal(event.Data)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+		return err
+	}
+	for _, event := range backlog {
+		if err := write(event); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, open := <-updates:
+			if !open {
+				return
+			}
+			if err := write(event); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := io.WriteString(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+func GetEventsHandler(w http.ResponseWriter, r *http.Request) {
+	address := r.URL.Query().Get("address")
+	if address == "" {
+		http.Error(w, "Missing address", http.StatusBadRequest)
+		return
+	}
+
+	start, end, err := blockRange(r, 100, 200)
+	if err != nil {
+		http.Error(w, err.Error(), rangeErrorStatus(err))
+		return
+	}
+
+	events, err := service.GetDecodedEvents(r.Context(), address, start, end)
+	if errors.Is(err, service.ErrInvalidAddress) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error fetching events: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(events); err != nil {
+		http.Error(w, "Error encoding response: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func GetGasStatsHandler(w http.ResponseWriter, r *http.Request) {
+	start, end, err := blockRange(r, 100, 200)
+	if err != nil {
+		http.Error(w, err.Error(), rangeErrorStatus(err))
+		return
+	}
+
+	stats, err := service.GetGasStats(r.Context(), start, end)
+	if err != nil {
+		http.Error(w, "Error fetching gas stats: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
+		http.Error(w, "Error encoding response: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func GetChainStatsHandler(w http.ResponseWriter, r *http.Request) {
+	start, end, err := blockRange(r, 100, 200)
+	if err != nil {
+		http.Error(w, err.Error(), rangeErrorStatus(err))
+		return
+	}
+
+	stats, err := service.GetChainStats(r.Context(), start, end)
+	if err != nil {
+		http.Error(w, "Error fetching chain stats: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
+		http.Error(w, "Error encoding response: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func GetFailureStatsHandler(w http.ResponseWriter, r *http.Request) {
+	start, end, err := blockRange(r, 100, 200)
+	if err != nil {
+		http.Error(w, err.Error(), rangeErrorStatus(err))
+		return
+	}
+	limit, err := intParam(r, "limit", 10)
+	if err != nil || limit > maxPageSize {
+		http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxPageSize), http.StatusBadRequest)
+		return
+	}
+
+	stats, err := service.GetFailureStats(r.Context(), start, end, limit)
+	if err != nil {
+		http.Error(w, "Error fetching failure stats: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
+		http.Error(w, "Error encoding response: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func GetFlowsHandler(w http.ResponseWriter, r *http.Request) {
+	start, end, err := blockRange(r, 100, 200)
+	if err != nil {
+		http.Error(w, err.Error(), rangeErrorStatus(err))
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "graphml" && format != "dot" {
+		http.Error(w, fmt.Sprintf("unknown format %q, expected json, graphml or dot", format), http.StatusBadRequest)
+		return
+	}
+
+	graph, err := service.GetFlowGraph(r.Context(), start, end)
+	if err != nil {
+		http.Error(w, "Error fetching flows: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var body string
+	switch format {
+	case "graphml":
+		w.Header().Set("Content-Type", "application/graphml+xml")
+		body = graph.GraphML()
+	case "dot":
+		w.Header().Set("Content-Type", "text/vnd.graphviz")
+		body = graph.DOT()
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(graph); err != nil {
+			http.Error(w, "Error encoding response: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	if _, err := io.WriteString(w, body); err != nil {
+		http.Error(w, "Error writing response: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func GetActiveAddressesHandler(w http.ResponseWriter, r *http.Request) {
+	start, end, err := blockRange(r, 100, 200)
+	if err != nil {
+		http.Error(w, err.Error(), rangeErrorStatus(err))
+		return
+	}
+
+	interval := r.URL.Query().Get("interval")
+	if interval == "" {
+		interval = "day"
+	}
+
+	series, err := service.GetActiveAddresses(r.Context(), start, end, interval)
+	if errors.Is(err, service.ErrUnknownInterval) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error fetching active addresses: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(series); err != nil {
+		http.Error(w, "Error encoding response: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func GetAddressHandler(w http.ResponseWriter, r *http.Request) {
+	address := strings.TrimPrefix(r.URL.Path, "/address/")
+	if address == "" || strings.Contains(address, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	start, end, err := blockRange(r, 100, 200)
+	if err != nil {
+		http.Error(w, err.Error(), rangeErrorStatus(err))
+		return
+	}
+	page, err := intParam(r, "page", 1)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	pageSize, err := intParam(r, "pageSize", 25)
+	if err != nil || pageSize > maxPageSize {
+		http.Error(w, fmt.Sprintf("pageSize must be between 1 and %d", maxPageSize), http.StatusBadRequest)
+		return
+	}
+
+	unit := r.URL.Query().Get("unit")
+	if unit == "" {
+		unit = "wei"
+	}
+
+	info, err := service.GetAddressInfo(r.Context(), address, start, end, page, pageSize, unit)
+	if errors.Is(err, service.ErrInvalidAddress) || errors.Is(err, service.ErrUnknownUnit) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error fetching address: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(info); err != nil {
+		http.Error(w, "Error encoding response: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// statusRecorder remembers the status code written by a handler. It keeps streaming working by forwarding
+// Flush and exposing the wrapped writer to http.ResponseController.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if r.status == 0 {
+		r.status = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// maxRequestIDLength bounds the X-Request-ID accepted from clients.
+const maxRequestIDLength = 64
+
+// requestID returns the X-Request-ID sent by the client, so requests can be traced across services, or a new
+// one when it is missing or not made of letters, digits, '-', '_' and '.'.
+func requestID(r *http.Request) string {
+	id := r.Header.Get("X-Request-ID")
+	if id == "" || len(id) > maxRequestIDLength {
+		return logging.NewRequestID()
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return logging.NewRequestID()
+		}
+	}
+	return id
+}
+
+// instrument assigns every request served by mux an ID, returned in the X-Request-ID header and carried by
+// the request context into the node calls it makes, and logs it once served. The latency and status code
+// are recorded labeled by the route pattern that matched rather than the path, so /tx/{hash} and
+// /address/{addr} stay a single series.
+func instrument(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, pattern := mux.Handler(r)
+		if pattern == "" {
+			pattern = "unmatched"
+		}
+
+		id := requestID(r)
+		w.Header().Set("X-Request-ID", id)
+		ctx := logging.WithRequestID(r.Context(), id)
+
+		recorder := &statusRecorder{ResponseWriter: w}
+		start := time.Now()
+		mux.ServeHTTP(recorder, r.WithContext(ctx))
+		elapsed := time.Since(start)
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+		httpDuration.Observe(elapsed.Seconds(), pattern)
+		httpRequests.Inc(pattern, strconv.Itoa(recorder.status))
+
+		level := slog.LevelInfo
+		if recorder.status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		slog.Log(ctx, level, "request", "method", r.Method, "path", r.URL.Path, "route", pattern,
+			"status", recorder.status, "duration", elapsed)
+	})
+}
+
+func MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := metrics.WriteText(w); err != nil {
+		http.Error(w, "Error writing metrics: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
 func Health(w http.ResponseWriter, r *http.Request) {
 	if _, err := fmt.Fprintf(w, "Hello, World!"); err != nil {
 		http.Error(w, "Error writing response: "+err.Error(), http.StatusInternalServerError)
 	}
 }
 
+// startFollower ingests new blocks as they are produced, feeding the watchlist and the event stream. It is
+// off unless enabled: with NODE_WS_URL set, blocks are ingested as soon as the node announces them through
+// a newHeads subscription, and with FOLLOW_INTERVAL set the node is polled at that interval, alone or as a
+// fallback to the subscription.
+func startFollower(ctx context.Context) {
+	service.OnNewBlock(service.PublishBlock)
+	service.OnNewBlock(service.CheckWatches)
+
+	wsURL := os.Getenv("NODE_WS_URL")
+	var followInterval time.Duration
+	if value := os.Getenv("FOLLOW_INTERVAL"); value != "" {
+		interval, err := time.ParseDuration(value)
+		if err != nil {
+			slog.Error("parsing FOLLOW_INTERVAL", "error", err)
+		} else {
+			followInterval = interval
+		}
+	}
+	if followInterval > 0 {
+		go service.Follow(ctx, followInterval)
+	}
+
+	if wsURL != "" {
+		heads := make(chan uint64, 16)
+		subscriber := &client.Subscriber{
+			URL: wsURL,
+			Subscriptions: []client.Subscription{client.NewHeads(func(head map[string]interface{}) {
+				number, _ := head["number"].(string)
+				n, err := strconv.ParseUint(strings.TrimPrefix(number, "0x"), 16, 64)
+				if err != nil {
+					return
+				}
+				select {
+				case heads <- n:
+				default: // a sync is running and will catch up with the queued heads
+				}
+			})},
+			// heads announced while disconnected were missed, backfill up to the current one
+			OnConnect: func() {
+				go func() {
+					if _, err := service.SyncNewBlocks(ctx); err != nil {
+						slog.ErrorContext(ctx, "backfilling new blocks", "error", err)
+					}
+				}()
+			},
+		}
+		go subscriber.Run(ctx)
+		go service.FollowHeads(ctx, heads)
+	}
+}
+
 func main() {
+	logLevel := os.Getenv("LOG_LEVEL")
+	if logLevel == "" {
+		logLevel = "info"
+	}
+	logFormat := os.Getenv("LOG_FORMAT")
+	if logFormat == "" {
+		logFormat = "text"
+	}
+	logger, err := logging.NewLogger(os.Stderr, logLevel, logFormat)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error configuring logging: %v\n", err)
+		os.Exit(1)
+	}
+	slog.SetDefault(logger)
+
 	service.SetClient(&client.EvmosClient{BaseURL: BaseURL})
 
+	if abiDir := os.Getenv("ABI_DIR"); abiDir != "" {
+		if err := service.LoadABIDir(abiDir); err != nil {
+			slog.Error("loading ABIs", "dir", abiDir, "error", err)
+		}
+	}
+	if signaturesFile := os.Getenv("SIGNATURES_FILE"); signaturesFile != "" {
+		if err := service.LoadSignatures(signaturesFile); err != nil {
+			slog.Error("loading signatures", "file", signaturesFile, "error", err)
+		}
+	}
+	if labelsFile := os.Getenv("LABELS_FILE"); labelsFile != "" {
+		if err := service.LoadLabels(labelsFile); err != nil {
+			slog.Error("loading labels", "file", labelsFile, "error", err)
+		}
+		if strings.EqualFold(filepath.Ext(labelsFile), ".json") {
+			service.SetLabelsFile(labelsFile)
+		}
+	}
+
+	// background work stops on SIGINT or SIGTERM, aborting the webhook deliveries in flight
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	service.StartDeliveries(ctx)
+	startFollower(ctx)
+
 	http.HandleFunc("/", Health)
+	http.HandleFunc("/metrics", MetricsHandler)
 
 	http.HandleFunc("/accounts", GetAccountsHandler)
 	http.HandleFunc("/balance", GetBalanceHandler)
+	http.HandleFunc("/balance/history", GetBalanceHistoryHandler)
 	http.HandleFunc("/blocknumber", GetBlockNumberHandler)
 	http.HandleFunc("/block", GetBlockHandler)
+	http.HandleFunc("/block/bytime", GetBlockByTimeHandler)
 	http.HandleFunc("/transactiontrace", GetTransactionTraceHandler)
+	http.HandleFunc("/tx/", GetTransactionHandler)
 
 	http.HandleFunc("/smartcontracts", GetSmartContractsHandler)
 	http.HandleFunc("/richestusers", GetRichestUsersHandler)
+	http.HandleFunc("/clusters", GetClustersHandler)
+
+	http.HandleFunc("/abis", ABIsHandler)
+	http.HandleFunc("/labels", LabelsHandler)
+	http.HandleFunc("/watchlist", WatchlistHandler)
+	http.HandleFunc("/watchlist/deliveries", GetDeliveriesHandler)
+	http.HandleFunc("/stream", StreamHandler)
+	http.HandleFunc("/events", GetEventsHandler)
+	http.HandleFunc("/gas", GetGasStatsHandler)
+	http.HandleFunc("/chainstats", GetChainStatsHandler)
+	http.HandleFunc("/failures", GetFailureStatsHandler)
+	http.HandleFunc("/flows", GetFlowsHandler)
+	http.HandleFunc("/activeaddresses", GetActiveAddressesHandler)
+	http.HandleFunc("/address/", GetAddressHandler)
 
 	server := &http.Server{
 		Addr:         ":8080",
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 10 * time.Second,
 		IdleTimeout:  15 * time.Second,
-		Handler:      nil, // Use the default http.DefaultServeMux
+		Handler:      instrument(http.DefaultServeMux),
 	}
 
-	fmt.Println("Server is running on port 8080")
-	if err := server.ListenAndServe(); err != nil {
-		fmt.Printf("Error starting server: %v\n", err)
+	// ListenAndServe returns as soon as Shutdown starts, so main waits for the requests in flight
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			slog.Error("shutting down server", "error", err)
+		}
+	}()
+
+	slog.Info("server is running", "addr", server.Addr)
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("starting server", "error", err)
+		return
 	}
+	<-stopped
 }
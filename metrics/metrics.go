@@ -0,0 +1,327 @@
+// Package metrics is a minimal Prometheus instrumentation library: counters, gauges and histograms with
+// labels, exposed in the Prometheus text format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are latency buckets in seconds, from 5ms to 10s.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type metric interface {
+	name() string
+	write(w io.Writer) error
+}
+
+var (
+	registryMu sync.Mutex
+	registry   = make(map[string]metric)
+)
+
+func register(m metric) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, exists := registry[m.name()]; exists {
+		panic("metrics: duplicate metric " + m.name())
+	}
+	registry[m.name()] = m
+}
+
+// WriteText writes every registered metric in the Prometheus text exposition format, sorted by name.
+func WriteText(w io.Writer) error {
+	registryMu.Lock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	metrics := make([]metric, 0, len(names))
+	sort.Strings(names)
+	for _, name := range names {
+		metrics = append(metrics, registry[name])
+	}
+	registryMu.Unlock()
+
+	for _, m := range metrics {
+		if err := m.write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// family holds the series of a metric, keyed by their label values.
+type family struct {
+	metricName string
+	help       string
+	kind       string
+	labels     []string
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+	// buckets, sum and count are only used by histograms. buckets are not cumulative.
+	buckets []uint64
+	sum     float64
+	count   uint64
+}
+
+func newFamily(name, help, kind string, labels []string) *family {
+	return &family{metricName: name, help: help, kind: kind, labels: labels, series: make(map[string]*series)}
+}
+
+func (f *family) name() string {
+	return f.metricName
+}
+
+// get returns the series for the label values, creating it on first use. f.mu must be held.
+func (f *family) get(labelValues []string) *series {
+	if len(labelValues) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", f.metricName, len(f.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, exists := f.series[key]
+	if !exists {
+		s = &series{labelValues: append([]string(nil), labelValues...)}
+		f.series[key] = s
+	}
+	return s
+}
+
+// sorted returns the series ordered by label values. f.mu must be held.
+func (f *family) sorted() []*series {
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	sorted := make([]*series, len(keys))
+	for i, key := range keys {
+		sorted[i] = f.series[key]
+	}
+	return sorted
+}
+
+func (f *family) writeHeader(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.metricName, escapeHelp(f.help), f.metricName, f.kind)
+	return err
+}
+
+// labelPairs renders label names and values as {a="1",b="2"}, with extra pairs appended.
+func (f *family) labelPairs(labelValues []string, extra ...string) string {
+	pairs := make([]string, 0, len(labelValues)+len(extra)/2)
+	for i, value := range labelValues {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, f.labels[i], escapeLabel(value)))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, extra[i], extra[i+1]))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func (f *family) writeValues(w io.Writer) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.writeHeader(w); err != nil {
+		return err
+	}
+	for _, s := range f.sorted() {
+		if _, err := fmt.Fprintf(w, "%s%s %s\n", f.metricName, f.labelPairs(s.labelValues), formatFloat(s.value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Counter is a monotonically increasing value per combination of label values.
+type Counter struct {
+	*family
+}
+
+// NewCounter registers a counter with the given label names.
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{newFamily(name, help, "counter", labels)}
+	register(c)
+	return c
+}
+
+// Inc adds one to the series of the label values.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds a non-negative value to the series of the label values.
+func (c *Counter) Add(value float64, labelValues ...string) {
+	if value < 0 {
+		panic("metrics: counters cannot decrease")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.get(labelValues).value += value
+}
+
+// Value returns the current value of the series of the label values.
+func (c *Counter) Value(labelValues ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.get(labelValues).value
+}
+
+func (c *Counter) write(w io.Writer) error {
+	return c.writeValues(w)
+}
+
+// Gauge is a value that can go up and down per combination of label values.
+type Gauge struct {
+	*family
+}
+
+// NewGauge registers a gauge with the given label names.
+func NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{newFamily(name, help, "gauge", labels)}
+	register(g)
+	return g
+}
+
+// Set sets the series of the label values.
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.get(labelValues).value = value
+}
+
+// Add adds a possibly negative value to the series of the label values.
+func (g *Gauge) Add(value float64, labelValues ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.get(labelValues).value += value
+}
+
+// Value returns the current value of the series of the label values.
+func (g *Gauge) Value(labelValues ...string) float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.get(labelValues).value
+}
+
+func (g *Gauge) write(w io.Writer) error {
+	return g.writeValues(w)
+}
+
+// GaugeFunc is an unlabeled gauge whose value is computed when it is scraped.
+type GaugeFunc struct {
+	*family
+	value func() float64
+}
+
+// NewGaugeFunc registers a gauge reporting the result of value.
+func NewGaugeFunc(name, help string, value func() float64) *GaugeFunc {
+	g := &GaugeFunc{family: newFamily(name, help, "gauge", nil), value: value}
+	register(g)
+	return g
+}
+
+func (g *GaugeFunc) write(w io.Writer) error {
+	if err := g.writeHeader(w); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%s %s\n", g.metricName, formatFloat(g.value()))
+	return err
+}
+
+// Histogram counts observations in buckets per combination of label values.
+type Histogram struct {
+	*family
+	bounds []float64
+}
+
+// NewHistogram registers a histogram with the given upper bounds, which must be sorted in increasing order.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{family: newFamily(name, help, "histogram", labels), bounds: buckets}
+	register(h)
+	return h
+}
+
+// Observe records a value in the series of the label values.
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.get(labelValues)
+	if s.buckets == nil {
+		s.buckets = make([]uint64, len(h.bounds))
+	}
+	for i, bound := range h.bounds {
+		if value <= bound {
+			s.buckets[i]++
+			break
+		}
+	}
+	s.sum += value
+	s.count++
+}
+
+// Count returns the number of observations of the series of the label values.
+func (h *Histogram) Count(labelValues ...string) uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.get(labelValues).count
+}
+
+func (h *Histogram) write(w io.Writer) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := h.writeHeader(w); err != nil {
+		return err
+	}
+	for _, s := range h.sorted() {
+		var cumulative uint64
+		for i, bound := range h.bounds {
+			if s.buckets != nil {
+				cumulative += s.buckets[i]
+			}
+			if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, h.labelPairs(s.labelValues, "le", formatFloat(bound)), cumulative); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n%s_sum%s %s\n%s_count%s %d\n",
+			h.metricName, h.labelPairs(s.labelValues, "le", "+Inf"), s.count,
+			h.metricName, h.labelPairs(s.labelValues), formatFloat(s.sum),
+			h.metricName, h.labelPairs(s.labelValues), s.count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func escapeHelp(help string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+}
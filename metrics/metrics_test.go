@@ -0,0 +1,50 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteText(t *testing.T) {
+	requests := NewCounter("test_requests_total", "Requests handled.", "method", "code")
+	inFlight := NewGauge("test_in_flight", "Requests in flight.")
+	NewGaugeFunc("test_height", "Current height.", func() float64 { return 42 })
+	latency := NewHistogram("test_latency_seconds", "Request latency.", []float64{0.1, 1}, "method")
+
+	requests.Inc("GET", "200")
+	requests.Add(2, "GET", "200")
+	requests.Inc(`say "hi"`, "500")
+	inFlight.Add(3)
+	inFlight.Add(-1)
+	latency.Observe(0.05, "GET")
+	latency.Observe(0.5, "GET")
+	latency.Observe(5, "GET")
+
+	assert.Equal(t, 3.0, requests.Value("GET", "200"))
+	assert.Equal(t, uint64(3), latency.Count("GET"))
+
+	var b bytes.Buffer
+	assert.NoError(t, WriteText(&b))
+	output := b.String()
+
+	assert.Contains(t, output, "# HELP test_requests_total Requests handled.\n# TYPE test_requests_total counter\n"+
+		"test_requests_total{method=\"GET\",code=\"200\"} 3\n"+
+		"test_requests_total{method=\"say \\\"hi\\\"\",code=\"500\"} 1\n")
+	assert.Contains(t, output, "# TYPE test_in_flight gauge\ntest_in_flight 2\n")
+	assert.Contains(t, output, "test_height 42\n")
+	assert.Contains(t, output, "# TYPE test_latency_seconds histogram\n"+
+		"test_latency_seconds_bucket{method=\"GET\",le=\"0.1\"} 1\n"+
+		"test_latency_seconds_bucket{method=\"GET\",le=\"1\"} 2\n"+
+		"test_latency_seconds_bucket{method=\"GET\",le=\"+Inf\"} 3\n"+
+		"test_latency_seconds_sum{method=\"GET\"} 5.55\n"+
+		"test_latency_seconds_count{method=\"GET\"} 3\n")
+
+	// metrics are written sorted by name
+	assert.Less(t, strings.Index(output, "test_height"), strings.Index(output, "test_in_flight"))
+
+	assert.Panics(t, func() { NewCounter("test_requests_total", "Duplicate.") })
+	assert.Panics(t, func() { requests.Inc("GET") })
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrUnknownInterval = errors.New("unknown interval")
+
+// activityIntervals maps the supported bucket sizes to their length in seconds.
+var activityIntervals = map[string]uint64{
+	"hour": 3600,
+	"day":  86400,
+}
+
+type ActiveAddressBucket struct {
+	Start      time.Time `json:"start"`
+	Blocks     int       `json:"blocks"`
+	Senders    int       `json:"senders"`
+	Recipients int       `json:"recipients"`
+	Active     int       `json:"active"`
+	New        int       `json:"new"`
+}
+
+// GetActiveAddresses buckets the blocks between startBlock and endBlock by timestamp into hourly or daily
+// intervals and counts the unique senders, EOA recipients and active addresses of each bucket.
+// An address is new in the bucket containing the first indexed block it appears in, so "new" is relative to
+// the history held by the local index.
+func GetActiveAddresses(ctx context.Context, startBlock, endBlock int, interval string) ([]ActiveAddressBucket, error) {
+	size, exists := activityIntervals[interval]
+	if !exists {
+		return nil, fmt.Errorf("%w %q, expected hour or day", ErrUnknownInterval, interval)
+	}
+
+	blocks, err := index.blocksInRange(ctx, startBlock, endBlock)
+	if err != nil {
+		return nil, err
+	}
+
+	type bucketSets struct {
+		blocks     int
+		firstBlock uint64
+		lastBlock  uint64
+		senders    map[string]struct{}
+		recipients map[string]struct{}
+		active     map[string]struct{}
+	}
+	buckets := make(map[uint64]*bucketSets)
+	var first, last uint64
+
+	for i, block := range blocks {
+		bucketStart := hexToUint64(block["timestamp"]) / size * size
+		if i == 0 || bucketStart < first {
+			first = bucketStart
+		}
+		if bucketStart > last {
+			last = bucketStart
+		}
+
+		number := hexToUint64(block["number"])
+		bucket, exists := buckets[bucketStart]
+		if !exists {
+			bucket = &bucketSets{
+				firstBlock: number,
+				senders:    make(map[string]struct{}),
+				recipients: make(map[string]struct{}),
+				active:     make(map[string]struct{}),
+			}
+			buckets[bucketStart] = bucket
+		}
+		bucket.blocks++
+		bucket.lastBlock = number
+
+		participants, err := index.participantsOf(ctx, block)
+		if err != nil {
+			return nil, err
+		}
+		for _, sender := range participants.senders {
+			bucket.senders[sender] = struct{}{}
+			bucket.active[sender] = struct{}{}
+		}
+		for _, recipient := range participants.recipients {
+			bucket.recipients[recipient] = struct{}{}
+			bucket.active[recipient] = struct{}{}
+		}
+	}
+
+	series := make([]ActiveAddressBucket, 0)
+	if len(blocks) == 0 {
+		return series, nil
+	}
+
+	// every bucket between the first and last is reported, so charts show quiet periods as zero
+	for bucketStart := first; bucketStart <= last; bucketStart += size {
+		entry := ActiveAddressBucket{Start: time.Unix(int64(bucketStart), 0).UTC()} // #nosec G115 -- block timestamps fit in int64
+		if bucket, exists := buckets[bucketStart]; exists {
+			entry.Blocks = bucket.blocks
+			entry.Senders = len(bucket.senders)
+			entry.Recipients = len(bucket.recipients)
+			entry.Active = len(bucket.active)
+			for address := range bucket.active {
+				// timestamps never decrease, so the blocks of a bucket form a contiguous run
+				if seen, exists := index.firstSeenBlock(address); exists && seen >= bucket.firstBlock && seen <= bucket.lastBlock {
+					entry.New++
+				}
+			}
+		}
+		series = append(series, entry)
+	}
+
+	return series, nil
+}
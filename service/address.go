@@ -0,0 +1,208 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"onchain-stats/bech32"
+	"strings"
+)
+
+var ErrInvalidAddress = errors.New("invalid address")
+
+const (
+	ActivityTransaction = "transaction"
+	// ActivityInternalTransfer is a nested call frame that moved native value.
+	ActivityInternalTransfer = "transfer"
+	ActivityInternalCall     = "internal"
+)
+
+type AddressActivity struct {
+	Kind        string `json:"kind"`
+	TxHash      string `json:"transactionHash"`
+	BlockNumber uint64 `json:"blockNumber"`
+	Type        string `json:"type,omitempty"`
+	From        string `json:"from"`
+	To          string `json:"to"`
+	// Value is the value moved, in the requested unit.
+	Value  string `json:"value"`
+	Failed bool   `json:"failed"`
+
+	value *big.Int
+}
+
+type AddressInfo struct {
+	Address string `json:"address"`
+	Bech32  string `json:"bech32"`
+	Label   *Label `json:"label,omitempty"`
+	// Balance is the current balance in the requested unit.
+	Balance          string `json:"balance"`
+	IsContract       bool   `json:"isContract"`
+	TransactionCount uint64 `json:"transactionCount"`
+	StartBlock       int    `json:"startBlock"`
+	EndBlock         int    `json:"endBlock"`
+	Page             int    `json:"page"`
+	PageSize         int    `json:"pageSize"`
+	TotalActivity    int    `json:"totalActivity"`
+	// InternalReceived and InternalSent total the value moved to and from the address by internal transfers
+	// between startBlock and endBlock, in the requested unit.
+	InternalReceived string            `json:"internalReceived"`
+	InternalSent     string            `json:"internalSent"`
+	Activity         []AddressActivity `json:"activity"`
+}
+
+// GetAddressInfo returns the current balance, contract status and nonce of an address, in hex or evmos1 form,
+// together with one page of the transactions and internal calls touching it between startBlock and endBlock,
+// newest first. Blocks and traces are read through the local index. Amounts are rendered in the given unit
+// (see FormatAmount).
+func GetAddressInfo(ctx context.Context, address string, startBlock, endBlock, page, pageSize int, unit string) (*AddressInfo, error) {
+	if _, err := FormatAmount(new(big.Int), unit); err != nil {
+		return nil, err
+	}
+	hexAddress, err := bech32.NormalizeAddress(address)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAddress, err)
+	}
+	bech32Address, err := bech32.FromHex(hexAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	balance, err := evmosClient.GetBalance(ctx, hexAddress, "latest")
+	if err != nil {
+		return nil, err
+	}
+	isContract, err := IsContractAddress(ctx, hexAddress)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := evmosClient.GetTransactionCount(ctx, hexAddress, "latest")
+	if err != nil {
+		return nil, err
+	}
+
+	activity, err := addressActivity(ctx, hexAddress, startBlock, endBlock)
+	if err != nil {
+		return nil, err
+	}
+
+	received, sent := new(big.Int), new(big.Int)
+	for i, entry := range activity {
+		// the unit was validated above
+		activity[i].Value, _ = FormatAmount(entry.value, unit)
+		if entry.Kind != ActivityInternalTransfer {
+			continue
+		}
+		if strings.EqualFold(entry.To, hexAddress) {
+			received.Add(received, entry.value)
+		}
+		if strings.EqualFold(entry.From, hexAddress) {
+			sent.Add(sent, entry.value)
+		}
+	}
+
+	info := &AddressInfo{
+		Address:          hexAddress,
+		Bech32:           bech32Address,
+		Label:            labelFor(hexAddress),
+		IsContract:       isContract,
+		TransactionCount: hexToUint64(nonce),
+		StartBlock:       startBlock,
+		EndBlock:         endBlock,
+		Page:             page,
+		PageSize:         pageSize,
+		TotalActivity:    len(activity),
+		Activity:         []AddressActivity{},
+	}
+	info.Balance, _ = FormatAmount(hexToBigInt(balance), unit)
+	info.InternalReceived, _ = FormatAmount(received, unit)
+	info.InternalSent, _ = FormatAmount(sent, unit)
+
+	from := (page - 1) * pageSize
+	if from < len(activity) {
+		to := from + pageSize
+		if to > len(activity) {
+			to = len(activity)
+		}
+		info.Activity = activity[from:to]
+	}
+
+	return info, nil
+}
+
+// addressActivity collects the transactions and internal call frames sent from or to address, newest first.
+// Internal frames that moved value are reported as transfers.
+func addressActivity(ctx context.Context, address string, startBlock, endBlock int) ([]AddressActivity, error) {
+	blocks, err := index.blocksInRange(ctx, startBlock, endBlock)
+	if err != nil {
+		return nil, err
+	}
+
+	touches := func(from, to interface{}) bool {
+		return strings.EqualFold(stringValue(from), address) || strings.EqualFold(stringValue(to), address)
+	}
+
+	var activity []AddressActivity
+	for i := len(blocks) - 1; i >= 0; i-- {
+		blockNumber := hexToUint64(blocks[i]["number"])
+		transactions, _ := blocks[i]["transactions"].([]interface{})
+
+		for j := len(transactions) - 1; j >= 0; j-- {
+			txMap := transactions[j].(map[string]interface{})
+			txHash := stringValue(txMap["hash"])
+
+			trace, err := index.trace(ctx, txHash)
+			if err != nil {
+				return nil, err
+			}
+
+			var internalCalls []AddressActivity
+			walkCallOutcomes(trace, func(call map[string]interface{}, reverted bool) {
+				if touches(call["from"], call["to"]) {
+					kind := ActivityInternalCall
+					if movesValue(call, reverted) {
+						kind = ActivityInternalTransfer
+					}
+					internalCalls = append(internalCalls, AddressActivity{
+						Kind:        kind,
+						TxHash:      txHash,
+						BlockNumber: blockNumber,
+						Type:        stringValue(call["type"]),
+						From:        stringValue(call["from"]),
+						To:          stringValue(call["to"]),
+						Failed:      frameFailed(call),
+						value:       hexToBigInt(call["value"]),
+					})
+				}
+			})
+			// internal calls happen after the transaction starts, so they come first in newest-first order
+			for k := len(internalCalls) - 1; k >= 0; k-- {
+				activity = append(activity, internalCalls[k])
+			}
+
+			if touches(txMap["from"], txMap["to"]) {
+				activity = append(activity, AddressActivity{
+					Kind:        ActivityTransaction,
+					TxHash:      txHash,
+					BlockNumber: blockNumber,
+					From:        stringValue(txMap["from"]),
+					To:          stringValue(txMap["to"]),
+					Failed:      frameFailed(trace),
+					value:       hexToBigInt(txMap["value"]),
+				})
+			}
+		}
+	}
+
+	return activity, nil
+}
+
+// toBech32 returns the evmos1 form of a hex address, or an empty string if it is not a valid address.
+func toBech32(address string) string {
+	bech32Address, err := bech32.FromHex(address)
+	if err != nil {
+		return ""
+	}
+	return bech32Address
+}
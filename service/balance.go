@@ -0,0 +1,226 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"onchain-stats/bech32"
+	"sync"
+	"time"
+)
+
+// maxBalancePoints bounds the number of samples a single balance history may contain.
+const maxBalancePoints = 1000
+
+var ErrTooManyPoints = errors.New("too many points")
+
+// maxCachedBalances bounds the number of balances kept by the cache. Once full, the balances cached first
+// are evicted.
+var maxCachedBalances = 100000
+
+// balanceCache keeps the balances fetched at fixed block numbers. Balances at a past block never change,
+// so entries are never invalidated, only evicted beyond maxCachedBalances; the client swap in SetClient
+// resets the cache.
+type balanceCache struct {
+	mu       sync.RWMutex
+	balances map[string]*big.Int
+	order    []string
+}
+
+var balances = newBalanceCache()
+
+func newBalanceCache() *balanceCache {
+	return &balanceCache{balances: make(map[string]*big.Int)}
+}
+
+func balanceKey(address string, block uint64) string {
+	return fmt.Sprintf("%s:%d", address, block)
+}
+
+// balancesAt returns the balance of address at each block, fetching the uncached ones in a single batch.
+func (c *balanceCache) balancesAt(ctx context.Context, address string, blocks []uint64) ([]*big.Int, error) {
+	result := make([]*big.Int, len(blocks))
+	var missing []int
+
+	c.mu.Lock()
+	for i, block := range blocks {
+		if balance, exists := c.balances[balanceKey(address, block)]; exists {
+			result[i] = balance
+			cacheHits.Inc(cacheBalance)
+			continue
+		}
+		missing = append(missing, i)
+		cacheMisses.Inc(cacheBalance)
+	}
+	c.mu.Unlock()
+
+	if len(missing) == 0 {
+		return result, nil
+	}
+
+	blockNumbers := make([]string, len(missing))
+	for i, position := range missing {
+		blockNumbers[i] = fmt.Sprintf("0x%x", blocks[position])
+	}
+	fetched, err := evmosClient.GetBalanceHistory(ctx, address, blockNumbers)
+	if err != nil {
+		return nil, err
+	}
+	if len(fetched) != len(missing) {
+		return nil, fmt.Errorf("expected %d balances, got %d", len(missing), len(fetched))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, position := range missing {
+		balance := hexToBigInt(fetched[i])
+		key := balanceKey(address, blocks[position])
+		if _, exists := c.balances[key]; !exists {
+			c.order = append(c.order, key)
+		}
+		c.balances[key] = balance
+		result[position] = balance
+	}
+	for len(c.order) > maxCachedBalances {
+		delete(c.balances, c.order[0])
+		c.order = c.order[1:]
+	}
+	return result, nil
+}
+
+// walletBalancesAt fetches the balances of wallets at each of the blocks through the cache, looking the
+// wallets up concurrently on the named worker pool. Balances are keyed by wallet, in the order of blocks.
+func walletBalancesAt(ctx context.Context, pool string, wallets []string, blocks []uint64) (map[string][]*big.Int, error) {
+	var mu sync.Mutex
+	result := make(map[string][]*big.Int, len(wallets))
+	err := newWorkerPool(pool, 8).forEach(wallets, func(wallet string) error {
+		walletBalances, err := balances.balancesAt(ctx, wallet, blocks)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		result[wallet] = walletBalances
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+type BalancePoint struct {
+	Block     uint64     `json:"block"`
+	Timestamp *time.Time `json:"timestamp,omitempty"`
+	Balance   Amount     `json:"balance"`
+	Delta     Amount     `json:"delta"`
+}
+
+type BalanceHistory struct {
+	Address    string         `json:"address"`
+	Bech32     string         `json:"bech32"`
+	StartBlock int            `json:"startBlock"`
+	EndBlock   int            `json:"endBlock"`
+	Points     []BalancePoint `json:"points"`
+}
+
+// GetBalanceHistory samples the balance of an address between startBlock and endBlock. With a non-zero
+// timeInterval the first block of every interval is sampled, each found by binary search over the block
+// timestamps so only about log2(range) blocks are fetched per sample; otherwise every blockInterval-th block
+// is. The end block is always included, and each point carries the change since the previous one.
+func GetBalanceHistory(ctx context.Context, address string, startBlock, endBlock, blockInterval int, timeInterval time.Duration) (*BalanceHistory, error) {
+	hexAddress, err := bech32.NormalizeAddress(address)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAddress, err)
+	}
+
+	var samples []uint64
+	timestamps := make(map[uint64]time.Time)
+	if timeInterval > 0 {
+		step := uint64(timeInterval / time.Second)
+		if step == 0 {
+			step = 1
+		}
+		// the number of samples is bounded from the timestamps of the ends of the range before searching for
+		// them: one per interval boundary crossed, plus the first and last blocks
+		first, err := index.timestamp(ctx, uint64(startBlock))
+		if err != nil {
+			return nil, err
+		}
+		last, err := index.timestamp(ctx, uint64(endBlock))
+		if err != nil {
+			return nil, err
+		}
+		if last >= first {
+			count := last/step - first/step + 2
+			if blocks := uint64(endBlock - startBlock + 1); count > blocks {
+				count = blocks
+			}
+			if count > maxBalancePoints {
+				return nil, fmt.Errorf("%w: up to %d samples exceed the limit of %d, use a larger interval", ErrTooManyPoints, count, maxBalancePoints)
+			}
+		}
+
+		number, timestamp := uint64(startBlock), first
+		for number <= uint64(endBlock) {
+			samples = append(samples, number)
+			timestamps[number] = time.Unix(int64(timestamp), 0).UTC() // #nosec G115 -- block timestamps fit in int64
+			number, err = firstBlockAtOrAfter(ctx, (timestamp/step+1)*step, number+1, uint64(endBlock))
+			if err != nil {
+				return nil, err
+			}
+			if number <= uint64(endBlock) {
+				if timestamp, err = index.timestamp(ctx, number); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if samples[len(samples)-1] != uint64(endBlock) {
+			samples = append(samples, uint64(endBlock))
+			timestamps[uint64(endBlock)] = time.Unix(int64(last), 0).UTC() // #nosec G115 -- block timestamps fit in int64
+		}
+	} else {
+		if blockInterval < 1 {
+			blockInterval = 1
+		}
+		if count := (endBlock-startBlock)/blockInterval + 2; count > maxBalancePoints+1 {
+			return nil, fmt.Errorf("%w: %d samples exceed the limit of %d, use a larger interval", ErrTooManyPoints, count-1, maxBalancePoints)
+		}
+		for block := startBlock; block <= endBlock; block += blockInterval {
+			samples = append(samples, uint64(block))
+		}
+		if samples[len(samples)-1] != uint64(endBlock) {
+			samples = append(samples, uint64(endBlock))
+		}
+	}
+	if len(samples) > maxBalancePoints {
+		return nil, fmt.Errorf("%w: %d samples exceed the limit of %d, use a larger interval", ErrTooManyPoints, len(samples), maxBalancePoints)
+	}
+
+	sampled, err := balances.balancesAt(ctx, hexAddress, samples)
+	if err != nil {
+		return nil, err
+	}
+
+	history := &BalanceHistory{
+		Address:    hexAddress,
+		Bech32:     toBech32(hexAddress),
+		StartBlock: startBlock,
+		EndBlock:   endBlock,
+		Points:     make([]BalancePoint, len(samples)),
+	}
+	for i, block := range samples {
+		delta := new(big.Int)
+		if i > 0 {
+			delta.Sub(sampled[i], sampled[i-1])
+		}
+		point := BalancePoint{Block: block, Balance: NewAmount(sampled[i]), Delta: NewAmount(delta)}
+		if timestamp, exists := timestamps[block]; exists {
+			point.Timestamp = &timestamp
+		}
+		history.Points[i] = point
+	}
+
+	return history, nil
+}
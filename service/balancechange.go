@@ -0,0 +1,153 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+)
+
+type BalanceChange struct {
+	Address      string `json:"address"`
+	Bech32       string `json:"bech32,omitempty"`
+	Label        *Label `json:"label,omitempty"`
+	StartBalance Amount `json:"startBalance"`
+	EndBalance   Amount `json:"endBalance"`
+	Change       Amount `json:"change"`
+	// ChangePercent is nil for wallets that held nothing at the start block.
+	ChangePercent *float64 `json:"changePercent"`
+
+	change *big.Int
+}
+
+type BalanceChanges struct {
+	StartBlock int             `json:"startBlock"`
+	EndBlock   int             `json:"endBlock"`
+	Wallets    int             `json:"wallets"`
+	Gainers    []BalanceChange `json:"gainers"`
+	Losers     []BalanceChange `json:"losers"`
+}
+
+// balanceChangeSortFields compares the magnitude of two changes in the same direction, returning a
+// positive number when a ranks above b.
+var balanceChangeSortFields = map[string]func(a, b *BalanceChange) int{
+	"absolute": func(a, b *BalanceChange) int {
+		return new(big.Int).Abs(a.change).Cmp(new(big.Int).Abs(b.change))
+	},
+	"percent": func(a, b *BalanceChange) int {
+		// wallets without a start balance have no percentage and rank last
+		switch {
+		case a.ChangePercent == nil && b.ChangePercent == nil:
+			return 0
+		case a.ChangePercent == nil:
+			return -1
+		case b.ChangePercent == nil:
+			return 1
+		}
+		pa, pb := *a.ChangePercent, *b.ChangePercent
+		if pa < 0 {
+			pa, pb = -pa, -pb
+		}
+		switch {
+		case pa > pb:
+			return 1
+		case pa < pb:
+			return -1
+		}
+		return 0
+	},
+}
+
+// GetBalanceChanges compares the balances at startBlock and endBlock of every wallet active in between and
+// returns up to limit of the biggest gainers and losers, ranked by absolute or percent change.
+// Wallets whose balance did not change are only counted, and wallets labeled with one of the excluded
+// categories are left out.
+func GetBalanceChanges(ctx context.Context, startBlock, endBlock int, sortBy string, limit int, exclude []string) (*BalanceChanges, error) {
+	compare, exists := balanceChangeSortFields[sortBy]
+	if !exists {
+		return nil, fmt.Errorf("%w %q, expected absolute or percent", ErrUnknownSortField, sortBy)
+	}
+
+	blocks, err := index.blocksInRange(ctx, startBlock, endBlock)
+	if err != nil {
+		return nil, err
+	}
+	active := make(map[string]struct{})
+	for _, block := range blocks {
+		participants, err := index.participantsOf(ctx, block)
+		if err != nil {
+			return nil, err
+		}
+		for _, addresses := range [][]string{participants.senders, participants.recipients} {
+			for _, address := range addresses {
+				active[address] = struct{}{}
+			}
+		}
+	}
+	wallets := make([]string, 0, len(active))
+	for wallet := range active {
+		if hasCategory(wallet, exclude) {
+			continue
+		}
+		wallets = append(wallets, wallet)
+	}
+
+	sampled, err := walletBalancesAt(ctx, "balanceChanges", wallets, []uint64{uint64(startBlock), uint64(endBlock)})
+	if err != nil {
+		return nil, err
+	}
+	changes := make([]BalanceChange, 0, len(sampled))
+	for wallet, walletBalances := range sampled {
+		changes = append(changes, newBalanceChange(wallet, walletBalances[0], walletBalances[1]))
+	}
+
+	result := &BalanceChanges{
+		StartBlock: startBlock,
+		EndBlock:   endBlock,
+		Wallets:    len(wallets),
+		Gainers:    []BalanceChange{},
+		Losers:     []BalanceChange{},
+	}
+	for _, change := range changes {
+		switch change.change.Sign() {
+		case 1:
+			result.Gainers = append(result.Gainers, change)
+		case -1:
+			result.Losers = append(result.Losers, change)
+		}
+	}
+
+	for _, ranked := range []*[]BalanceChange{&result.Gainers, &result.Losers} {
+		list := *ranked
+		sort.Slice(list, func(i, j int) bool {
+			if cmp := compare(&list[i], &list[j]); cmp != 0 {
+				return cmp > 0
+			}
+			return list[i].Address < list[j].Address
+		})
+		if len(list) > limit {
+			*ranked = list[:limit]
+		}
+	}
+
+	return result, nil
+}
+
+func newBalanceChange(address string, startBalance, endBalance *big.Int) BalanceChange {
+	difference := new(big.Int).Sub(endBalance, startBalance)
+	change := BalanceChange{
+		Address:      address,
+		Bech32:       toBech32(address),
+		Label:        labelFor(address),
+		StartBalance: NewAmount(startBalance),
+		EndBalance:   NewAmount(endBalance),
+		Change:       NewAmount(difference),
+		change:       difference,
+	}
+	if startBalance.Sign() > 0 {
+		percent, _ := new(big.Float).Quo(new(big.Float).SetInt(difference), new(big.Float).SetInt(startBalance)).Float64()
+		percent *= 100
+		change.ChangePercent = &percent
+	}
+	return change
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrNoBlockAtTime = errors.New("no block at or after time")
+
+type BlockTime struct {
+	Number    uint64    `json:"number"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// GetBlockByTime returns the first block produced at or after t. Since block timestamps never decrease,
+// it binary searches the chain between the earliest block the node serves and the latest block, fetching
+// about log2(height) blocks. On pruned nodes, times before the earliest block resolve to it.
+func GetBlockByTime(ctx context.Context, t time.Time) (*BlockTime, error) {
+	number, found, err := searchBlockByTime(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("%w %s, the latest block is older", ErrNoBlockAtTime, t.UTC().Format(time.RFC3339))
+	}
+
+	timestamp, err := index.timestamp(ctx, number)
+	if err != nil {
+		return nil, err
+	}
+	return &BlockTime{Number: number, Timestamp: time.Unix(int64(timestamp), 0).UTC()}, nil // #nosec G115 -- block timestamps fit in int64
+}
+
+// BlockRangeForTimes converts a time range into the inclusive range of blocks produced within it. A zero
+// from or to leaves the corresponding default block in place.
+func BlockRangeForTimes(ctx context.Context, from, to time.Time, defaultStart, defaultEnd int) (int, int, error) {
+	start, end := defaultStart, defaultEnd
+	if !from.IsZero() {
+		block, err := GetBlockByTime(ctx, from)
+		if err != nil {
+			return 0, 0, err
+		}
+		start = int(block.Number) // #nosec G115 -- block numbers fit in int
+	}
+	if !to.IsZero() {
+		// the last block at or before to precedes the first block after it
+		number, found, err := searchBlockByTime(ctx, to.Add(time.Second))
+		if err != nil {
+			return 0, 0, err
+		}
+		if !found {
+			latest, err := latestBlockNumber(ctx)
+			if err != nil {
+				return 0, 0, err
+			}
+			number = latest + 1
+		}
+		// the search already found the earliest block, so this is answered from the index
+		earliest, err := index.earliestBlock(ctx, number-1)
+		if err != nil {
+			return 0, 0, err
+		}
+		if number <= earliest {
+			return 0, 0, fmt.Errorf("%w: no block at or before %s", ErrNoBlockAtTime, to.UTC().Format(time.RFC3339))
+		}
+		end = int(number - 1) // #nosec G115 -- block numbers fit in int
+	}
+	if start > end {
+		return 0, 0, fmt.Errorf("%w: no blocks between %s and %s", ErrNoBlockAtTime, from.UTC().Format(time.RFC3339), to.UTC().Format(time.RFC3339))
+	}
+
+	return start, end, nil
+}
+
+// searchBlockByTime returns the first available block whose timestamp is at or after t, or false when the
+// latest block is older than t.
+func searchBlockByTime(ctx context.Context, t time.Time) (uint64, bool, error) {
+	latest, err := latestBlockNumber(ctx)
+	if err != nil {
+		return 0, false, err
+	}
+	earliest, err := index.earliestBlock(ctx, latest)
+	if err != nil {
+		return 0, false, err
+	}
+	target := uint64(0)
+	if t.Unix() > 0 {
+		target = uint64(t.Unix())
+	}
+
+	number, err := firstBlockAtOrAfter(ctx, target, earliest, latest)
+	if err != nil {
+		return 0, false, err
+	}
+	return number, number <= latest, nil
+}
+
+// firstBlockAtOrAfter binary searches the blocks from low to high for the first one whose timestamp is at or
+// after target, returning high+1 when there is none.
+func firstBlockAtOrAfter(ctx context.Context, target, low, high uint64) (uint64, error) {
+	high++
+	for low < high {
+		middle := low + (high-low)/2
+		timestamp, err := index.timestamp(ctx, middle)
+		if err != nil {
+			return 0, err
+		}
+		if timestamp >= target {
+			high = middle
+		} else {
+			low = middle + 1
+		}
+	}
+	return low, nil
+}
+
+func latestBlockNumber(ctx context.Context) (uint64, error) {
+	latest, err := evmosClient.GetBlockNumber(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return hexToUint64(latest), nil
+}
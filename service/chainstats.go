@@ -0,0 +1,129 @@
+package service
+
+import (
+	"context"
+	"sort"
+)
+
+// gapFactor is how many times the median block time a block must take to be reported as a gap.
+const gapFactor = 3
+
+type BlockTimeStats struct {
+	Mean float64 `json:"mean"`
+	Min  uint64  `json:"min"`
+	Max  uint64  `json:"max"`
+	P50  uint64  `json:"p50"`
+	P90  uint64  `json:"p90"`
+	P99  uint64  `json:"p99"`
+}
+
+// BlockGap is a block that took unusually long to be produced after its parent.
+type BlockGap struct {
+	Block   uint64 `json:"block"`
+	Seconds uint64 `json:"seconds"`
+}
+
+type ChainStats struct {
+	StartBlock         int            `json:"startBlock"`
+	EndBlock           int            `json:"endBlock"`
+	Blocks             int            `json:"blocks"`
+	Transactions       int            `json:"transactions"`
+	TxPerBlock         float64        `json:"txPerBlock"`
+	MaxTxPerBlock      int            `json:"maxTxPerBlock"`
+	TPS                float64        `json:"tps"`
+	BlockTime          BlockTimeStats `json:"blockTime"`
+	EmptyBlocks        int            `json:"emptyBlocks"`
+	EmptyBlockRatio    float64        `json:"emptyBlockRatio"`
+	LongestEmptyStreak int            `json:"longestEmptyStreak"`
+	Gaps               []BlockGap     `json:"gaps"`
+}
+
+// GetChainStats computes throughput and block time statistics between startBlock and endBlock.
+func GetChainStats(ctx context.Context, startBlock, endBlock int) (*ChainStats, error) {
+	blocks, err := evmosClient.GetBlocksInRange(ctx, startBlock, endBlock)
+	if err != nil {
+		return nil, err
+	}
+
+	return CalculateChainStats(startBlock, endBlock, blocks), nil
+}
+
+// CalculateChainStats derives throughput and block time statistics from consecutive blocks.
+// TPS counts the transactions of every block after the first, since the first block's transactions
+// were produced before the measured interval starts.
+func CalculateChainStats(startBlock, endBlock int, blocks []map[string]interface{}) *ChainStats {
+	stats := &ChainStats{StartBlock: startBlock, EndBlock: endBlock, Blocks: len(blocks), Gaps: []BlockGap{}}
+	if len(blocks) == 0 {
+		return stats
+	}
+
+	var (
+		blockTimes      []uint64
+		intervalTxs     int
+		emptyStreak     int
+		totalBlockTime  uint64
+		previousTime    uint64
+		blockTimeBlocks []uint64
+	)
+	for i, block := range blocks {
+		transactions, _ := block["transactions"].([]interface{})
+		txCount := len(transactions)
+		stats.Transactions += txCount
+		if txCount > stats.MaxTxPerBlock {
+			stats.MaxTxPerBlock = txCount
+		}
+
+		if txCount == 0 {
+			stats.EmptyBlocks++
+			emptyStreak++
+			if emptyStreak > stats.LongestEmptyStreak {
+				stats.LongestEmptyStreak = emptyStreak
+			}
+		} else {
+			emptyStreak = 0
+		}
+
+		timestamp := hexToUint64(block["timestamp"])
+		if i > 0 {
+			intervalTxs += txCount
+			var blockTime uint64
+			if timestamp > previousTime {
+				blockTime = timestamp - previousTime
+			}
+			blockTimes = append(blockTimes, blockTime)
+			blockTimeBlocks = append(blockTimeBlocks, hexToUint64(block["number"]))
+			totalBlockTime += blockTime
+		}
+		previousTime = timestamp
+	}
+
+	stats.TxPerBlock = float64(stats.Transactions) / float64(len(blocks))
+	stats.EmptyBlockRatio = float64(stats.EmptyBlocks) / float64(len(blocks))
+	if totalBlockTime > 0 {
+		stats.TPS = float64(intervalTxs) / float64(totalBlockTime)
+	}
+
+	if len(blockTimes) == 0 {
+		return stats
+	}
+
+	sorted := append([]uint64(nil), blockTimes...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	stats.BlockTime = BlockTimeStats{
+		Mean: float64(totalBlockTime) / float64(len(blockTimes)),
+		Min:  sorted[0],
+		Max:  sorted[len(sorted)-1],
+		P50:  sorted[percentileIndex(len(sorted), 50)],
+		P90:  sorted[percentileIndex(len(sorted), 90)],
+		P99:  sorted[percentileIndex(len(sorted), 99)],
+	}
+
+	threshold := stats.BlockTime.P50 * gapFactor
+	for i, blockTime := range blockTimes {
+		if threshold > 0 && blockTime > threshold {
+			stats.Gaps = append(stats.Gaps, BlockGap{Block: blockTimeBlocks[i], Seconds: blockTime})
+		}
+	}
+
+	return stats
+}
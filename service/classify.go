@@ -0,0 +1,287 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"onchain-stats/abi"
+	"strings"
+	"sync"
+)
+
+const (
+	ContractTypeERC20    = "erc20"
+	ContractTypeERC721   = "erc721"
+	ContractTypeERC1155  = "erc1155"
+	ContractTypeProxy    = "proxy"
+	ContractTypeContract = "contract"
+	ContractTypeEOA      = "eoa"
+)
+
+const (
+	// eip1967ImplementationSlot is keccak256("eip1967.proxy.implementation") - 1.
+	eip1967ImplementationSlot = "0x360894a13ba1a3210667c828492db98dca3e2076cc3735a920a3ca505d382bbc"
+	// eip1967BeaconSlot is keccak256("eip1967.proxy.beacon") - 1.
+	eip1967BeaconSlot = "0xa3f0ad74e5423aebfd80d3ef4346578335a9a72aeaee59ff6cb3582b35133d50"
+)
+
+var (
+	// eip1167Prefix and eip1167Suffix surround the implementation address in the minimal proxy runtime code.
+	eip1167Prefix = []byte{0x36, 0x3d, 0x3d, 0x37, 0x3d, 0x3d, 0x3d, 0x36, 0x3d, 0x73}
+	eip1167Suffix = []byte{0x5a, 0xf4, 0x3d, 0x82, 0x80, 0x3e, 0x90, 0x3d, 0x91, 0x60, 0x2b, 0x57, 0xfd, 0x5b, 0xf3}
+
+	supportsInterface    = abi.MustParseMethod("supportsInterface(bytes4)(bool)")
+	beaconImplementation = abi.MustParseMethod("implementation()(address)")
+
+	erc165InterfaceID  = []byte{0x01, 0xff, 0xc9, 0xa7}
+	invalidInterfaceID = []byte{0xff, 0xff, 0xff, 0xff}
+	erc721InterfaceID  = []byte{0x80, 0xac, 0x58, 0xcd}
+	erc1155InterfaceID = []byte{0xd9, 0xb6, 0x7a, 0x26}
+
+	// standardSelectors lists the functions whose presence in the bytecode identifies a standard.
+	// Standards are checked in order, so the more specific ones come first.
+	standardSelectors = []struct {
+		Type       string
+		Signatures []string
+	}{
+		{ContractTypeERC1155, []string{
+			"safeTransferFrom(address,address,uint256,uint256,bytes)",
+			"safeBatchTransferFrom(address,address,uint256[],uint256[],bytes)",
+			"balanceOfBatch(address[],uint256[])",
+			"setApprovalForAll(address,bool)",
+		}},
+		{ContractTypeERC721, []string{
+			"ownerOf(uint256)",
+			"safeTransferFrom(address,address,uint256)",
+			"getApproved(uint256)",
+			"setApprovalForAll(address,bool)",
+		}},
+		{ContractTypeERC20, []string{
+			"totalSupply()",
+			"balanceOf(address)",
+			"transfer(address,uint256)",
+			"transferFrom(address,address,uint256)",
+			"approve(address,uint256)",
+			"allowance(address,address)",
+		}},
+	}
+)
+
+type ContractInfo struct {
+	Type               string `json:"type"`
+	Implementation     string `json:"implementation,omitempty"`
+	ImplementationType string `json:"implementationType,omitempty"`
+}
+
+// maxCachedClassifications bounds the number of classifications kept by the cache. Once full, the
+// classifications cached first are evicted.
+var maxCachedClassifications = 10000
+
+// classificationCache keeps the classifications of contracts at fixed block numbers, which never change.
+// Classifications at a block tag such as "latest" are not cached.
+type classificationCache struct {
+	mu      sync.Mutex
+	entries map[string]ContractInfo
+	order   []string
+}
+
+var classifications = newClassificationCache()
+
+func newClassificationCache() *classificationCache {
+	return &classificationCache{entries: make(map[string]ContractInfo)}
+}
+
+func (c *classificationCache) get(key string) (ContractInfo, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	info, exists := c.entries[key]
+	return info, exists
+}
+
+func (c *classificationCache) add(key string, info ContractInfo) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, exists := c.entries[key]; !exists {
+		c.order = append(c.order, key)
+	}
+	c.entries[key] = info
+	for len(c.order) > maxCachedClassifications {
+		delete(c.entries, c.order[0])
+		c.order = c.order[1:]
+	}
+}
+
+// ClassifyContract detects the token standard of the contract at address, or whether it is a proxy.
+// Proxies are recognized by the EIP-1167 minimal proxy bytecode or a non-empty EIP-1967 implementation
+// or beacon slot; their implementation is classified as well. Other contracts are classified through
+// ERC-165 supportsInterface and, failing that, by scanning the bytecode for the selectors of each standard.
+// Classifications at a block number are cached.
+func ClassifyContract(ctx context.Context, address, blockNumber string) (ContractInfo, error) {
+	if !strings.HasPrefix(blockNumber, "0x") {
+		return classifyContract(ctx, address, blockNumber)
+	}
+	key := strings.ToLower(address) + ":" + blockNumber
+	if info, exists := classifications.get(key); exists {
+		return info, nil
+	}
+	info, err := classifyContract(ctx, address, blockNumber)
+	if err != nil {
+		return ContractInfo{}, err
+	}
+	classifications.add(key, info)
+	return info, nil
+}
+
+func classifyContract(ctx context.Context, address, blockNumber string) (ContractInfo, error) {
+	code, err := getCode(ctx, address, blockNumber)
+	if err != nil {
+		return ContractInfo{}, err
+	}
+	if len(code) == 0 {
+		return ContractInfo{Type: ContractTypeEOA}, nil
+	}
+
+	implementation, proxy, err := proxyImplementation(ctx, address, code, blockNumber)
+	if err != nil {
+		return ContractInfo{}, err
+	}
+	if proxy {
+		info := ContractInfo{Type: ContractTypeProxy, Implementation: implementation}
+		if implementation == "" {
+			return info, nil
+		}
+		implementationCode, err := getCode(ctx, implementation, blockNumber)
+		if err != nil {
+			return ContractInfo{}, err
+		}
+		if len(implementationCode) > 0 {
+			info.ImplementationType = classifyCode(ctx, implementation, implementationCode, blockNumber)
+		}
+		return info, nil
+	}
+
+	return ContractInfo{Type: classifyCode(ctx, address, code, blockNumber)}, nil
+}
+
+func getCode(ctx context.Context, address, blockNumber string) ([]byte, error) {
+	code, err := evmosClient.GetCode(ctx, address, blockNumber)
+	if err != nil {
+		return nil, err
+	}
+	return abi.FromHex(code)
+}
+
+func classifyCode(ctx context.Context, address string, code []byte, blockNumber string) string {
+	if supportsERC165(ctx, address, blockNumber) {
+		if supportsInterfaceID(ctx, address, blockNumber, erc1155InterfaceID) {
+			return ContractTypeERC1155
+		}
+		if supportsInterfaceID(ctx, address, blockNumber, erc721InterfaceID) {
+			return ContractTypeERC721
+		}
+	}
+
+	selectors := codeSelectors(code)
+	for _, standard := range standardSelectors {
+		matches := true
+		for _, signature := range standard.Signatures {
+			if _, exists := selectors[string(abi.Selector(signature))]; !exists {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return standard.Type
+		}
+	}
+
+	return ContractTypeContract
+}
+
+// supportsERC165 follows the detection procedure of ERC-165, which requires the contract to
+// acknowledge the ERC-165 interface itself and to reject the invalid 0xffffffff interface.
+func supportsERC165(ctx context.Context, address, blockNumber string) bool {
+	return supportsInterfaceID(ctx, address, blockNumber, erc165InterfaceID) &&
+		!supportsInterfaceID(ctx, address, blockNumber, invalidInterfaceID)
+}
+
+// supportsInterfaceID treats reverts and malformed return data as the interface not being supported.
+func supportsInterfaceID(ctx context.Context, address, blockNumber string, interfaceID []byte) bool {
+	result, err := CallContract(ctx, address, blockNumber, supportsInterface, interfaceID)
+	if err != nil {
+		return false
+	}
+	supported, _ := result[0].(bool)
+	return supported
+}
+
+// proxyImplementation returns the implementation address of an EIP-1167 or EIP-1967 proxy and whether
+// the contract is a recognized proxy. The implementation is empty for a beacon proxy whose beacon cannot
+// be read.
+func proxyImplementation(ctx context.Context, address string, code []byte, blockNumber string) (string, bool, error) {
+	if len(code) == len(eip1167Prefix)+20+len(eip1167Suffix) &&
+		bytes.HasPrefix(code, eip1167Prefix) && bytes.HasSuffix(code, eip1167Suffix) {
+		return abi.ToHex(code[len(eip1167Prefix) : len(eip1167Prefix)+20]), true, nil
+	}
+
+	implementation, err := storageAddress(ctx, address, eip1967ImplementationSlot, blockNumber)
+	if err != nil || implementation != "" {
+		return implementation, implementation != "", err
+	}
+
+	beacon, err := storageAddress(ctx, address, eip1967BeaconSlot, blockNumber)
+	if err != nil || beacon == "" {
+		return "", false, err
+	}
+	result, err := CallContract(ctx, beacon, blockNumber, beaconImplementation)
+	if err != nil {
+		// the beacon is set but unreadable, the contract is still a proxy of an unknown implementation
+		return "", true, nil
+	}
+	return result[0].(string), true, nil
+}
+
+// storageAddress reads an address stored in the low 20 bytes of a storage slot, returning "" for an empty slot.
+func storageAddress(ctx context.Context, address, slot, blockNumber string) (string, error) {
+	value, err := evmosClient.GetStorageAt(ctx, address, slot, blockNumber)
+	if err != nil {
+		return "", err
+	}
+
+	word, err := abi.FromHex(value)
+	if err != nil {
+		return "", err
+	}
+	if len(bytes.Trim(word, "\x00")) == 0 {
+		return "", nil
+	}
+	if len(word) < 20 {
+		word = append(make([]byte, 20-len(word)), word...)
+	}
+	return strings.ToLower(abi.ToHex(word[len(word)-20:])), nil
+}
+
+// codeSelectors collects the operands of all PUSH4 instructions in the bytecode, which is how the
+// Solidity dispatcher embeds function selectors. Push data of other instructions is skipped so it
+// is not mistaken for opcodes.
+func codeSelectors(code []byte) map[string]struct{} {
+	const (
+		push1  = 0x60
+		push4  = 0x63
+		push32 = 0x7f
+	)
+
+	selectors := make(map[string]struct{})
+	for pc := 0; pc < len(code); pc++ {
+		op := code[pc]
+		if op < push1 || op > push32 {
+			continue
+		}
+		size := int(op-push1) + 1
+		// the operand may end with the code, but a truncated one is not a selector
+		if op == push4 && pc+1+size <= len(code) {
+			selectors[string(code[pc+1:pc+1+size])] = struct{}{}
+		}
+		pc += size
+	}
+	return selectors
+}
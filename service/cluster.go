@@ -0,0 +1,393 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+// Heuristics reported in Cluster.Heuristics.
+const (
+	HeuristicFunding      = "funding"
+	HeuristicDeposit      = "deposit"
+	HeuristicSynchronized = "synchronized"
+)
+
+const (
+	// maxFundingFanout is the number of new addresses a funder may fund before it is treated as an exchange
+	// or faucet, whose recipients are unrelated.
+	maxFundingFanout = 20
+	// minHubDeposits is the number of deposit addresses that must forward to the same hub before their
+	// senders are clustered.
+	minHubDeposits = 2
+	// maxSyncSenders skips busy blocks, where senders share a block by chance, from synchronized activity.
+	maxSyncSenders = 20
+	// minSyncBlocks and syncRatio are the number of blocks two senders must share, and the share of their
+	// active blocks this must make up, to be clustered as synchronized.
+	minSyncBlocks = 3
+	syncRatio     = 0.8
+)
+
+type Cluster struct {
+	ID         string   `json:"id"`
+	Size       int      `json:"size"`
+	Addresses  []string `json:"addresses"`
+	Heuristics []string `json:"heuristics"`
+}
+
+// Clustering maps the EOAs active in a block range to clusters of addresses likely controlled by the same
+// entity. Addresses that were not clustered with any other address are not part of any cluster.
+type Clustering struct {
+	StartBlock int       `json:"startBlock"`
+	EndBlock   int       `json:"endBlock"`
+	Clusters   []Cluster `json:"clusters"`
+
+	clusterOf map[string]string
+}
+
+// ClusterOf returns the ID of the cluster containing address, or "" when it was not clustered.
+func (c *Clustering) ClusterOf(address string) string {
+	return c.clusterOf[strings.ToLower(address)]
+}
+
+// GetClusters groups the EOAs active between startBlock and endBlock with three heuristics:
+//   - funding: new addresses whose first EVMOS came from the same EOA are clustered with it;
+//   - deposit: EOAs forwarding everything they receive to a single hub are deposit addresses, and the
+//     senders paying into the same deposit address are clustered;
+//   - synchronized: senders repeatedly transacting in the same blocks are clustered.
+//
+// A cluster ID is the lowest address of the cluster.
+func GetClusters(ctx context.Context, startBlock, endBlock int) (*Clustering, error) {
+	blocks, err := index.blocksInRange(ctx, startBlock, endBlock)
+	if err != nil {
+		return nil, err
+	}
+	transfers, err := valueTransfers(ctx, blocks)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]struct{})
+	var addresses []string
+	for _, transfer := range transfers {
+		for _, address := range []string{strings.ToLower(transfer.From), strings.ToLower(transfer.To)} {
+			if _, exists := seen[address]; !exists {
+				seen[address] = struct{}{}
+				addresses = append(addresses, address)
+			}
+		}
+	}
+	contracts, err := lookupContracts(ctx, addresses)
+	if err != nil {
+		return nil, err
+	}
+	isEOA := func(address string) bool {
+		isContract, known := contracts[address]
+		return known && !isContract
+	}
+
+	clusters := newUnionFind()
+	blockSenders := make([][]string, 0, len(blocks))
+	for _, block := range blocks {
+		participants, err := index.participantsOf(ctx, block)
+		if err != nil {
+			return nil, err
+		}
+		blockSenders = append(blockSenders, participants.senders)
+	}
+
+	exchange := clusterDeposits(clusters, transfers, isEOA)
+	if err := clusterFunding(ctx, clusters, transfers, isEOA, exchange); err != nil {
+		return nil, err
+	}
+	clusterSynchronized(clusters, blockSenders)
+
+	return clusters.clustering(startBlock, endBlock), nil
+}
+
+// clusterFunding clusters addresses first funded within the range with their funder. Deposit addresses and
+// hubs belong to an exchange rather than its users and are skipped.
+func clusterFunding(ctx context.Context, clusters *unionFind, transfers []InternalTransfer, isEOA func(string) bool, exchange map[string]struct{}) error {
+	funded := make(map[string]bool)
+	fundedBy := make(map[string][]string)
+	for _, transfer := range transfers {
+		from, to := strings.ToLower(transfer.From), strings.ToLower(transfer.To)
+		if funded[to] {
+			continue
+		}
+		funded[to] = true
+
+		_, fromExchange := exchange[from]
+		_, toExchange := exchange[to]
+		if from == to || fromExchange || toExchange || !isEOA(from) || !isEOA(to) {
+			continue
+		}
+		// only addresses funded for the first time are new, others may have been funded before the range
+		isNew, err := isNewAddress(ctx, to, transfer.BlockNumber)
+		if err != nil {
+			return err
+		}
+		if isNew {
+			fundedBy[from] = append(fundedBy[from], to)
+		}
+	}
+
+	for funder, addresses := range fundedBy {
+		if len(addresses) > maxFundingFanout {
+			continue
+		}
+		for _, address := range addresses {
+			clusters.union(funder, address, HeuristicFunding)
+		}
+	}
+	return nil
+}
+
+// isNewAddress reports whether an address had neither a balance nor sent a transaction before block, so
+// the transfers it receives in block are its first funding.
+func isNewAddress(ctx context.Context, address string, block uint64) (bool, error) {
+	if block == 0 {
+		return true, nil
+	}
+	before, err := balances.balancesAt(ctx, address, []uint64{block - 1})
+	if err != nil {
+		return false, err
+	}
+	if before[0].Sign() != 0 {
+		return false, nil
+	}
+	nonce, err := evmosClient.GetTransactionCount(ctx, address, fmt.Sprintf("0x%x", block-1))
+	if err != nil {
+		return false, err
+	}
+	return hexToUint64(nonce) == 0, nil
+}
+
+// clusterDeposits clusters the senders of deposit addresses, which forward all they receive to one hub.
+// It returns the deposit addresses and hubs found.
+func clusterDeposits(clusters *unionFind, transfers []InternalTransfer, isEOA func(string) bool) map[string]struct{} {
+	senders := make(map[string]map[string]struct{})
+	destinations := make(map[string]map[string]struct{})
+	add := func(sets map[string]map[string]struct{}, key, value string) {
+		if sets[key] == nil {
+			sets[key] = make(map[string]struct{})
+		}
+		sets[key][value] = struct{}{}
+	}
+	for _, transfer := range transfers {
+		from, to := strings.ToLower(transfer.From), strings.ToLower(transfer.To)
+		add(senders, to, from)
+		add(destinations, from, to)
+	}
+
+	hubDeposits := make(map[string][]string)
+	for deposit, forwardedTo := range destinations {
+		if len(forwardedTo) != 1 || len(senders[deposit]) == 0 || !isEOA(deposit) {
+			continue
+		}
+		for hub := range forwardedTo {
+			if _, returned := senders[deposit][hub]; !returned {
+				hubDeposits[hub] = append(hubDeposits[hub], deposit)
+			}
+		}
+	}
+
+	exchange := make(map[string]struct{})
+	for hub, deposits := range hubDeposits {
+		if len(deposits) < minHubDeposits {
+			continue
+		}
+		exchange[hub] = struct{}{}
+		for _, deposit := range deposits {
+			exchange[deposit] = struct{}{}
+			var first string
+			for sender := range senders[deposit] {
+				if !isEOA(sender) {
+					continue
+				}
+				if first == "" {
+					first = sender
+					continue
+				}
+				clusters.union(first, sender, HeuristicDeposit)
+			}
+		}
+	}
+	return exchange
+}
+
+// clusterSynchronized clusters senders sharing most of the blocks they are active in.
+func clusterSynchronized(clusters *unionFind, blockSenders [][]string) {
+	active := make(map[string]int)
+	shared := make(map[[2]string]int)
+	for _, senders := range blockSenders {
+		unique := make(map[string]struct{}, len(senders))
+		for _, sender := range senders {
+			unique[sender] = struct{}{}
+		}
+		for sender := range unique {
+			active[sender]++
+		}
+		if len(unique) > maxSyncSenders {
+			continue
+		}
+
+		sorted := make([]string, 0, len(unique))
+		for sender := range unique {
+			sorted = append(sorted, sender)
+		}
+		sort.Strings(sorted)
+		for i := range sorted {
+			for j := i + 1; j < len(sorted); j++ {
+				shared[[2]string{sorted[i], sorted[j]}]++
+			}
+		}
+	}
+
+	for pair, count := range shared {
+		most := active[pair[0]]
+		if active[pair[1]] > most {
+			most = active[pair[1]]
+		}
+		if count >= minSyncBlocks && float64(count) >= syncRatio*float64(most) {
+			clusters.union(pair[0], pair[1], HeuristicSynchronized)
+		}
+	}
+}
+
+// EntityBalance is the combined balance of the wallets of a cluster, or of a single unclustered wallet.
+type EntityBalance struct {
+	Cluster   string   `json:"cluster,omitempty"`
+	Addresses []string `json:"addresses"`
+	Balance   string   `json:"balance"`
+	Amount
+	Value *big.Int `json:"-"`
+}
+
+// Annotate sets the cluster ID of every clustered wallet.
+func (c *Clustering) Annotate(wallets []WalletBalance) {
+	for i := range wallets {
+		wallets[i].Cluster = c.ClusterOf(wallets[i].Address)
+	}
+}
+
+// RichestEntities sums the balances of wallets belonging to the same cluster and ranks the resulting
+// entities by balance, rendered in the given unit. Only the wallets given are summed, not every member
+// of their cluster.
+func (c *Clustering) RichestEntities(wallets []WalletBalance, unit string) ([]EntityBalance, error) {
+	entities := make(map[string]*EntityBalance)
+	for _, wallet := range wallets {
+		key := c.ClusterOf(wallet.Address)
+		if key == "" {
+			key = strings.ToLower(wallet.Address)
+		}
+		entity, exists := entities[key]
+		if !exists {
+			entity = &EntityBalance{Cluster: c.ClusterOf(wallet.Address), Value: new(big.Int)}
+			entities[key] = entity
+		}
+		entity.Addresses = append(entity.Addresses, wallet.Address)
+		entity.Value.Add(entity.Value, wallet.Value)
+	}
+
+	ranked := make([]EntityBalance, 0, len(entities))
+	for _, entity := range entities {
+		balance, err := FormatAmount(entity.Value, unit)
+		if err != nil {
+			return nil, err
+		}
+		entity.Balance = balance
+		entity.Amount = NewAmount(entity.Value)
+		sort.Strings(entity.Addresses)
+		ranked = append(ranked, *entity)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if cmp := ranked[i].Value.Cmp(ranked[j].Value); cmp != 0 {
+			return cmp > 0
+		}
+		return ranked[i].Addresses[0] < ranked[j].Addresses[0]
+	})
+
+	return ranked, nil
+}
+
+// unionFind is a disjoint set of addresses remembering the heuristics that merged each set.
+type unionFind struct {
+	parent     map[string]string
+	heuristics map[string]map[string]struct{}
+}
+
+func newUnionFind() *unionFind {
+	return &unionFind{parent: make(map[string]string), heuristics: make(map[string]map[string]struct{})}
+}
+
+func (u *unionFind) find(address string) string {
+	parent, exists := u.parent[address]
+	if !exists {
+		u.parent[address] = address
+		return address
+	}
+	if parent == address {
+		return address
+	}
+	root := u.find(parent)
+	u.parent[address] = root
+	return root
+}
+
+func (u *unionFind) union(a, b, heuristic string) {
+	rootA, rootB := u.find(a), u.find(b)
+	if rootA != rootB {
+		u.parent[rootB] = rootA
+		for merged := range u.heuristics[rootB] {
+			u.addHeuristic(rootA, merged)
+		}
+		delete(u.heuristics, rootB)
+	}
+	u.addHeuristic(rootA, heuristic)
+}
+
+func (u *unionFind) addHeuristic(root, heuristic string) {
+	if u.heuristics[root] == nil {
+		u.heuristics[root] = make(map[string]struct{})
+	}
+	u.heuristics[root][heuristic] = struct{}{}
+}
+
+// clustering collects the sets with more than one address, largest first.
+func (u *unionFind) clustering(startBlock, endBlock int) *Clustering {
+	members := make(map[string][]string)
+	for address := range u.parent {
+		root := u.find(address)
+		members[root] = append(members[root], address)
+	}
+
+	result := &Clustering{StartBlock: startBlock, EndBlock: endBlock, Clusters: []Cluster{}, clusterOf: make(map[string]string)}
+	for root, addresses := range members {
+		if len(addresses) < 2 {
+			continue
+		}
+		sort.Strings(addresses)
+		heuristics := make([]string, 0, len(u.heuristics[root]))
+		for heuristic := range u.heuristics[root] {
+			heuristics = append(heuristics, heuristic)
+		}
+		sort.Strings(heuristics)
+
+		cluster := Cluster{ID: addresses[0], Size: len(addresses), Addresses: addresses, Heuristics: heuristics}
+		for _, address := range addresses {
+			result.clusterOf[address] = cluster.ID
+		}
+		result.Clusters = append(result.Clusters, cluster)
+	}
+	sort.Slice(result.Clusters, func(i, j int) bool {
+		if result.Clusters[i].Size != result.Clusters[j].Size {
+			return result.Clusters[i].Size > result.Clusters[j].Size
+		}
+		return result.Clusters[i].ID < result.Clusters[j].ID
+	})
+
+	return result
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"onchain-stats/abi"
+)
+
+var (
+	erc20Name        = abi.MustParseMethod("name()(string)")
+	erc20Symbol      = abi.MustParseMethod("symbol()(string)")
+	erc20Decimals    = abi.MustParseMethod("decimals()(uint8)")
+	erc20TotalSupply = abi.MustParseMethod("totalSupply()(uint256)")
+	erc20BalanceOf   = abi.MustParseMethod("balanceOf(address)(uint256)")
+)
+
+type TokenInfo struct {
+	Address     string   `json:"address"`
+	Name        string   `json:"name"`
+	Symbol      string   `json:"symbol"`
+	Decimals    uint8    `json:"decimals"`
+	TotalSupply *big.Int `json:"totalSupply"`
+}
+
+// CallContract invokes a view function on the contract at address and decodes its return values.
+func CallContract(ctx context.Context, address, blockNumber string, method abi.Method, args ...interface{}) ([]interface{}, error) {
+	data, err := method.Pack(args...)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err := evmosClient.Call(ctx, address, abi.ToHex(data), blockNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := abi.FromHex(output)
+	if err != nil {
+		return nil, err
+	}
+
+	return method.Unpack(raw)
+}
+
+// GetTokenInfo reads the ERC-20 metadata of a token contract at the given block.
+func GetTokenInfo(ctx context.Context, address, blockNumber string) (TokenInfo, error) {
+	info := TokenInfo{Address: address}
+
+	name, err := CallContract(ctx, address, blockNumber, erc20Name)
+	if err != nil {
+		return TokenInfo{}, fmt.Errorf("reading name: %w", err)
+	}
+	info.Name = name[0].(string)
+
+	symbol, err := CallContract(ctx, address, blockNumber, erc20Symbol)
+	if err != nil {
+		return TokenInfo{}, fmt.Errorf("reading symbol: %w", err)
+	}
+	info.Symbol = symbol[0].(string)
+
+	decimals, err := CallContract(ctx, address, blockNumber, erc20Decimals)
+	if err != nil {
+		return TokenInfo{}, fmt.Errorf("reading decimals: %w", err)
+	}
+	info.Decimals = uint8(decimals[0].(*big.Int).Uint64())
+
+	totalSupply, err := CallContract(ctx, address, blockNumber, erc20TotalSupply)
+	if err != nil {
+		return TokenInfo{}, fmt.Errorf("reading totalSupply: %w", err)
+	}
+	info.TotalSupply = totalSupply[0].(*big.Int)
+
+	return info, nil
+}
+
+// GetTokenBalance returns the ERC-20 balance of owner for the token at the given block.
+func GetTokenBalance(ctx context.Context, token, owner, blockNumber string) (*big.Int, error) {
+	balance, err := CallContract(ctx, token, blockNumber, erc20BalanceOf, owner)
+	if err != nil {
+		return nil, err
+	}
+
+	return balance[0].(*big.Int), nil
+}
@@ -0,0 +1,188 @@
+package service
+
+import (
+	"errors"
+	"math/big"
+	"onchain-stats/abi"
+	"sort"
+	"strings"
+)
+
+var ErrUnknownSortField = errors.New("unknown sort field")
+
+// topCallersLimit is the number of callers reported in ContractStats.TopCallers.
+const topCallersLimit = 5
+
+// topReasonsLimit is the number of revert reasons reported per contract.
+const topReasonsLimit = 5
+
+type CallerCount struct {
+	Address string `json:"address"`
+	Count   int    `json:"count"`
+}
+
+type ContractStats struct {
+	Address        string        `json:"address"`
+	Bech32         string        `json:"bech32,omitempty"`
+	Label          *Label        `json:"label,omitempty"`
+	Interactions   int           `json:"interactions"`
+	UniqueCallers  int           `json:"uniqueCallers"`
+	ValueReceived  string        `json:"valueReceived"`
+	GasUsed        uint64        `json:"gasUsed"`
+	Successes      int           `json:"successes"`
+	Reverts        int           `json:"reverts"`
+	FirstSeenBlock uint64        `json:"firstSeenBlock"`
+	LastSeenBlock  uint64        `json:"lastSeenBlock"`
+	TopCallers     []CallerCount `json:"topCallers"`
+	Methods        []MethodCount `json:"methods"`
+	RevertReasons  []ReasonCount `json:"revertReasons"`
+	ContractInfo
+
+	value   *big.Int
+	methods map[string]int
+	callers map[string]int
+	reasons map[string]int
+}
+
+// interaction is a single call into a contract, either a top-level transaction or an internal call frame.
+type interaction struct {
+	caller   string
+	selector string
+	value    *big.Int
+	gasUsed  uint64
+	failed   bool
+	reason   string
+	block    uint64
+}
+
+// contractSortFields compares two contracts by one of their numeric fields, returning a positive
+// number when a ranks above b.
+var contractSortFields = map[string]func(a, b *ContractStats) int{
+	"interactions":   func(a, b *ContractStats) int { return a.Interactions - b.Interactions },
+	"uniqueCallers":  func(a, b *ContractStats) int { return a.UniqueCallers - b.UniqueCallers },
+	"valueReceived":  func(a, b *ContractStats) int { return a.value.Cmp(b.value) },
+	"gasUsed":        func(a, b *ContractStats) int { return compareUint64(a.GasUsed, b.GasUsed) },
+	"successes":      func(a, b *ContractStats) int { return a.Successes - b.Successes },
+	"reverts":        func(a, b *ContractStats) int { return a.Reverts - b.Reverts },
+	"firstSeenBlock": func(a, b *ContractStats) int { return compareUint64(a.FirstSeenBlock, b.FirstSeenBlock) },
+	"lastSeenBlock":  func(a, b *ContractStats) int { return compareUint64(a.LastSeenBlock, b.LastSeenBlock) },
+}
+
+// ContractSortFields returns the names accepted as sort field by GetSmartContracts.
+func ContractSortFields() []string {
+	fields := make([]string, 0, len(contractSortFields))
+	for field := range contractSortFields {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func compareUint64(a, b uint64) int {
+	switch {
+	case a > b:
+		return 1
+	case a < b:
+		return -1
+	}
+	return 0
+}
+
+func newContractStats(address string) *ContractStats {
+	return &ContractStats{
+		Address: address,
+		value:   new(big.Int),
+		methods: make(map[string]int),
+		callers: make(map[string]int),
+		reasons: make(map[string]int),
+	}
+}
+
+func (s *ContractStats) record(call interaction) {
+	s.Interactions++
+	s.methods[call.selector]++
+	if call.caller != "" {
+		s.callers[strings.ToLower(call.caller)]++
+	}
+	if call.value != nil {
+		s.value.Add(s.value, call.value)
+	}
+	s.GasUsed += call.gasUsed
+	if call.failed {
+		s.Reverts++
+		s.reasons[call.reason]++
+	} else {
+		s.Successes++
+	}
+	if s.FirstSeenBlock == 0 || call.block < s.FirstSeenBlock {
+		s.FirstSeenBlock = call.block
+	}
+	if call.block > s.LastSeenBlock {
+		s.LastSeenBlock = call.block
+	}
+}
+
+// finalize derives the caller and method summaries from the recorded interactions.
+func (s *ContractStats) finalize(contractABI *abi.ABI) {
+	s.UniqueCallers = len(s.callers)
+	s.ValueReceived = s.value.String()
+	s.Methods = methodBreakdown(contractABI, s.methods)
+
+	s.TopCallers = make([]CallerCount, 0, len(s.callers))
+	for caller, count := range s.callers {
+		s.TopCallers = append(s.TopCallers, CallerCount{caller, count})
+	}
+	sort.Slice(s.TopCallers, func(i, j int) bool {
+		if s.TopCallers[i].Count != s.TopCallers[j].Count {
+			return s.TopCallers[i].Count > s.TopCallers[j].Count
+		}
+		return s.TopCallers[i].Address < s.TopCallers[j].Address
+	})
+	if len(s.TopCallers) > topCallersLimit {
+		s.TopCallers = s.TopCallers[:topCallersLimit]
+	}
+
+	s.RevertReasons = rankReasons(s.reasons, topReasonsLimit)
+}
+
+// frameInteraction converts a callTracer frame into an interaction with the contract it calls.
+func frameInteraction(frame map[string]interface{}, block uint64) interaction {
+	return interaction{
+		caller:   stringValue(frame["from"]),
+		selector: inputSelector(frame["input"]),
+		value:    hexToBigInt(frame["value"]),
+		gasUsed:  hexToUint64(frame["gasUsed"]),
+		failed:   frameFailed(frame),
+		reason:   failureReason(frame),
+		block:    block,
+	}
+}
+
+// frameFailed reports whether a callTracer frame reverted or otherwise failed.
+func frameFailed(frame map[string]interface{}) bool {
+	return stringValue(frame["error"]) != ""
+}
+
+func stringValue(value interface{}) string {
+	s, _ := value.(string)
+	return s
+}
+
+// hexToBigInt parses a hex quantity returned by the node, returning 0 for missing or malformed values.
+func hexToBigInt(value interface{}) *big.Int {
+	s := strings.TrimPrefix(stringValue(value), "0x")
+	n, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		return new(big.Int)
+	}
+	return n
+}
+
+// hexToUint64 parses a hex quantity returned by the node, returning 0 for missing or malformed values.
+func hexToUint64(value interface{}) uint64 {
+	n := hexToBigInt(value)
+	if !n.IsUint64() {
+		return 0
+	}
+	return n.Uint64()
+}
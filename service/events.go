@@ -0,0 +1,197 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"onchain-stats/abi"
+	"onchain-stats/bech32"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type DecodedEvent struct {
+	Address     string                 `json:"address"`
+	BlockNumber uint64                 `json:"blockNumber"`
+	TxHash      string                 `json:"transactionHash"`
+	LogIndex    uint64                 `json:"logIndex"`
+	Event       string                 `json:"event"`
+	Signature   string                 `json:"signature"`
+	Args        map[string]interface{} `json:"args"`
+}
+
+var (
+	abiRegistryMu sync.RWMutex
+	abiRegistry   = make(map[string]*abi.ABI)
+)
+
+// RegisterABI parses a JSON contract ABI and registers it for the contract at address,
+// replacing any ABI previously registered for it.
+func RegisterABI(address string, data []byte) error {
+	hexAddress, err := bech32.NormalizeAddress(address)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidAddress, err)
+	}
+
+	parsed, err := abi.ParseJSON(data)
+	if err != nil {
+		return fmt.Errorf("parsing ABI for %s: %w", address, err)
+	}
+
+	abiRegistryMu.Lock()
+	defer abiRegistryMu.Unlock()
+	abiRegistry[hexAddress] = parsed
+
+	return nil
+}
+
+// LoadABIDir registers every "<address>.json" file found in dir. Files whose name is not an address are
+// skipped with a warning.
+func LoadABIDir(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		data, err := os.ReadFile(file) // #nosec G304 -- files come from the configured ABI directory
+		if err != nil {
+			return err
+		}
+		address := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		if _, err := bech32.NormalizeAddress(address); err != nil {
+			slog.Warn("skipping ABI file not named after an address", "file", file, "error", err)
+			continue
+		}
+		if err := RegisterABI(address, data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetContractABI returns the ABI registered for address, given in hex or evmos1 form, if any.
+func GetContractABI(address string) (*abi.ABI, bool) {
+	hexAddress, err := bech32.NormalizeAddress(address)
+	if err != nil {
+		return nil, false
+	}
+
+	abiRegistryMu.RLock()
+	defer abiRegistryMu.RUnlock()
+	parsed, exists := abiRegistry[hexAddress]
+	return parsed, exists
+}
+
+// GetRegisteredABIs returns the addresses of all contracts with a registered ABI.
+func GetRegisteredABIs() []string {
+	abiRegistryMu.RLock()
+	defer abiRegistryMu.RUnlock()
+
+	addresses := make([]string, 0, len(abiRegistry))
+	for address := range abiRegistry {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+	return addresses
+}
+
+// GetDecodedEvents fetches the logs of a contract between startBlock and endBlock and decodes them with its registered ABI.
+// Logs whose topic does not match any event of the ABI are skipped.
+func GetDecodedEvents(ctx context.Context, address string, startBlock, endBlock int) ([]DecodedEvent, error) {
+	hexAddress, err := bech32.NormalizeAddress(address)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAddress, err)
+	}
+
+	contractABI, exists := GetContractABI(hexAddress)
+	if !exists {
+		return nil, fmt.Errorf("no ABI registered for %s", address)
+	}
+
+	logs, err := evmosClient.GetLogs(ctx, hexAddress, fmt.Sprintf("0x%x", startBlock), fmt.Sprintf("0x%x", endBlock))
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]DecodedEvent, 0, len(logs))
+	for _, log := range logs {
+		event, ok := decodeLog(contractABI, log)
+		if ok {
+			events = append(events, event)
+		}
+	}
+
+	return events, nil
+}
+
+func decodeLog(contractABI *abi.ABI, log map[string]interface{}) (DecodedEvent, bool) {
+	rawTopics, _ := log["topics"].([]interface{})
+	if len(rawTopics) == 0 {
+		return DecodedEvent{}, false
+	}
+
+	topics := make([][]byte, 0, len(rawTopics))
+	for _, rawTopic := range rawTopics {
+		topicStr, _ := rawTopic.(string)
+		topic, err := abi.FromHex(topicStr)
+		if err != nil {
+			return DecodedEvent{}, false
+		}
+		topics = append(topics, topic)
+	}
+
+	event, exists := contractABI.EventByID(topics[0])
+	if !exists {
+		return DecodedEvent{}, false
+	}
+
+	dataStr, _ := log["data"].(string)
+	data, err := abi.FromHex(dataStr)
+	if err != nil {
+		return DecodedEvent{}, false
+	}
+
+	args, err := event.DecodeLog(topics, data)
+	if err != nil {
+		return DecodedEvent{}, false
+	}
+	for name, value := range args {
+		args[name] = jsonValue(value)
+	}
+
+	address, _ := log["address"].(string)
+	txHash, _ := log["transactionHash"].(string)
+	return DecodedEvent{
+		Address:     address,
+		BlockNumber: hexToUint64(log["blockNumber"]),
+		TxHash:      txHash,
+		LogIndex:    hexToUint64(log["logIndex"]),
+		Event:       event.Name,
+		Signature:   event.Signature(),
+		Args:        args,
+	}, true
+}
+
+// jsonValue converts decoded ABI values into a JSON friendly form: byte slices become hex strings
+// and integers decimal strings, so large values survive JavaScript clients.
+func jsonValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []byte:
+		return abi.ToHex(v)
+	case *big.Int:
+		return v.String()
+	case []interface{}:
+		converted := make([]interface{}, len(v))
+		for i, item := range v {
+			converted[i] = jsonValue(item)
+		}
+		return converted
+	}
+	return value
+}
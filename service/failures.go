@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+type ReasonCount struct {
+	Reason string `json:"reason"`
+	Count  int    `json:"count"`
+}
+
+type ContractFailures struct {
+	Address    string        `json:"address"`
+	Bech32     string        `json:"bech32,omitempty"`
+	Calls      int           `json:"calls"`
+	Reverts    int           `json:"reverts"`
+	RevertRate float64       `json:"revertRate"`
+	TopReasons []ReasonCount `json:"topReasons"`
+
+	reasons map[string]int
+}
+
+type FailureStats struct {
+	StartBlock            int                `json:"startBlock"`
+	EndBlock              int                `json:"endBlock"`
+	Transactions          int                `json:"transactions"`
+	FailedTransactions    int                `json:"failedTransactions"`
+	FailureRate           float64            `json:"failureRate"`
+	InternalCalls         int                `json:"internalCalls"`
+	FailedInternalCalls   int                `json:"failedInternalCalls"`
+	TopRevertingContracts []ContractFailures `json:"topRevertingContracts"`
+	TopReasons            []ReasonCount      `json:"topReasons"`
+}
+
+// GetFailureStats traces every transaction between startBlock and endBlock and reports how many transactions
+// and internal calls failed, the limit contracts with the most reverts and the most common revert reasons.
+// A revert bubbling up through several frames counts once for every frame it fails.
+func GetFailureStats(ctx context.Context, startBlock, endBlock, limit int) (*FailureStats, error) {
+	blocks, err := index.blocksInRange(ctx, startBlock, endBlock)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &FailureStats{StartBlock: startBlock, EndBlock: endBlock}
+	contracts := make(map[string]*ContractFailures)
+	reasons := make(map[string]int)
+	record := func(frame map[string]interface{}) {
+		address := strings.ToLower(stringValue(frame["to"]))
+		if address == "" {
+			return
+		}
+		contract, exists := contracts[address]
+		if !exists {
+			contract = &ContractFailures{Address: address, reasons: make(map[string]int)}
+			contracts[address] = contract
+		}
+		contract.Calls++
+		if frameFailed(frame) {
+			reason := failureReason(frame)
+			contract.Reverts++
+			contract.reasons[reason]++
+			reasons[reason]++
+		}
+	}
+
+	for _, block := range blocks {
+		transactions, _ := block["transactions"].([]interface{})
+		for _, tx := range transactions {
+			txMap, ok := tx.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			trace, err := index.trace(ctx, stringValue(txMap["hash"]))
+			if err != nil {
+				return nil, err
+			}
+			if trace == nil {
+				continue
+			}
+
+			stats.Transactions++
+			if frameFailed(trace) {
+				stats.FailedTransactions++
+			}
+			record(trace)
+			walkCalls(trace, func(call map[string]interface{}) {
+				stats.InternalCalls++
+				if frameFailed(call) {
+					stats.FailedInternalCalls++
+				}
+				record(call)
+			})
+		}
+	}
+	stats.FailureRate = ratio(uint64(stats.FailedTransactions), uint64(stats.Transactions))
+
+	stats.TopRevertingContracts = make([]ContractFailures, 0)
+	for _, contract := range contracts {
+		if contract.Reverts == 0 {
+			continue
+		}
+		contract.Bech32 = toBech32(contract.Address)
+		contract.RevertRate = ratio(uint64(contract.Reverts), uint64(contract.Calls))
+		contract.TopReasons = rankReasons(contract.reasons, topReasonsLimit)
+		stats.TopRevertingContracts = append(stats.TopRevertingContracts, *contract)
+	}
+	sort.Slice(stats.TopRevertingContracts, func(i, j int) bool {
+		a, b := stats.TopRevertingContracts[i], stats.TopRevertingContracts[j]
+		if a.Reverts != b.Reverts {
+			return a.Reverts > b.Reverts
+		}
+		return a.Address < b.Address
+	})
+	if len(stats.TopRevertingContracts) > limit {
+		stats.TopRevertingContracts = stats.TopRevertingContracts[:limit]
+	}
+	stats.TopReasons = rankReasons(reasons, limit)
+
+	return stats, nil
+}
+
+// rankReasons returns up to limit of the counted reasons, most frequent first.
+func rankReasons(counts map[string]int, limit int) []ReasonCount {
+	ranked := make([]ReasonCount, 0, len(counts))
+	for reason, count := range counts {
+		ranked = append(ranked, ReasonCount{Reason: reason, Count: count})
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Count != ranked[j].Count {
+			return ranked[i].Count > ranked[j].Count
+		}
+		return ranked[i].Reason < ranked[j].Reason
+	})
+	if len(ranked) > limit {
+		ranked = ranked[:limit]
+	}
+	return ranked
+}
@@ -0,0 +1,201 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+// FlowNode is an address of the graph. Sent and Received are in wei, as decimal strings.
+type FlowNode struct {
+	Address    string `json:"address"`
+	Bech32     string `json:"bech32,omitempty"`
+	IsContract bool   `json:"isContract"`
+	Sent       string `json:"sent"`
+	Received   string `json:"received"`
+
+	sent, received *big.Int
+}
+
+// FlowEdge is the value moved from one address to another. Value is in wei, as a decimal string.
+type FlowEdge struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Count int    `json:"count"`
+	Value string `json:"value"`
+
+	value *big.Int
+}
+
+type FlowGraph struct {
+	StartBlock int        `json:"startBlock"`
+	EndBlock   int        `json:"endBlock"`
+	Nodes      []FlowNode `json:"nodes"`
+	Edges      []FlowEdge `json:"edges"`
+}
+
+// GetFlowGraph builds the directed graph of EVMOS moved between addresses from startBlock to endBlock. Every
+// successful transaction and internal transfer with a value adds to the edge from its sender to its
+// recipient, so edges are weighted by the number of transfers and the total value.
+func GetFlowGraph(ctx context.Context, startBlock, endBlock int) (*FlowGraph, error) {
+	blocks, err := index.blocksInRange(ctx, startBlock, endBlock)
+	if err != nil {
+		return nil, err
+	}
+
+	edges := make(map[[2]string]*FlowEdge)
+	nodes := make(map[string]*FlowNode)
+	node := func(address string) *FlowNode {
+		n, exists := nodes[address]
+		if !exists {
+			n = &FlowNode{Address: address, Bech32: toBech32(address), sent: new(big.Int), received: new(big.Int)}
+			nodes[address] = n
+		}
+		return n
+	}
+	addFlow := func(from, to string, value *big.Int) {
+		from, to = strings.ToLower(from), strings.ToLower(to)
+		edge, exists := edges[[2]string{from, to}]
+		if !exists {
+			edge = &FlowEdge{From: from, To: to, value: new(big.Int)}
+			edges[[2]string{from, to}] = edge
+		}
+		edge.Count++
+		edge.value.Add(edge.value, value)
+		node(from).sent.Add(node(from).sent, value)
+		node(to).received.Add(node(to).received, value)
+	}
+
+	transfers, err := valueTransfers(ctx, blocks)
+	if err != nil {
+		return nil, err
+	}
+	for _, transfer := range transfers {
+		addFlow(transfer.From, transfer.To, transfer.value)
+	}
+
+	graph := &FlowGraph{
+		StartBlock: startBlock,
+		EndBlock:   endBlock,
+		Nodes:      make([]FlowNode, 0, len(nodes)),
+		Edges:      make([]FlowEdge, 0, len(edges)),
+	}
+	addresses := make([]string, 0, len(nodes))
+	for address := range nodes {
+		addresses = append(addresses, address)
+	}
+	contracts, err := lookupContracts(ctx, addresses)
+	if err != nil {
+		return nil, err
+	}
+	for address, n := range nodes {
+		n.IsContract = contracts[address]
+		n.Sent, n.Received = n.sent.String(), n.received.String()
+		graph.Nodes = append(graph.Nodes, *n)
+	}
+	sort.Slice(graph.Nodes, func(i, j int) bool { return graph.Nodes[i].Address < graph.Nodes[j].Address })
+
+	for _, edge := range edges {
+		edge.Value = edge.value.String()
+		graph.Edges = append(graph.Edges, *edge)
+	}
+	sort.Slice(graph.Edges, func(i, j int) bool {
+		a, b := graph.Edges[i], graph.Edges[j]
+		if cmp := a.value.Cmp(b.value); cmp != 0 {
+			return cmp > 0
+		}
+		if a.From != b.From {
+			return a.From < b.From
+		}
+		return a.To < b.To
+	})
+
+	return graph, nil
+}
+
+// valueTransfers returns the EVMOS moved by the successful transactions of blocks and the internal transfers
+// within them, in execution order. The root frame of the trace also names the contract created by deployments.
+func valueTransfers(ctx context.Context, blocks []map[string]interface{}) ([]InternalTransfer, error) {
+	var transfers []InternalTransfer
+	for _, block := range blocks {
+		blockNumber := hexToUint64(block["number"])
+		transactions, _ := block["transactions"].([]interface{})
+		for _, tx := range transactions {
+			txMap, ok := tx.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			txHash := stringValue(txMap["hash"])
+			trace, err := index.trace(ctx, txHash)
+			if err != nil {
+				return nil, err
+			}
+			if trace == nil || frameFailed(trace) {
+				continue
+			}
+
+			if value := hexToBigInt(trace["value"]); value.Sign() > 0 && stringValue(trace["to"]) != "" {
+				transfers = append(transfers, newInternalTransfer(trace, txHash, blockNumber))
+			}
+			transfers = append(transfers, internalTransfers(trace, txHash, blockNumber)...)
+		}
+	}
+	return transfers, nil
+}
+
+// GraphML renders the graph as GraphML, readable by Gephi. Edge weights are the value moved in EVMOS.
+func (g *FlowGraph) GraphML() string {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<graphml xmlns="http://graphml.graphdrawing.org/xmlns">` + "\n")
+	b.WriteString(`  <key id="bech32" for="node" attr.name="bech32" attr.type="string"/>` + "\n")
+	b.WriteString(`  <key id="contract" for="node" attr.name="contract" attr.type="boolean"/>` + "\n")
+	b.WriteString(`  <key id="count" for="edge" attr.name="count" attr.type="int"/>` + "\n")
+	b.WriteString(`  <key id="value" for="edge" attr.name="value" attr.type="string"/>` + "\n")
+	b.WriteString(`  <key id="weight" for="edge" attr.name="weight" attr.type="double"/>` + "\n")
+	b.WriteString(`  <graph id="flows" edgedefault="directed">` + "\n")
+	for _, n := range g.Nodes {
+		fmt.Fprintf(&b, "    <node id=\"%s\">\n", escapeXML(n.Address))
+		fmt.Fprintf(&b, "      <data key=\"bech32\">%s</data>\n", escapeXML(n.Bech32))
+		fmt.Fprintf(&b, "      <data key=\"contract\">%t</data>\n", n.IsContract)
+		b.WriteString("    </node>\n")
+	}
+	for i, e := range g.Edges {
+		fmt.Fprintf(&b, "    <edge id=\"e%d\" source=\"%s\" target=\"%s\">\n", i, escapeXML(e.From), escapeXML(e.To))
+		fmt.Fprintf(&b, "      <data key=\"count\">%d</data>\n", e.Count)
+		fmt.Fprintf(&b, "      <data key=\"value\">%s</data>\n", e.Value)
+		fmt.Fprintf(&b, "      <data key=\"weight\">%s</data>\n", formatDecimals(e.value, evmosDecimals))
+		b.WriteString("    </edge>\n")
+	}
+	b.WriteString("  </graph>\n</graphml>\n")
+	return b.String()
+}
+
+// DOT renders the graph in the Graphviz DOT language, drawing contracts as boxes.
+func (g *FlowGraph) DOT() string {
+	var b strings.Builder
+	b.WriteString("digraph flows {\n")
+	for _, n := range g.Nodes {
+		shape := "ellipse"
+		if n.IsContract {
+			shape = "box"
+		}
+		fmt.Fprintf(&b, "  %q [shape=%s];\n", n.Address, shape)
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(&b, "  %q -> %q [label=%q, weight=%d];\n", e.From, e.To,
+			fmt.Sprintf("%d transfers, %s EVMOS", e.Count, formatDecimals(e.value, evmosDecimals)), e.Count)
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+func escapeXML(s string) string {
+	var b bytes.Buffer
+	_ = xml.EscapeText(&b, []byte(s)) // writes to a bytes.Buffer never fail
+	return b.String()
+}
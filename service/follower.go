@@ -0,0 +1,158 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// maxFollowBatch bounds the number of blocks ingested by a single poll, so a follower far behind the node
+// catches up in steps instead of one huge range request.
+const maxFollowBatch = 100
+
+// BlockHook is called with every new block ingested by the follower, in ascending order, with the context of
+// the sync that ingested it.
+type BlockHook func(ctx context.Context, block map[string]interface{})
+
+// follower tracks the head of the chain, ingesting new blocks into the local index as they are produced.
+// syncMu serializes polls, so hooks see every block once and in order, while mu guards head and hooks.
+type follower struct {
+	syncMu sync.Mutex
+	mu     sync.Mutex
+	head   uint64
+	latest uint64
+	hooks  []BlockHook
+}
+
+var chainFollower = &follower{}
+
+// OnNewBlock registers a hook called with every block ingested by the follower.
+func OnNewBlock(hook BlockHook) {
+	chainFollower.mu.Lock()
+	defer chainFollower.mu.Unlock()
+	chainFollower.hooks = append(chainFollower.hooks, hook)
+}
+
+// FollowedHead returns the number of the last block ingested by the follower, or 0 before the first poll.
+func FollowedHead() uint64 {
+	chainFollower.mu.Lock()
+	defer chainFollower.mu.Unlock()
+	return chainFollower.head
+}
+
+func (f *follower) reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.head, f.latest = 0, 0
+}
+
+// SyncNewBlocks ingests the blocks produced since the previous call into the local index and calls the
+// registered hooks with each of them, returning the number of blocks ingested. The first call only records
+// the current head, so history is not replayed to the hooks. At most maxFollowBatch blocks are ingested
+// per call.
+func SyncNewBlocks(ctx context.Context) (int, error) {
+	chainFollower.syncMu.Lock()
+	defer chainFollower.syncMu.Unlock()
+
+	latest, err := latestBlockNumber(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return chainFollower.sync(ctx, latest)
+}
+
+// SyncToBlock is SyncNewBlocks for a head announced by the node, such as a newHeads notification. Every
+// block after the followed head is ingested, in batches, so blocks missed while disconnected are backfilled.
+func SyncToBlock(ctx context.Context, number uint64) (int, error) {
+	chainFollower.syncMu.Lock()
+	defer chainFollower.syncMu.Unlock()
+
+	total := 0
+	for {
+		ingested, err := chainFollower.sync(ctx, number)
+		total += ingested
+		if err != nil || ingested == 0 || FollowedHead() >= number {
+			return total, err
+		}
+	}
+}
+
+// sync ingests up to maxFollowBatch blocks after the followed head, up to latest. syncMu must be held.
+func (f *follower) sync(ctx context.Context, latest uint64) (int, error) {
+	f.mu.Lock()
+	head, hooks := f.head, f.hooks
+	if latest > f.latest {
+		f.latest = latest
+	}
+	if head == 0 {
+		f.head = latest
+	}
+	f.mu.Unlock()
+	if head == 0 || latest <= head {
+		return 0, nil
+	}
+
+	start, end := head+1, latest
+	if end-start+1 > maxFollowBatch {
+		end = start + maxFollowBatch - 1
+	}
+	blocks, err := index.blocksInRange(ctx, int(start), int(end))
+	if err != nil {
+		return 0, err
+	}
+	for _, block := range blocks {
+		for _, hook := range hooks {
+			hook(ctx, block)
+		}
+	}
+
+	f.mu.Lock()
+	f.head = end
+	f.mu.Unlock()
+	return len(blocks), nil
+}
+
+// Follow polls the node for new blocks every interval until ctx is done. Failed polls are retried on the
+// next tick.
+func Follow(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := SyncNewBlocks(ctx); err != nil {
+			slog.ErrorContext(ctx, "following new blocks", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// FollowHeads ingests new blocks as their numbers arrive on heads, typically from a newHeads subscription,
+// until ctx is done. Heads queued while a sync runs are coalesced into the latest one.
+func FollowHeads(ctx context.Context, heads <-chan uint64) {
+	for {
+		var head uint64
+		select {
+		case <-ctx.Done():
+			return
+		case head = <-heads:
+		}
+		for queued := true; queued; {
+			select {
+			case next := <-heads:
+				if next > head {
+					head = next
+				}
+			default:
+				queued = false
+			}
+		}
+
+		if _, err := SyncToBlock(ctx, head); err != nil {
+			slog.ErrorContext(ctx, "following block", "block", head, "error", err)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+)
+
+// maxFeeHistoryBlocks is the largest block count nodes accept in a single eth_feeHistory request.
+const maxFeeHistoryBlocks = 1024
+
+// gasPricePercentiles are the percentiles reported for the effective gas price distribution.
+var gasPricePercentiles = []float64{10, 25, 50, 75, 90, 99}
+
+type BlockGas struct {
+	Number        uint64   `json:"number"`
+	Transactions  int      `json:"transactions"`
+	GasUsed       uint64   `json:"gasUsed"`
+	GasLimit      uint64   `json:"gasLimit"`
+	Utilization   float64  `json:"utilization"`
+	BaseFeePerGas *big.Int `json:"baseFeePerGas"`
+	// Fees is the total of the fees paid in the block in wei, as a decimal string.
+	Fees string `json:"fees"`
+}
+
+type BaseFeeTrend struct {
+	First *big.Int `json:"first"`
+	Last  *big.Int `json:"last"`
+	Min   *big.Int `json:"min"`
+	Max   *big.Int `json:"max"`
+	Mean  *big.Int `json:"mean"`
+	// Change is the relative change from the first to the last base fee, in percent.
+	Change float64 `json:"change"`
+}
+
+type GasStats struct {
+	StartBlock          int                 `json:"startBlock"`
+	EndBlock            int                 `json:"endBlock"`
+	Transactions        int                 `json:"transactions"`
+	TotalGasUsed        uint64              `json:"totalGasUsed"`
+	TotalGasLimit       uint64              `json:"totalGasLimit"`
+	Utilization         float64             `json:"utilization"`
+	TotalFees           string              `json:"totalFees"`
+	GasPricePercentiles map[string]*big.Int `json:"gasPricePercentiles"`
+	BaseFee             *BaseFeeTrend       `json:"baseFee"`
+	Blocks              []BlockGas          `json:"blocks"`
+}
+
+// GetGasStats computes gas usage, fees and the effective gas price distribution between startBlock and endBlock.
+// Fees are taken from the transaction receipts, and base fees from eth_feeHistory so that nodes without
+// baseFeePerGas in the block header are covered as well.
+func GetGasStats(ctx context.Context, startBlock, endBlock int) (*GasStats, error) {
+	blocks, err := evmosClient.GetBlocksInRange(ctx, startBlock, endBlock)
+	if err != nil {
+		return nil, err
+	}
+
+	baseFees, err := getBaseFees(ctx, startBlock, endBlock)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &GasStats{
+		StartBlock:          startBlock,
+		EndBlock:            endBlock,
+		GasPricePercentiles: make(map[string]*big.Int),
+		Blocks:              make([]BlockGas, 0, len(blocks)),
+	}
+
+	var gasPrices []*big.Int
+	totalFees := new(big.Int)
+	for _, block := range blocks {
+		blockGas := BlockGas{
+			Number:        hexToUint64(block["number"]),
+			GasUsed:       hexToUint64(block["gasUsed"]),
+			GasLimit:      hexToUint64(block["gasLimit"]),
+			BaseFeePerGas: hexToBigInt(block["baseFeePerGas"]),
+		}
+		if baseFee, exists := baseFees[blockGas.Number]; exists {
+			blockGas.BaseFeePerGas = baseFee
+		}
+		blockGas.Utilization = ratio(blockGas.GasUsed, blockGas.GasLimit)
+
+		transactions, _ := block["transactions"].([]interface{})
+		blockGas.Transactions = len(transactions)
+		blockFees := new(big.Int)
+		for _, tx := range transactions {
+			txMap := tx.(map[string]interface{})
+			receipt, err := evmosClient.GetTransactionReceipt(ctx, txMap["hash"].(string))
+			if err != nil {
+				return nil, err
+			}
+
+			gasPrice := effectiveGasPrice(txMap, receipt, blockGas.BaseFeePerGas)
+			gasPrices = append(gasPrices, gasPrice)
+
+			fee := new(big.Int).Mul(gasPrice, new(big.Int).SetUint64(hexToUint64(receipt["gasUsed"])))
+			blockFees.Add(blockFees, fee)
+		}
+
+		stats.Transactions += blockGas.Transactions
+		stats.TotalGasUsed += blockGas.GasUsed
+		stats.TotalGasLimit += blockGas.GasLimit
+		totalFees.Add(totalFees, blockFees)
+		blockGas.Fees = blockFees.String()
+		stats.Blocks = append(stats.Blocks, blockGas)
+	}
+	stats.Utilization = ratio(stats.TotalGasUsed, stats.TotalGasLimit)
+	stats.TotalFees = totalFees.String()
+
+	sort.Slice(gasPrices, func(i, j int) bool { return gasPrices[i].Cmp(gasPrices[j]) < 0 })
+	for _, p := range gasPricePercentiles {
+		if len(gasPrices) > 0 {
+			stats.GasPricePercentiles[fmt.Sprintf("p%g", p)] = gasPrices[percentileIndex(len(gasPrices), p)]
+		}
+	}
+
+	stats.BaseFee = baseFeeTrend(stats.Blocks)
+
+	return stats, nil
+}
+
+// getBaseFees fetches the base fee of every block in the range, chunking eth_feeHistory requests.
+func getBaseFees(ctx context.Context, startBlock, endBlock int) (map[uint64]*big.Int, error) {
+	baseFees := make(map[uint64]*big.Int)
+	for newest := endBlock; newest >= startBlock; newest -= maxFeeHistoryBlocks {
+		count := newest - startBlock + 1
+		if count > maxFeeHistoryBlocks {
+			count = maxFeeHistoryBlocks
+		}
+
+		history, err := evmosClient.GetFeeHistory(ctx, count, fmt.Sprintf("0x%x", newest), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		oldest := hexToUint64(history["oldestBlock"])
+		fees, _ := history["baseFeePerGas"].([]interface{})
+		// the response includes the base fee of the block after newest, which is outside the range
+		for i := 0; i < len(fees) && i < count; i++ {
+			baseFees[oldest+uint64(i)] = hexToBigInt(fees[i])
+		}
+	}
+
+	return baseFees, nil
+}
+
+// effectiveGasPrice returns the price per gas actually paid by a transaction. Receipts report it directly;
+// otherwise it is derived from the EIP-1559 fee caps and the block base fee, or the legacy gas price.
+func effectiveGasPrice(tx, receipt map[string]interface{}, baseFee *big.Int) *big.Int {
+	if price, exists := receipt["effectiveGasPrice"]; exists {
+		return hexToBigInt(price)
+	}
+
+	if maxFee, exists := tx["maxFeePerGas"]; exists {
+		price := new(big.Int).Add(baseFee, hexToBigInt(tx["maxPriorityFeePerGas"]))
+		if capped := hexToBigInt(maxFee); capped.Cmp(price) < 0 {
+			return capped
+		}
+		return price
+	}
+
+	return hexToBigInt(tx["gasPrice"])
+}
+
+func baseFeeTrend(blocks []BlockGas) *BaseFeeTrend {
+	if len(blocks) == 0 {
+		return nil
+	}
+
+	trend := &BaseFeeTrend{
+		First: blocks[0].BaseFeePerGas,
+		Last:  blocks[len(blocks)-1].BaseFeePerGas,
+		Min:   blocks[0].BaseFeePerGas,
+		Max:   blocks[0].BaseFeePerGas,
+		Mean:  new(big.Int),
+	}
+	for _, block := range blocks {
+		if block.BaseFeePerGas.Cmp(trend.Min) < 0 {
+			trend.Min = block.BaseFeePerGas
+		}
+		if block.BaseFeePerGas.Cmp(trend.Max) > 0 {
+			trend.Max = block.BaseFeePerGas
+		}
+		trend.Mean.Add(trend.Mean, block.BaseFeePerGas)
+	}
+	trend.Mean.Div(trend.Mean, big.NewInt(int64(len(blocks))))
+
+	if trend.First.Sign() > 0 {
+		change, _ := new(big.Float).Quo(
+			new(big.Float).SetInt(new(big.Int).Sub(trend.Last, trend.First)),
+			new(big.Float).SetInt(trend.First),
+		).Float64()
+		trend.Change = change * 100
+	}
+
+	return trend
+}
+
+func ratio(part, total uint64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part) / float64(total)
+}
+
+// percentileIndex returns the index of the p-th percentile in a sorted slice of length n using the nearest-rank method.
+func percentileIndex(n int, p float64) int {
+	rank := int(math.Ceil(p / 100 * float64(n)))
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > n {
+		rank = n
+	}
+	return rank - 1
+}
@@ -0,0 +1,308 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+var errBlockNotFound = errors.New("block not found")
+
+type blockParticipants struct {
+	senders    []string
+	recipients []string
+}
+
+// maxIndexedBlocks, maxIndexedTraces and maxIndexedTimestamps bound the memory held by the index, which the
+// follower feeds with every new block. Once full, the entries indexed first are evicted and fetched again
+// when needed. The first block addresses were seen in is evicted with that block.
+var (
+	maxIndexedBlocks     = 50000
+	maxIndexedTraces     = 100000
+	maxIndexedTimestamps = 100000
+)
+
+// blockIndex keeps the blocks fetched from the node in memory, keyed by number, so repeated range queries
+// only fetch the blocks not seen before. Evmos has instant finality, so indexed blocks never change.
+// It also remembers the participants of each block, the first block every address was seen in and the
+// call traces of indexed transactions and the timestamps of blocks looked up on their own, as well as the
+// earliest block the node was found to serve.
+type blockIndex struct {
+	mu             sync.RWMutex
+	blocks         map[uint64]map[string]interface{}
+	blockOrder     []uint64
+	participants   map[uint64]blockParticipants
+	firstSeen      map[string]uint64
+	traces         map[string]map[string]interface{}
+	traceOrder     []string
+	timestamps     map[uint64]uint64
+	timestampOrder []uint64
+	earliest       uint64
+}
+
+var index = newBlockIndex()
+
+func newBlockIndex() *blockIndex {
+	return &blockIndex{
+		blocks:       make(map[uint64]map[string]interface{}),
+		participants: make(map[uint64]blockParticipants),
+		firstSeen:    make(map[string]uint64),
+		traces:       make(map[string]map[string]interface{}),
+		timestamps:   make(map[uint64]uint64),
+	}
+}
+
+// blocksInRange returns the blocks between start and end in ascending order, fetching missing runs of
+// blocks through GetBlocksInRange and indexing them. Blocks evicted while the range is assembled are still
+// returned.
+func (idx *blockIndex) blocksInRange(ctx context.Context, start, end int) ([]map[string]interface{}, error) {
+	found, missingRanges := idx.lookup(start, end)
+	for _, missing := range missingRanges {
+		blocks, err := evmosClient.GetBlocksInRange(ctx, missing[0], missing[1])
+		if err != nil {
+			return nil, err
+		}
+		for number, block := range idx.add(missing[0], blocks) {
+			found[number] = block
+		}
+	}
+	if end >= start {
+		fetched := 0
+		for _, missing := range missingRanges {
+			fetched += missing[1] - missing[0] + 1
+		}
+		cacheHits.Add(float64(end-start+1-fetched), cacheBlock)
+		cacheMisses.Add(float64(fetched), cacheBlock)
+	}
+
+	blocks := make([]map[string]interface{}, 0, len(found))
+	for number := start; number <= end; number++ {
+		if block, exists := found[uint64(number)]; exists {
+			blocks = append(blocks, block)
+		}
+	}
+	return blocks, nil
+}
+
+// lookup returns the indexed blocks between start and end, and the inclusive runs of block numbers that are
+// not indexed.
+func (idx *blockIndex) lookup(start, end int) (map[uint64]map[string]interface{}, [][2]int) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	found := make(map[uint64]map[string]interface{})
+	var missing [][2]int
+	runStart := -1
+	for number := start; number <= end; number++ {
+		block, exists := idx.blocks[uint64(number)]
+		if exists {
+			found[uint64(number)] = block
+		}
+		switch {
+		case !exists && runStart < 0:
+			runStart = number
+		case exists && runStart >= 0:
+			missing = append(missing, [2]int{runStart, number - 1})
+			runStart = -1
+		}
+	}
+	if runStart >= 0 {
+		missing = append(missing, [2]int{runStart, end})
+	}
+	return found, missing
+}
+
+// add stores blocks fetched starting at start, evicting the blocks indexed first beyond maxIndexedBlocks,
+// and returns them keyed by number. Blocks are keyed by their own number when present.
+func (idx *blockIndex) add(start int, blocks []map[string]interface{}) map[uint64]map[string]interface{} {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	added := make(map[uint64]map[string]interface{}, len(blocks))
+	for i, block := range blocks {
+		if block == nil {
+			continue
+		}
+		number := uint64(start + i)
+		if _, exists := block["number"]; exists {
+			number = hexToUint64(block["number"])
+		}
+		if _, exists := idx.blocks[number]; !exists {
+			idx.blockOrder = append(idx.blockOrder, number)
+		}
+		idx.blocks[number] = block
+		added[number] = block
+	}
+	for len(idx.blockOrder) > maxIndexedBlocks {
+		number := idx.blockOrder[0]
+		idx.blockOrder = idx.blockOrder[1:]
+		delete(idx.blocks, number)
+		// the addresses first seen in the block were seen before anything still indexed
+		for _, addresses := range [][]string{idx.participants[number].senders, idx.participants[number].recipients} {
+			for _, address := range addresses {
+				if idx.firstSeen[address] == number {
+					delete(idx.firstSeen, address)
+				}
+			}
+		}
+		delete(idx.participants, number)
+	}
+	return added
+}
+
+// participantsOf returns the senders and EOA recipients of an indexed block, extracting them on first use.
+// Participants are only remembered once every lookup succeeded, so a failed or canceled request does not
+// leave an incomplete list behind for later ones, and only while the block is indexed.
+func (idx *blockIndex) participantsOf(ctx context.Context, block map[string]interface{}) (blockParticipants, error) {
+	number := hexToUint64(block["number"])
+
+	idx.mu.RLock()
+	participants, exists := idx.participants[number]
+	idx.mu.RUnlock()
+	if exists {
+		return participants, nil
+	}
+
+	senders, recipients, err := extractParticipants(ctx, block)
+	if err != nil {
+		return blockParticipants{}, err
+	}
+	participants = blockParticipants{senders: lowerAll(senders), recipients: lowerAll(recipients)}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	// participants are evicted with their block, so those of blocks evicted meanwhile are not kept
+	if _, indexed := idx.blocks[number]; !indexed {
+		return participants, nil
+	}
+	idx.participants[number] = participants
+	for _, addresses := range [][]string{participants.senders, participants.recipients} {
+		for _, address := range addresses {
+			if seen, exists := idx.firstSeen[address]; !exists || number < seen {
+				idx.firstSeen[address] = number
+			}
+		}
+	}
+	return participants, nil
+}
+
+// firstSeenBlock returns the first indexed block an address took part in.
+func (idx *blockIndex) firstSeenBlock(address string) (uint64, bool) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	number, exists := idx.firstSeen[strings.ToLower(address)]
+	return number, exists
+}
+
+func lowerAll(addresses []string) []string {
+	lowered := make([]string, len(addresses))
+	for i, address := range addresses {
+		lowered[i] = strings.ToLower(address)
+	}
+	return lowered
+}
+
+// trace returns the call trace of a transaction, fetching it from the node on first use.
+func (idx *blockIndex) trace(ctx context.Context, txHash string) (map[string]interface{}, error) {
+	idx.mu.RLock()
+	trace, exists := idx.traces[txHash]
+	idx.mu.RUnlock()
+	if exists {
+		cacheHits.Inc(cacheTrace)
+		return trace, nil
+	}
+	cacheMisses.Inc(cacheTrace)
+
+	trace, err := GetTransactionTrace(ctx, txHash)
+	if err != nil {
+		return nil, err
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if _, exists := idx.traces[txHash]; !exists {
+		idx.traceOrder = append(idx.traceOrder, txHash)
+	}
+	idx.traces[txHash] = trace
+	for len(idx.traceOrder) > maxIndexedTraces {
+		delete(idx.traces, idx.traceOrder[0])
+		idx.traceOrder = idx.traceOrder[1:]
+	}
+	return trace, nil
+}
+
+// timestamp returns the timestamp of a block, fetching the block on its own when it is not indexed.
+// Only the timestamp of such blocks is kept, so searches over the whole chain stay cheap in memory.
+func (idx *blockIndex) timestamp(ctx context.Context, number uint64) (uint64, error) {
+	idx.mu.RLock()
+	block, indexed := idx.blocks[number]
+	timestamp, cached := idx.timestamps[number]
+	idx.mu.RUnlock()
+	if indexed {
+		return hexToUint64(block["timestamp"]), nil
+	}
+	if cached {
+		return timestamp, nil
+	}
+
+	block, err := evmosClient.GetBlock(ctx, fmt.Sprintf("0x%x", number))
+	if err != nil {
+		return 0, err
+	}
+	if block == nil {
+		return 0, fmt.Errorf("%w: %d", errBlockNotFound, number)
+	}
+	timestamp = hexToUint64(block["timestamp"])
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if _, exists := idx.timestamps[number]; !exists {
+		idx.timestampOrder = append(idx.timestampOrder, number)
+	}
+	idx.timestamps[number] = timestamp
+	for len(idx.timestampOrder) > maxIndexedTimestamps {
+		delete(idx.timestamps, idx.timestampOrder[0])
+		idx.timestampOrder = idx.timestampOrder[1:]
+	}
+	return timestamp, nil
+}
+
+// earliestBlock returns the lowest block the node serves, up to latest. Pruned nodes no longer serve the oldest
+// blocks, which are reported as not found, while the blocks they keep run up to the latest one. The earliest
+// block found bounds later searches, since pruning only ever raises it.
+func (idx *blockIndex) earliestBlock(ctx context.Context, latest uint64) (uint64, error) {
+	idx.mu.RLock()
+	low := idx.earliest
+	idx.mu.RUnlock()
+	if low == 0 {
+		low = 1
+	}
+
+	_, err := idx.timestamp(ctx, low)
+	if err != nil && !errors.Is(err, errBlockNotFound) {
+		return 0, err
+	}
+	if err != nil {
+		high := latest
+		for low < high {
+			middle := low + (high-low)/2
+			_, err := idx.timestamp(ctx, middle)
+			switch {
+			case errors.Is(err, errBlockNotFound):
+				low = middle + 1
+			case err != nil:
+				return 0, err
+			default:
+				high = middle
+			}
+		}
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if low > idx.earliest {
+		idx.earliest = low
+	}
+	return low, nil
+}
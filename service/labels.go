@@ -0,0 +1,273 @@
+package service
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"onchain-stats/bech32"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Label names a known address, such as an exchange hot wallet or a bridge, and puts it in a category
+// that rankings can be filtered by.
+type Label struct {
+	Name     string `json:"name"`
+	Category string `json:"category,omitempty"`
+}
+
+type LabeledAddress struct {
+	Address string `json:"address"`
+	Label
+}
+
+var ErrLabelsNotSaved = errors.New("labels not saved")
+
+var (
+	labelsMu sync.RWMutex
+	labels   = make(map[string]Label)
+	// labelsFile is the JSON file every edit is written back to, if any.
+	labelsFile string
+)
+
+// SetLabelsFile makes SetLabel and DeleteLabel write the labels back to the JSON file at path after every edit.
+// An empty path disables writing.
+func SetLabelsFile(path string) {
+	labelsMu.Lock()
+	defer labelsMu.Unlock()
+	labelsFile = path
+}
+
+// SetLabel labels an address given in hex or evmos1 form, replacing its previous label.
+// Categories are case-insensitive and stored in lowercase. When the labels cannot be written back to the
+// labels file, the previous label is restored and an ErrLabelsNotSaved error is returned.
+func SetLabel(address string, label Label) error {
+	hexAddress, label, err := normalizeLabel(address, label)
+	if err != nil {
+		return err
+	}
+
+	labelsMu.Lock()
+	defer labelsMu.Unlock()
+	previous, existed := labels[hexAddress]
+	labels[hexAddress] = label
+	if err := saveLabels(); err != nil {
+		if existed {
+			labels[hexAddress] = previous
+		} else {
+			delete(labels, hexAddress)
+		}
+		return err
+	}
+	return nil
+}
+
+// DeleteLabel removes the label of an address, reporting whether it had one. When the labels cannot be
+// written back to the labels file, the label is restored and an ErrLabelsNotSaved error is returned.
+func DeleteLabel(address string) (bool, error) {
+	hexAddress, err := bech32.NormalizeAddress(address)
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", ErrInvalidAddress, err)
+	}
+
+	labelsMu.Lock()
+	defer labelsMu.Unlock()
+	previous, exists := labels[hexAddress]
+	if !exists {
+		return false, nil
+	}
+	delete(labels, hexAddress)
+	if err := saveLabels(); err != nil {
+		labels[hexAddress] = previous
+		return false, err
+	}
+	return true, nil
+}
+
+func normalizeLabel(address string, label Label) (string, Label, error) {
+	hexAddress, err := bech32.NormalizeAddress(address)
+	if err != nil {
+		return "", Label{}, fmt.Errorf("%w: %v", ErrInvalidAddress, err)
+	}
+	label.Name = strings.TrimSpace(label.Name)
+	if label.Name == "" {
+		return "", Label{}, fmt.Errorf("missing label name for %s", address)
+	}
+	label.Category = strings.ToLower(strings.TrimSpace(label.Category))
+	return hexAddress, label, nil
+}
+
+// GetLabels returns every labeled address, sorted by address.
+func GetLabels() []LabeledAddress {
+	labelsMu.RLock()
+	defer labelsMu.RUnlock()
+	return labeledAddresses()
+}
+
+// labeledAddresses lists the labels sorted by address. labelsMu must be held.
+func labeledAddresses() []LabeledAddress {
+	labeled := make([]LabeledAddress, 0, len(labels))
+	for address, label := range labels {
+		labeled = append(labeled, LabeledAddress{Address: address, Label: label})
+	}
+	sort.Slice(labeled, func(i, j int) bool { return labeled[i].Address < labeled[j].Address })
+	return labeled
+}
+
+// labelFor returns the label of an address, or nil when it has none.
+func labelFor(address string) *Label {
+	hexAddress, err := bech32.NormalizeAddress(address)
+	if err != nil {
+		return nil
+	}
+
+	labelsMu.RLock()
+	defer labelsMu.RUnlock()
+	label, exists := labels[hexAddress]
+	if !exists {
+		return nil
+	}
+	return &label
+}
+
+// hasCategory reports whether an address is labeled with one of the given categories.
+func hasCategory(address string, categories []string) bool {
+	label := labelFor(address)
+	if label == nil {
+		return false
+	}
+	for _, category := range categories {
+		if strings.EqualFold(label.Category, category) {
+			return true
+		}
+	}
+	return false
+}
+
+// ExcludeCategories returns the wallets not labeled with any of the given categories.
+func ExcludeCategories(wallets []WalletBalance, categories []string) []WalletBalance {
+	if len(categories) == 0 {
+		return wallets
+	}
+
+	kept := make([]WalletBalance, 0, len(wallets))
+	for _, wallet := range wallets {
+		if !hasCategory(wallet.Address, categories) {
+			kept = append(kept, wallet)
+		}
+	}
+	return kept
+}
+
+// LoadLabels loads labels from a JSON file holding an array of {"address", "name", "category"} objects, or
+// from a CSV file with address, name and category columns and an optional header row.
+func LoadLabels(path string) error {
+	file, err := os.Open(path) // #nosec G304 -- path comes from configuration
+	if err != nil {
+		return err
+	}
+	defer closeFile(file)
+
+	var entries []LabeledAddress
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		entries, err = readLabelsCSV(file)
+	} else {
+		err = json.NewDecoder(file).Decode(&entries)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	loaded := make(map[string]Label, len(entries))
+	for _, entry := range entries {
+		hexAddress, label, err := normalizeLabel(entry.Address, entry.Label)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		loaded[hexAddress] = label
+	}
+
+	labelsMu.Lock()
+	defer labelsMu.Unlock()
+	for hexAddress, label := range loaded {
+		labels[hexAddress] = label
+	}
+	return nil
+}
+
+func readLabelsCSV(r io.Reader) ([]LabeledAddress, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]LabeledAddress, 0, len(records))
+	for i, record := range records {
+		if i == 0 && strings.EqualFold(record[0], "address") {
+			continue
+		}
+		if len(record) < 2 {
+			return nil, fmt.Errorf("line %d: expected address, name and optional category", i+1)
+		}
+		entry := LabeledAddress{Address: record[0], Label: Label{Name: record[1]}}
+		if len(record) > 2 {
+			entry.Category = record[2]
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// SaveLabels writes every label to a JSON file readable by LoadLabels.
+func SaveLabels(path string) error {
+	labelsMu.RLock()
+	defer labelsMu.RUnlock()
+	return writeLabels(path)
+}
+
+// saveLabels writes the labels back to the labels file, if any. labelsMu must be held.
+func saveLabels() error {
+	if labelsFile == "" {
+		return nil
+	}
+	if err := writeLabels(labelsFile); err != nil {
+		return fmt.Errorf("%w: %v", ErrLabelsNotSaved, err)
+	}
+	return nil
+}
+
+// writeLabels writes the labels to a temporary file renamed over path, so readers never see a partial file.
+// labelsMu must be held.
+func writeLabels(path string) error {
+	data, err := json.MarshalIndent(labeledAddresses(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		closeFile(file)
+		_ = os.Remove(file.Name())
+		return err
+	}
+	if err := file.Close(); err != nil {
+		_ = os.Remove(file.Name())
+		return err
+	}
+	if err := os.Rename(file.Name(), path); err != nil {
+		_ = os.Remove(file.Name())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"onchain-stats/metrics"
+	"sync"
+	"time"
+)
+
+// Caches reported in the cache metrics.
+const (
+	cacheBlock   = "block"
+	cacheTrace   = "trace"
+	cacheBalance = "balance"
+)
+
+var (
+	cacheHits   = metrics.NewCounter("evmos_cache_hits_total", "Lookups served from the local index and caches, by cache.", "cache")
+	cacheMisses = metrics.NewCounter("evmos_cache_misses_total", "Lookups fetched from the node, by cache.", "cache")
+
+	watchErrors = metrics.NewCounter("evmos_watch_errors_total",
+		"Watches that could not be evaluated against a new block, by kind. Their alerts for the block are lost.", "kind")
+
+	workersBusy = metrics.NewGauge("evmos_worker_pool_busy", "Workers currently fetching from the node, by pool.", "pool")
+	workersSize = metrics.NewGauge("evmos_worker_pool_size", "Maximum number of concurrent workers, by pool.", "pool")
+	workersWait = metrics.NewHistogram("evmos_worker_pool_wait_seconds",
+		"Time spent waiting for a free worker, by pool. Long waits mean the pool is saturated.", metrics.DefaultBuckets, "pool")
+)
+
+func init() {
+	metrics.NewGaugeFunc("evmos_indexer_height", "Last block ingested by the follower.", func() float64 {
+		return float64(FollowedHead())
+	})
+	metrics.NewGaugeFunc("evmos_indexer_node_height", "Latest block reported by the node when the follower last synced.",
+		func() float64 {
+			chainFollower.mu.Lock()
+			defer chainFollower.mu.Unlock()
+			return float64(chainFollower.latest)
+		})
+	metrics.NewGaugeFunc("evmos_indexer_lag_blocks", "Blocks the follower is behind the node.", func() float64 {
+		chainFollower.mu.Lock()
+		defer chainFollower.mu.Unlock()
+		if chainFollower.latest <= chainFollower.head {
+			return 0
+		}
+		return float64(chainFollower.latest - chainFollower.head)
+	})
+	metrics.NewGaugeFunc("evmos_indexer_blocks", "Blocks held in the local index.", func() float64 {
+		index.mu.RLock()
+		defer index.mu.RUnlock()
+		return float64(len(index.blocks))
+	})
+}
+
+// workerPool bounds the number of goroutines fetching from the node at once.
+type workerPool struct {
+	name  string
+	slots chan struct{}
+}
+
+func newWorkerPool(name string, size int) *workerPool {
+	workersSize.Set(float64(size), name)
+	return &workerPool{name: name, slots: make(chan struct{}, size)}
+}
+
+// acquire blocks until a worker is free.
+func (p *workerPool) acquire() {
+	start := time.Now()
+	p.slots <- struct{}{}
+	workersWait.Observe(time.Since(start).Seconds(), p.name)
+	workersBusy.Add(1, p.name)
+}
+
+func (p *workerPool) release() {
+	<-p.slots
+	workersBusy.Add(-1, p.name)
+}
+
+// forEach calls fn with every item on the pool's workers and returns the first error, once the calls
+// started are done. Items not started yet when a call fails are skipped.
+func (p *workerPool) forEach(items []string, fn func(item string) error) error {
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	for _, item := range items {
+		p.acquire()
+		mu.Lock()
+		failed := firstErr != nil
+		mu.Unlock()
+		if failed {
+			p.release()
+			break
+		}
+
+		wg.Add(1)
+		go func(item string) {
+			defer wg.Done()
+			defer p.release()
+			if err := fn(item); err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		}(item)
+	}
+	wg.Wait()
+	return firstErr
+}
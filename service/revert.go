@@ -0,0 +1,87 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"onchain-stats/abi"
+)
+
+var (
+	errorMethod = abi.MustParseMethod("Error(string)")
+	panicMethod = abi.MustParseMethod("Panic(uint256)")
+)
+
+// panicReasons describes the codes Solidity passes to Panic(uint256).
+var panicReasons = map[uint64]string{
+	0x00: "generic compiler panic",
+	0x01: "assertion failed",
+	0x11: "arithmetic overflow or underflow",
+	0x12: "division or modulo by zero",
+	0x21: "invalid enum value",
+	0x22: "invalid storage byte array encoding",
+	0x31: "pop on empty array",
+	0x32: "array index out of bounds",
+	0x41: "out of memory",
+	0x51: "call to uninitialized internal function",
+}
+
+// DecodeRevertReason decodes the hex revert payload of a failed call. Error(string) payloads yield their
+// message and Panic(uint256) payloads a description of the panic code. Custom errors are rendered by
+// their signature when the selector is known and by the selector otherwise. Error(string) and Panic(uint256)
+// payloads that cannot be decoded are reported as malformed. Empty payloads yield "".
+func DecodeRevertReason(output string) string {
+	data, err := abi.FromHex(output)
+	if err != nil || len(data) == 0 {
+		return ""
+	}
+	if len(data) < 4 {
+		return "invalid revert data " + output
+	}
+
+	switch {
+	case bytes.Equal(data[:4], errorMethod.ID()):
+		values, err := errorMethod.UnpackInput(data)
+		if err != nil {
+			return "malformed Error(string)"
+		}
+		return values[0].(string)
+	case bytes.Equal(data[:4], panicMethod.ID()):
+		values, err := panicMethod.UnpackInput(data)
+		if err != nil {
+			return "malformed Panic(uint256)"
+		}
+		code := values[0].(*big.Int)
+		if reason, exists := panicReasons[code.Uint64()]; exists && code.IsUint64() {
+			return fmt.Sprintf("panic 0x%02x: %s", code, reason)
+		}
+		return fmt.Sprintf("panic 0x%02x", code)
+	}
+
+	selector := abi.ToHex(data[:4])
+	if signature := ResolveSelector(nil, selector); signature != "" {
+		return "custom error " + signature
+	}
+	return "custom error " + selector
+}
+
+// frameRevertReason returns the revert reason of a failed callTracer frame, decoded from its output or
+// taken from the revertReason some tracers add.
+func frameRevertReason(frame map[string]interface{}) string {
+	if !frameFailed(frame) {
+		return ""
+	}
+	if reason := DecodeRevertReason(stringValue(frame["output"])); reason != "" {
+		return reason
+	}
+	return stringValue(frame["revertReason"])
+}
+
+// failureReason returns why a callTracer frame failed: its revert reason when there is one and the tracer
+// error, such as "out of gas", otherwise. It returns "" for frames that succeeded.
+func failureReason(frame map[string]interface{}) string {
+	if reason := frameRevertReason(frame); reason != "" {
+		return reason
+	}
+	return stringValue(frame["error"])
+}
@@ -2,45 +2,56 @@
 package service
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
 	"math/big"
+	"onchain-stats/bech32"
 	"sort"
 	"sync"
 )
 
 type EvmosClientInterface interface {
-	GetBlockNumber() (string, error)
-	GetTransactionTrace(txHash string) (map[string]interface{}, error)
-	GetCode(address, blockNumber string) (string, error)
-	GetBlocksInRange(start, end int) ([]map[string]interface{}, error)
-	GetBalance(address, block string) (string, error)
-	GetAccounts() ([]string, error)
-	GetBlock(blockNumber string) (map[string]interface{}, error)
-}
-
-type kv struct {
-	Key   string
-	Value *big.Int
+	GetBlockNumber(ctx context.Context) (string, error)
+	GetTransactionTrace(ctx context.Context, txHash string) (map[string]interface{}, error)
+	GetCode(ctx context.Context, address, blockNumber string) (string, error)
+	GetBlocksInRange(ctx context.Context, start, end int) ([]map[string]interface{}, error)
+	GetBalance(ctx context.Context, address, block string) (string, error)
+	GetAccounts(ctx context.Context) ([]string, error)
+	GetBlock(ctx context.Context, blockNumber string) (map[string]interface{}, error)
+	Call(ctx context.Context, to, data, blockNumber string) (string, error)
+	GetLogs(ctx context.Context, address, fromBlock, toBlock string) ([]map[string]interface{}, error)
+	GetStorageAt(ctx context.Context, address, slot, blockNumber string) (string, error)
+	GetTransactionReceipt(ctx context.Context, txHash string) (map[string]interface{}, error)
+	GetFeeHistory(ctx context.Context, blockCount int, newestBlock string, rewardPercentiles []float64) (map[string]interface{}, error)
+	GetTransactionCount(ctx context.Context, address, blockNumber string) (string, error)
+	GetBalanceHistory(ctx context.Context, address string, blockNumbers []string) ([]string, error)
+	GetTransactionByHash(ctx context.Context, txHash string) (map[string]interface{}, error)
 }
 
 var evmosClient EvmosClientInterface
 
 // SetClient Utilized for testing purposes, but can be used to set a custom client
+// Since the client may point to a different chain, the local block index and followed head are reset as well.
 func SetClient(client EvmosClientInterface) {
 	evmosClient = client
+	index = newBlockIndex()
+	balances = newBalanceCache()
+	classifications = newClassificationCache()
+	chainFollower.reset()
 }
 
-func GetLatestBlock() (string, error) {
-	return evmosClient.GetBlockNumber()
+func GetLatestBlock(ctx context.Context) (string, error) {
+	return evmosClient.GetBlockNumber(ctx)
 }
 
-func GetTransactionTrace(txHash string) (map[string]interface{}, error) {
-	return evmosClient.GetTransactionTrace(txHash)
+func GetTransactionTrace(ctx context.Context, txHash string) (map[string]interface{}, error) {
+	return evmosClient.GetTransactionTrace(ctx, txHash)
 }
 
 // IsContractAddress checks if the given address is a contract address or an EOA.
-func IsContractAddress(address string) (bool, error) {
-	code, err := evmosClient.GetCode(address, "latest")
+func IsContractAddress(ctx context.Context, address string) (bool, error) {
+	code, err := evmosClient.GetCode(ctx, address, "latest")
 	if err != nil {
 		return false, err
 	}
@@ -48,175 +59,276 @@ func IsContractAddress(address string) (bool, error) {
 	return code != "0x", nil
 }
 
+// lookupContracts reports which of the addresses are contracts, looking them up concurrently.
+func lookupContracts(ctx context.Context, addresses []string) (map[string]bool, error) {
+	var mu sync.Mutex
+	contracts := make(map[string]bool, len(addresses))
+	err := newWorkerPool("contractLookups", 8).forEach(addresses, func(address string) error {
+		isContract, err := IsContractAddress(ctx, address)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		contracts[address] = isContract
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return contracts, nil
+}
+
 // ExtractSmartContracts processes a list of blocks to identify and count interactions with smart contracts.
 // It iterates through each block's transactions, checking if the transaction is a contract creation or an interaction with an existing contract.
-// It also traces internal contract calls within each transaction.
-func ExtractSmartContracts(blocks []map[string]interface{}) (map[string]int, error) {
-	contractInteractions := make(map[string]int)
+// It also traces internal contract calls within each transaction, including the ones nested in other calls.
+// Traces are read through the local index, so blocks the follower already traced are not traced again.
+// Every interaction is additionally attributed to its caller and the 4-byte method selector of its input,
+// and accumulates the value, gas and outcome reported by the trace.
+func ExtractSmartContracts(ctx context.Context, blocks []map[string]interface{}) (map[string]*ContractStats, error) {
+	contractInteractions := make(map[string]*ContractStats)
+	record := func(address string, call interaction) {
+		stats, exists := contractInteractions[address]
+		if !exists {
+			stats = newContractStats(address)
+			contractInteractions[address] = stats
+		}
+		stats.record(call)
+	}
+
 	for _, block := range blocks {
+		blockNumber := hexToUint64(block["number"])
 		transactions := block["transactions"].([]interface{})
 		for _, tx := range transactions {
 			txMap := tx.(map[string]interface{})
 			txHash := txMap["hash"].(string)
 			to := txMap["to"]
 
+			trace, err := index.trace(ctx, txHash)
+			if err != nil {
+				return nil, err
+			}
+
+			// the root frame of the trace describes the transaction itself
+			call := interaction{
+				caller:   stringValue(txMap["from"]),
+				selector: inputSelector(txMap["input"]),
+				value:    hexToBigInt(txMap["value"]),
+				gasUsed:  hexToUint64(trace["gasUsed"]),
+				failed:   frameFailed(trace),
+				reason:   failureReason(trace),
+				block:    blockNumber,
+			}
+
 			// it's a contract creation
 			if to == nil {
 				contractAddress := txMap["contractAddress"]
 				if contractAddress != nil && contractAddress != "" {
 					contractAddrStr := contractAddress.(string)
-					contractInteractions[contractAddrStr]++
+					call.selector = constructorSelector
+					record(contractAddrStr, call)
 				}
 			} else {
 				toAddress := to.(string)
-				isContract, err := IsContractAddress(toAddress)
+				isContract, err := IsContractAddress(ctx, toAddress)
 				if err != nil {
 					return nil, err
 				}
 				if isContract {
-					contractInteractions[toAddress]++
+					record(toAddress, call)
 				}
 			}
 
-			// Add internal contract interactions via transaction trace
-			trace, err := GetTransactionTrace(txHash)
-			if err != nil {
-				return nil, err
-			}
-
-			// TODO: assuming trace["calls"] is always present.
-			// Not sure since every block has empty transaction list and as such couldn't test this.
-			internalCalls := trace["calls"].([]interface{})
-			for _, call := range internalCalls {
-				callMap := call.(map[string]interface{})
-				contractAddress := callMap["to"].(string)
-				contractInteractions[contractAddress]++
-			}
+			// Add internal contract interactions via transaction trace, at every depth of the call tree
+			walkCalls(trace, func(call map[string]interface{}) {
+				contractAddress := stringValue(call["to"])
+				if contractAddress == "" {
+					return
+				}
+				record(contractAddress, frameInteraction(call, blockNumber))
+			})
 		}
 	}
 
+	for _, stats := range contractInteractions {
+		stats.finalize(contractABIFor(stats.Address))
+	}
+
 	return contractInteractions, nil
 }
 
 // ExtractWallets processes a list of blocks to identify unique wallets that have interacted with the blockchain.
 // It iterates through each block's transactions, checking the sender and receiver of each transaction.
-func ExtractWallets(blocks []map[string]interface{}) []string {
+func ExtractWallets(ctx context.Context, blocks []map[string]interface{}) ([]string, error) {
 	wallets := make(map[string]struct{})
 	for _, block := range blocks {
-		transactions := block["transactions"].([]interface{})
-		for _, tx := range transactions {
-			txMap := tx.(map[string]interface{})
+		senders, recipients, err := extractParticipants(ctx, block)
+		if err != nil {
+			return nil, err
+		}
+		for _, sender := range senders {
+			wallets[sender] = struct{}{}
+		}
+		for _, recipient := range recipients {
+			wallets[recipient] = struct{}{}
+		}
+	}
 
-			from := txMap["from"].(string)
-			if from != "" {
-				wallets[from] = struct{}{}
-			}
+	walletList := make([]string, 0, len(wallets))
+	for wallet := range wallets {
+		walletList = append(walletList, wallet)
+	}
+	return walletList, nil
+}
 
-			to := txMap["to"]
-			if to != nil && to.(string) != "" {
-				toAddress := to.(string)
+// extractParticipants returns the senders and the EOA recipients of a block's transactions, including the
+// EOAs receiving internal transfers from contracts. It fails when the code of a recipient or the trace of a
+// transaction cannot be fetched, rather than returning a partial list.
+func extractParticipants(ctx context.Context, block map[string]interface{}) (senders, recipients []string, err error) {
+	transactions := block["transactions"].([]interface{})
+	for _, tx := range transactions {
+		txMap := tx.(map[string]interface{})
+
+		from := txMap["from"].(string)
+		if from != "" {
+			senders = append(senders, from)
+		}
 
-				isContract, err := IsContractAddress(toAddress)
-				if err != nil {
-					continue
-				}
+		to := txMap["to"]
+		if to != nil && to.(string) != "" {
+			toAddress := to.(string)
 
-				// it's an EOA (not a contract)
-				if !isContract {
-					wallets[toAddress] = struct{}{}
-				}
+			isContract, err := IsContractAddress(ctx, toAddress)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			// it's an EOA (not a contract)
+			if !isContract {
+				recipients = append(recipients, toAddress)
 			}
 		}
 	}
 
-	walletList := make([]string, 0, len(wallets))
-	for wallet := range wallets {
-		walletList = append(walletList, wallet)
+	transfers, err := blockInternalTransfers(ctx, block)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, transfer := range transfers {
+		isContract, err := IsContractAddress(ctx, transfer.To)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !isContract {
+			recipients = append(recipients, transfer.To)
+		}
 	}
-	return walletList
+
+	return senders, recipients, nil
 }
 
-func GetSmartContracts(startBlock, endBlock int) ([]kv, error) {
-	blocks, err := evmosClient.GetBlocksInRange(startBlock, endBlock)
+// GetSmartContracts returns the contracts used between startBlock and endBlock, sorted in descending order
+// by the given field of ContractStats (see ContractSortFields).
+func GetSmartContracts(ctx context.Context, startBlock, endBlock int, sortBy string) ([]ContractStats, error) {
+	less, exists := contractSortFields[sortBy]
+	if !exists {
+		return nil, fmt.Errorf("%w %q, expected one of %v", ErrUnknownSortField, sortBy, ContractSortFields())
+	}
+
+	blocks, err := evmosClient.GetBlocksInRange(ctx, startBlock, endBlock)
 	if err != nil {
 		return nil, err
 	}
 
-	contractInteractions, err := ExtractSmartContracts(blocks)
+	contractInteractions, err := ExtractSmartContracts(ctx, blocks)
 	if err != nil {
 		return nil, err
 	}
 
-	// Sort contracts by number of interactions
-	var sortedContracts []kv
-	for k, v := range contractInteractions {
-		sortedContracts = append(sortedContracts, kv{k, big.NewInt(int64(v))})
+	addresses := make([]string, 0, len(contractInteractions))
+	for _, stats := range contractInteractions {
+		addresses = append(addresses, stats.Address)
+	}
+	var mu sync.Mutex
+	infos := make(map[string]ContractInfo, len(addresses))
+	endBlockNumber := fmt.Sprintf("0x%x", endBlock)
+	// contracts are classified as of the end of the range; the type only enriches the stats, so a failed
+	// lookup degrades it to a plain contract instead of failing the request
+	_ = newWorkerPool("contractClassification", 8).forEach(addresses, func(address string) error {
+		info, err := ClassifyContract(ctx, address, endBlockNumber)
+		if err != nil {
+			slog.WarnContext(ctx, "classifying contract", "address", address, "block", endBlock, "error", err)
+			info = ContractInfo{Type: ContractTypeContract}
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		infos[address] = info
+		return nil
+	})
+
+	sortedContracts := make([]ContractStats, 0, len(contractInteractions))
+	for _, stats := range contractInteractions {
+		stats.ContractInfo = infos[stats.Address]
+		stats.Bech32 = toBech32(stats.Address)
+		stats.Label = labelFor(stats.Address)
+		sortedContracts = append(sortedContracts, *stats)
 	}
 
 	sort.Slice(sortedContracts, func(i, j int) bool {
-		return sortedContracts[i].Value.Cmp(sortedContracts[j].Value) > 0
+		if cmp := less(&sortedContracts[i], &sortedContracts[j]); cmp != 0 {
+			return cmp > 0
+		}
+		return sortedContracts[i].Address < sortedContracts[j].Address
 	})
 
 	return sortedContracts, nil
 }
 
-func GetWalletBalances(wallets []string, blockNumber string) (map[string]*big.Int, error) {
-	balances := make(map[string]*big.Int)
-
-	var wg sync.WaitGroup
-	balanceChannel := make(chan kv, len(wallets))
-	workerPool := make(chan struct{}, 8) // Limit to 8 concurrent goroutines
-
-	// Parallelize balance fetching with worker pool
-	for _, wallet := range wallets {
-		wg.Add(1)
-		workerPool <- struct{}{}
-		go func(wallet string) {
-			defer wg.Done()
-			defer func() { <-workerPool }()
-
-			balance, err := evmosClient.GetBalance(wallet, blockNumber)
-			if err == nil {
-				balanceInt := new(big.Int)
-				balanceInt.SetString(balance[2:], 16) // Convert hex string to big.Int
-				balanceChannel <- kv{wallet, balanceInt}
-			}
-		}(wallet)
+// GetWalletBalances returns the balances of wallets at a block, failing when one cannot be fetched.
+func GetWalletBalances(ctx context.Context, wallets []string, block uint64) (map[string]*big.Int, error) {
+	fetched, err := walletBalancesAt(ctx, "walletBalances", wallets, []uint64{block})
+	if err != nil {
+		return nil, err
 	}
 
-	// Close the channel once all balances are fetched
-	go func() {
-		wg.Wait()
-		close(balanceChannel)
-	}()
-
-	// Collect results from channel
-	for walletBalance := range balanceChannel {
-		balances[walletBalance.Key] = walletBalance.Value
+	balances := make(map[string]*big.Int, len(fetched))
+	for wallet, walletBalances := range fetched {
+		balances[wallet] = walletBalances[0]
 	}
-
 	return balances, nil
 }
 
 // CalculateRichestUsers calculates the richest users based on their wallet balances at the end block.
 // It only needs the last block, since the last block contains the most up-to-date balances of all wallets.
-func CalculateRichestUsers(block int) ([]kv, error) {
-	blocks, err := evmosClient.GetBlocksInRange(block, block)
+// Balances are rendered in the given unit (see FormatAmount).
+func CalculateRichestUsers(ctx context.Context, block int, unit string) ([]WalletBalance, error) {
+	if _, err := FormatAmount(new(big.Int), unit); err != nil {
+		return nil, err
+	}
+
+	blocks, err := evmosClient.GetBlocksInRange(ctx, block, block)
 	if err != nil {
 		return nil, err
 	}
 
-	wallets := ExtractWallets(blocks)
-	balances, err := GetWalletBalances(wallets, fmt.Sprintf("0x%x", block))
+	wallets, err := ExtractWallets(ctx, blocks)
+	if err != nil {
+		return nil, err
+	}
+	balances, err := GetWalletBalances(ctx, wallets, uint64(block))
 
 	if err != nil {
 		return nil, err
 	}
 
 	// Sort wallets by balance
-	var sortedWallets []kv
-	for k, v := range balances {
-		sortedWallets = append(sortedWallets, kv{k, v})
+	sortedWallets := make([]WalletBalance, 0, len(balances))
+	for address, value := range balances {
+		wallet, err := newWalletBalance(address, value, unit)
+		if err != nil {
+			return nil, err
+		}
+		sortedWallets = append(sortedWallets, wallet)
 	}
 
 	sort.Slice(sortedWallets, func(i, j int) bool {
@@ -226,12 +338,18 @@ func CalculateRichestUsers(block int) ([]kv, error) {
 	return sortedWallets, nil
 }
 
-func GetAccounts() ([]string, error) {
-	return evmosClient.GetAccounts()
+func GetAccounts(ctx context.Context) ([]string, error) {
+	return evmosClient.GetAccounts(ctx)
 }
 
-func GetBalance(address, block string) (string, error) {
-	balance, err := evmosClient.GetBalance(address, block)
+// GetBalance returns the raw hex balance of an address given in hex or evmos1 bech32 form.
+func GetBalance(ctx context.Context, address, block string) (string, error) {
+	hexAddress, err := bech32.NormalizeAddress(address)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidAddress, err)
+	}
+
+	balance, err := evmosClient.GetBalance(ctx, hexAddress, block)
 	if err != nil {
 		return "", err
 	}
@@ -239,8 +357,29 @@ func GetBalance(address, block string) (string, error) {
 	return balance, nil
 }
 
-func GetBlock(blockNumber string) (map[string]interface{}, error) {
-	block, err := evmosClient.GetBlock(blockNumber)
+// GetWalletBalance returns the balance of an address given in hex or evmos1 bech32 form, rendered in the
+// given unit as well as in wei, hex and EVMOS.
+func GetWalletBalance(ctx context.Context, address, block, unit string) (*WalletBalance, error) {
+	if _, err := FormatAmount(new(big.Int), unit); err != nil {
+		return nil, err
+	}
+
+	balance, err := GetBalance(ctx, address, block)
+	if err != nil {
+		return nil, err
+	}
+
+	hexAddress, _ := bech32.NormalizeAddress(address) // already validated by GetBalance
+	wallet, err := newWalletBalance(hexAddress, hexToBigInt(balance), unit)
+	if err != nil {
+		return nil, err
+	}
+	wallet.Block = block
+	return &wallet, nil
+}
+
+func GetBlock(ctx context.Context, blockNumber string) (map[string]interface{}, error) {
+	block, err := evmosClient.GetBlock(ctx, blockNumber)
 	if err != nil {
 		return nil, err
 	}
@@ -1,8 +1,25 @@
 package service
 
 import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
 	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"onchain-stats/abi"
+	"onchain-stats/client"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -12,51 +29,150 @@ type MockEvmosClient struct {
 	block            map[string]interface{}
 	blockNumber      string
 	transactionTrace map[string]interface{}
+	traceErr         error
 	code             map[string]string
+	codeErr          error
 	blocksInRange    []map[string]interface{}
 	balances         map[string]string
+	calls            map[string]string
+	logs             []map[string]interface{}
+	storage          map[string]string
+	storageErr       error
+	receipts         map[string]map[string]interface{}
+	feeHistory       map[string]interface{}
+	blockRangeCalls  int
+	nonces           map[string]string
+	traces           map[string]map[string]interface{}
+	historicBalances map[string]string
+	balanceRequests  int
+	blocks           map[string]map[string]interface{}
+	blockAt          func(number uint64) map[string]interface{}
+	blockCalls       int
+	transactions     map[string]map[string]interface{}
+	traceCalls       int
 }
 
-func (m *MockEvmosClient) GetAccounts() ([]string, error) {
+func (m *MockEvmosClient) GetAccounts(ctx context.Context) ([]string, error) {
 	return m.accounts, nil
 }
 
-func (m *MockEvmosClient) GetBlock(blockNumber string) (map[string]interface{}, error) {
+// GetBlock returns the block keyed by its hex number in blocks, falling back to blockAt, then to block.
+func (m *MockEvmosClient) GetBlock(ctx context.Context, blockNumber string) (map[string]interface{}, error) {
+	m.blockCalls++
+	if block, exists := m.blocks[blockNumber]; exists {
+		return block, nil
+	}
+	if m.blockAt != nil {
+		return m.blockAt(hexToUint64(blockNumber)), nil
+	}
 	return m.block, nil
 }
 
-func (m *MockEvmosClient) GetBlockNumber() (string, error) {
+func (m *MockEvmosClient) GetBlockNumber(ctx context.Context) (string, error) {
 	return m.blockNumber, nil
 }
 
-func (m *MockEvmosClient) GetTransactionTrace(txHash string) (map[string]interface{}, error) {
+func (m *MockEvmosClient) GetTransactionTrace(ctx context.Context, txHash string) (map[string]interface{}, error) {
+	m.traceCalls++
+	if m.traceErr != nil {
+		return nil, m.traceErr
+	}
+	if trace, exists := m.traces[txHash]; exists {
+		return trace, nil
+	}
 	return m.transactionTrace, nil
 }
 
-func (m *MockEvmosClient) GetCode(address, blockNumber string) (string, error) {
+func (m *MockEvmosClient) GetCode(ctx context.Context, address, blockNumber string) (string, error) {
+	if m.codeErr != nil {
+		return "", m.codeErr
+	}
 	if code, exists := m.code[address]; exists {
 		return code, nil
 	}
 	return "0x", nil
 }
 
-func (m *MockEvmosClient) GetBlocksInRange(startBlock, endBlock int) ([]map[string]interface{}, error) {
+func (m *MockEvmosClient) GetBlocksInRange(ctx context.Context, startBlock, endBlock int) ([]map[string]interface{}, error) {
+	m.blockRangeCalls++
 	return m.blocksInRange, nil
 }
 
-func (m *MockEvmosClient) GetBalance(address, block string) (string, error) {
+func (m *MockEvmosClient) GetBalance(ctx context.Context, address, block string) (string, error) {
 	if balance, exists := m.balances[address]; exists {
 		return balance, nil
 	}
 	return "0x0", nil
 }
 
+// Call looks up the canned output by contract address and the full calldata or just its 4-byte selector,
+// e.g. "0xToken:0x06fdde03".
+func (m *MockEvmosClient) Call(ctx context.Context, to, data, blockNumber string) (string, error) {
+	if output, exists := m.calls[to+":"+data]; exists {
+		return output, nil
+	}
+	if output, exists := m.calls[to+":"+data[:10]]; exists {
+		return output, nil
+	}
+	return "0x", nil
+}
+
+func (m *MockEvmosClient) GetStorageAt(ctx context.Context, address, slot, blockNumber string) (string, error) {
+	if m.storageErr != nil {
+		return "", m.storageErr
+	}
+	if value, exists := m.storage[address+":"+slot]; exists {
+		return value, nil
+	}
+	return "0x0000000000000000000000000000000000000000000000000000000000000000", nil
+}
+
+func (m *MockEvmosClient) GetLogs(ctx context.Context, address, fromBlock, toBlock string) ([]map[string]interface{}, error) {
+	return m.logs, nil
+}
+
+func (m *MockEvmosClient) GetTransactionReceipt(ctx context.Context, txHash string) (map[string]interface{}, error) {
+	return m.receipts[txHash], nil
+}
+
+func (m *MockEvmosClient) GetFeeHistory(ctx context.Context, blockCount int, newestBlock string, rewardPercentiles []float64) (map[string]interface{}, error) {
+	return m.feeHistory, nil
+}
+
+func (m *MockEvmosClient) GetTransactionCount(ctx context.Context, address, blockNumber string) (string, error) {
+	if nonce, exists := m.nonces[address]; exists {
+		return nonce, nil
+	}
+	return "0x0", nil
+}
+
+// GetBalanceHistory looks up the canned balance by address and hex block number, e.g. "0xabc:0x64", falling
+// back to the balance of the address at any block, and counts the balances requested so tests can assert on
+// cache hits.
+func (m *MockEvmosClient) GetBalanceHistory(ctx context.Context, address string, blockNumbers []string) ([]string, error) {
+	result := make([]string, len(blockNumbers))
+	for i, blockNumber := range blockNumbers {
+		m.balanceRequests++
+		result[i] = "0x0"
+		if balance, exists := m.historicBalances[address+":"+blockNumber]; exists {
+			result[i] = balance
+		} else if balance, exists := m.balances[address]; exists {
+			result[i] = balance
+		}
+	}
+	return result, nil
+}
+
+func (m *MockEvmosClient) GetTransactionByHash(ctx context.Context, txHash string) (map[string]interface{}, error) {
+	return m.transactions[txHash], nil
+}
+
 func TestGetLatestBlock(t *testing.T) {
 	client := &MockEvmosClient{
 		blockNumber: "0x1",
 	}
 	SetClient(client)
-	block, err := GetLatestBlock()
+	block, err := GetLatestBlock(context.Background())
 	assert.NoError(t, err)
 	assert.Equal(t, "0x1", block)
 }
@@ -125,28 +241,147 @@ func TestGetSmartContracts(t *testing.T) {
 	}
 	SetClient(client)
 
-	expectedContracts := []kv{
-		{"0xContractAddress2", big.NewInt(9)},
-		{"0xContractAddress4", big.NewInt(3)},
-		{"0xContractAddress3", big.NewInt(2)},
-		{"0xContractAddress1", big.NewInt(2)},
+	expectedContracts := map[string]int{
+		"0xContractAddress2": 9,
+		"0xContractAddress4": 3,
+		"0xContractAddress3": 2,
+		"0xContractAddress1": 2,
 	}
 
-	contracts, err := GetSmartContracts(100, 200)
+	contracts, err := GetSmartContracts(context.Background(), 100, 200, "interactions")
 
 	assert.NoError(t, err)
 	assert.Equal(t, len(expectedContracts), len(contracts))
 
-	expectedMap := make(map[string]*big.Int)
-	for _, expectedContract := range expectedContracts {
-		expectedMap[expectedContract.Key] = expectedContract.Value
+	for _, contract := range contracts {
+		expectedValue, exists := expectedContracts[contract.Address]
+		assert.True(t, exists, "Unexpected contract: %s", contract.Address)
+		assert.Equal(t, expectedValue, contract.Interactions, "Value mismatch for contract %s", contract.Address)
+	}
+	assert.Equal(t, "0xContractAddress2", contracts[0].Address)
+
+	// a failed classification degrades the contract type instead of failing the request
+	client.storageErr = context.DeadlineExceeded
+	SetClient(client)
+	contracts, err = GetSmartContracts(context.Background(), 100, 200, "interactions")
+	assert.NoError(t, err)
+	assert.Equal(t, len(expectedContracts), len(contracts))
+	for _, contract := range contracts {
+		assert.Equal(t, ContractInfo{Type: ContractTypeContract}, contract.ContractInfo, contract.Address)
+	}
+}
+
+func TestGetSmartContractsMethodBreakdown(t *testing.T) {
+	RegisterSignature("stake(uint256)")
+
+	client := &MockEvmosClient{
+		blocksInRange: []map[string]interface{}{
+			{
+				"transactions": []interface{}{
+					map[string]interface{}{
+						"hash":  "0xTxHash1",
+						"to":    "0xToken",
+						"input": "0xa9059cbb00000000000000000000000000000000000000000000000000000000000000aa",
+					},
+					map[string]interface{}{
+						"hash":  "0xTxHash2",
+						"to":    "0xToken",
+						"input": "0xA9059CBB00000000000000000000000000000000000000000000000000000000000000bb",
+					},
+					map[string]interface{}{
+						"hash":  "0xTxHash3",
+						"to":    "0xToken",
+						"input": "0xdeadbeef",
+					},
+				},
+			},
+		},
+		transactionTrace: map[string]interface{}{
+			"calls": []interface{}{
+				map[string]interface{}{
+					"to":    "0xStaking",
+					"input": "0xa694fc3a0000000000000000000000000000000000000000000000000000000000000001",
+				},
+			},
+		},
+		code: map[string]string{
+			"0xToken":   "0x6001600101",
+			"0xStaking": "0x6001600102",
+		},
+	}
+	SetClient(client)
+
+	contracts, err := GetSmartContracts(context.Background(), 100, 200, "interactions")
+	assert.NoError(t, err)
+	assert.Len(t, contracts, 2)
+
+	assert.Equal(t, "0xStaking", contracts[0].Address)
+	assert.Equal(t, []MethodCount{{Selector: "0xa694fc3a", Signature: "stake(uint256)", Count: 3}}, contracts[0].Methods)
+
+	assert.Equal(t, "0xToken", contracts[1].Address)
+	assert.Equal(t, []MethodCount{
+		{Selector: "0xa9059cbb", Signature: "transfer(address,uint256)", Count: 2},
+		{Selector: "0xdeadbeef", Count: 1},
+	}, contracts[1].Methods)
+}
+
+func TestGetSmartContractsNestedCalls(t *testing.T) {
+	client := &MockEvmosClient{
+		blocksInRange: []map[string]interface{}{
+			{
+				"number": "0x64",
+				"transactions": []interface{}{
+					map[string]interface{}{"hash": "0xTxHash1", "from": "0xSender", "to": "0xRouter"},
+				},
+			},
+		},
+		// the router calls the pair, which calls the token at depth 2 and reverts
+		transactionTrace: map[string]interface{}{
+			"calls": []interface{}{
+				map[string]interface{}{
+					"from": "0xRouter",
+					"to":   "0xPair",
+					"calls": []interface{}{
+						map[string]interface{}{
+							"from":  "0xPair",
+							"to":    "0xToken",
+							"value": "0x2a",
+							"error": "execution reverted",
+						},
+					},
+				},
+			},
+		},
+		code: map[string]string{
+			"0xRouter": "0x6001600101",
+			"0xPair":   "0x6001600102",
+			"0xToken":  "0x6001600103",
+		},
 	}
+	SetClient(client)
 
+	contracts, err := GetSmartContracts(context.Background(), 100, 100, "interactions")
+	assert.NoError(t, err)
+	assert.Len(t, contracts, 3)
+	byAddress := make(map[string]ContractStats)
 	for _, contract := range contracts {
-		expectedValue, exists := expectedMap[contract.Key]
-		assert.True(t, exists, "Unexpected contract: %s", contract.Key)
-		assert.Equal(t, 0, expectedValue.Cmp(contract.Value), "Value mismatch for contract %s: expected %s, got %s", contract.Key, expectedValue.String(), contract.Value.String())
+		byAddress[contract.Address] = contract
 	}
+	assert.Equal(t, 1, byAddress["0xRouter"].Interactions)
+	assert.Equal(t, 1, byAddress["0xPair"].Interactions)
+	token := byAddress["0xToken"]
+	if assert.Contains(t, byAddress, "0xToken") {
+		assert.Equal(t, 1, token.Interactions)
+		assert.Equal(t, []CallerCount{{Address: "0xpair", Count: 1}}, token.TopCallers)
+		assert.Equal(t, "42", token.ValueReceived)
+		assert.Equal(t, 1, token.Reverts)
+	}
+
+	// the failure stats of the same range count the nested frame as well
+	failures, err := GetFailureStats(context.Background(), 100, 100, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, failures.InternalCalls)
+	assert.Equal(t, 1, failures.FailedInternalCalls)
 }
 
 func TestCalculateRichestUsers(t *testing.T) {
@@ -183,25 +418,1560 @@ func TestCalculateRichestUsers(t *testing.T) {
 
 	SetClient(client)
 
-	expectedWallets := []kv{
-		{"0xWallet3", big.NewInt(8)},
-		{"0xWallet1", big.NewInt(5)},
-		{"0xWallet2", big.NewInt(3)},
-		{"0xWallet4", big.NewInt(1)},
+	expectedWallets := []WalletBalance{
+		{Address: "0xWallet3", Value: big.NewInt(8)},
+		{Address: "0xWallet1", Value: big.NewInt(5)},
+		{Address: "0xWallet2", Value: big.NewInt(3)},
+		{Address: "0xWallet4", Value: big.NewInt(1)},
 	}
 
-	wallets, err := CalculateRichestUsers(200)
+	wallets, err := CalculateRichestUsers(context.Background(), 200, "wei")
 	assert.NoError(t, err)
 	assert.Equal(t, len(expectedWallets), len(wallets))
 
 	expectedMap := make(map[string]*big.Int)
 	for _, wallet := range expectedWallets {
-		expectedMap[wallet.Key] = wallet.Value
+		expectedMap[wallet.Address] = wallet.Value
 	}
 
 	for _, wallet := range wallets {
-		expectedValue, exists := expectedMap[wallet.Key]
-		assert.True(t, exists, "Unexpected wallet: %s", wallet.Key)
-		assert.Equal(t, 0, expectedValue.Cmp(wallet.Value), "Value mismatch for wallet %s: expected %s, got %s", wallet.Key, expectedValue.String(), wallet.Value.String())
+		expectedValue, exists := expectedMap[wallet.Address]
+		assert.True(t, exists, "Unexpected wallet: %s", wallet.Address)
+		assert.Equal(t, 0, expectedValue.Cmp(wallet.Value), "Value mismatch for wallet %s: expected %s, got %s", wallet.Address, expectedValue.String(), wallet.Value.String())
+	}
+}
+
+func TestGetTokenInfo(t *testing.T) {
+	ctx := context.Background()
+	encode := func(typ string, value interface{}) string {
+		encoded, err := abi.Encode([]abi.Type{mustParseType(t, typ)}, []interface{}{value})
+		assert.NoError(t, err)
+		return abi.ToHex(encoded)
+	}
+
+	client := &MockEvmosClient{
+		calls: map[string]string{
+			"0xToken:0x06fdde03": encode("string", "Wrapped Evmos"),
+			"0xToken:0x95d89b41": encode("string", "WEVMOS"),
+			"0xToken:0x313ce567": encode("uint8", 18),
+			"0xToken:0x18160ddd": encode("uint256", big.NewInt(1000)),
+			"0xToken:0x70a08231": encode("uint256", big.NewInt(42)),
+		},
+	}
+	SetClient(client)
+
+	info, err := GetTokenInfo(ctx, "0xToken", "latest")
+	assert.NoError(t, err)
+	assert.Equal(t, "Wrapped Evmos", info.Name)
+	assert.Equal(t, "WEVMOS", info.Symbol)
+	assert.Equal(t, uint8(18), info.Decimals)
+	assert.Equal(t, 0, big.NewInt(1000).Cmp(info.TotalSupply))
+
+	balance, err := GetTokenBalance(ctx, "0xToken", "0x00000000000000000000000000000000000000aa", "latest")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, big.NewInt(42).Cmp(balance))
+}
+
+func mustParseType(t *testing.T, s string) abi.Type {
+	typ, err := abi.ParseType(s)
+	assert.NoError(t, err)
+	return typ
+}
+
+func TestLoadABIDir(t *testing.T) {
+	const token = "0x00000000000000000000000000000000000000de"
+	dir := t.TempDir()
+	abiJSON := []byte(`[{"type":"function","name":"totalSupply","inputs":[],"outputs":[{"name":"","type":"uint256"}]}]`)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "package.json"), []byte(`{"name": "abis"}`), 0o600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, token+".json"), abiJSON, 0o600))
+
+	// files not named after an address are skipped rather than aborting the load
+	assert.NoError(t, LoadABIDir(dir))
+	_, registered := GetContractABI(token)
+	assert.True(t, registered)
+}
+
+func TestGetDecodedEvents(t *testing.T) {
+	ctx := context.Background()
+	erc20ABI := `[
+		{"type":"event","name":"Transfer","anonymous":false,"inputs":[
+			{"name":"from","type":"address","indexed":true},
+			{"name":"to","type":"address","indexed":true},
+			{"name":"value","type":"uint256","indexed":false}]},
+		{"type":"function","name":"balanceOf","inputs":[{"name":"owner","type":"address"}],"outputs":[{"name":"","type":"uint256"}]}
+	]`
+	const token = "0x00000000000000000000000000000000000000cc"
+	assert.NoError(t, RegisterABI(toBech32(token), []byte(erc20ABI)))
+
+	client := &MockEvmosClient{
+		logs: []map[string]interface{}{
+			{
+				"address":         token,
+				"blockNumber":     "0x64",
+				"transactionHash": "0xTxHash1",
+				"logIndex":        "0x1",
+				"topics": []interface{}{
+					"0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef",
+					"0x00000000000000000000000000000000000000000000000000000000000000aa",
+					"0x00000000000000000000000000000000000000000000000000000000000000bb",
+				},
+				"data": "0x00000000000000000000000000000000000000000000000000000000000003e8",
+			},
+			{
+				"address":         token,
+				"blockNumber":     "0x65",
+				"transactionHash": "0xTxHash2",
+				"logIndex":        "0x0",
+				"topics":          []interface{}{"0x0000000000000000000000000000000000000000000000000000000000000001"},
+				"data":            "0x",
+			},
+		},
+	}
+	SetClient(client)
+
+	events, err := GetDecodedEvents(ctx, "0x00000000000000000000000000000000000000CC", 100, 200)
+	assert.NoError(t, err)
+	assert.Len(t, events, 1)
+	assert.Equal(t, "Transfer", events[0].Event)
+	assert.Equal(t, "Transfer(address,address,uint256)", events[0].Signature)
+	assert.Equal(t, uint64(100), events[0].BlockNumber)
+	assert.Equal(t, uint64(1), events[0].LogIndex)
+	assert.Equal(t, "0x00000000000000000000000000000000000000aa", events[0].Args["from"])
+	assert.Equal(t, "0x00000000000000000000000000000000000000bb", events[0].Args["to"])
+	assert.Equal(t, "1000", events[0].Args["value"])
+
+	_, err = GetDecodedEvents(ctx, "0x00000000000000000000000000000000000000dd", 100, 200)
+	assert.Error(t, err)
+
+	_, err = GetDecodedEvents(ctx, "0xUnknown", 100, 200)
+	assert.ErrorIs(t, err, ErrInvalidAddress)
+}
+
+func TestClassifyContract(t *testing.T) {
+	// dispatcher style bytecode: PUSH4 <selector> for every ERC-20 function
+	var erc20Code []byte
+	for _, signature := range []string{"totalSupply()", "balanceOf(address)", "transfer(address,uint256)",
+		"transferFrom(address,address,uint256)", "approve(address,uint256)", "allowance(address,address)"} {
+		erc20Code = append(erc20Code, 0x63)
+		erc20Code = append(erc20Code, abi.Selector(signature)...)
+		erc20Code = append(erc20Code, 0x14)
 	}
+	// a selector pushed by the very last instruction of the code counts as well
+	trailingCode := erc20Code[:len(erc20Code)-1]
+	// while a PUSH4 cut short by the end of the code is ignored
+	truncatedCode := append(append([]byte{}, erc20Code...), 0x63, 0x01, 0x02)
+	// the transfer selector hidden inside PUSH32 data must not be picked up
+	partialCode := append([]byte{0x7f}, make([]byte, 32)...)
+	copy(partialCode[1:], append([]byte{0x63}, abi.Selector("transfer(address,uint256)")...))
+
+	minimalProxy := "0x363d3d373d3d3d363d73" + "bebebebebebebebebebebebebebebebebebebebe" + "5af43d82803e903d91602b57fd5bf3"
+
+	boolWord := func(b bool) string {
+		encoded, err := abi.Encode([]abi.Type{mustParseType(t, "bool")}, []interface{}{b})
+		assert.NoError(t, err)
+		return abi.ToHex(encoded)
+	}
+	supportsCall := func(interfaceID string) string {
+		return "0x01ffc9a7" + interfaceID + strings.Repeat("0", 56)
+	}
+
+	client := &MockEvmosClient{
+		code: map[string]string{
+			"0xToken":     abi.ToHex(erc20Code),
+			"0xTrailing":  abi.ToHex(trailingCode),
+			"0xTruncated": abi.ToHex(truncatedCode),
+			"0xPartial":   abi.ToHex(partialCode),
+			"0xNFT":       "0x6001",
+			"0xClone":     minimalProxy,
+			"0xbebebebebebebebebebebebebebebebebebebebe": abi.ToHex(erc20Code),
+			"0xUpgradeable": "0x6002",
+			"0xBeaconProxy": "0x6003",
+		},
+		calls: map[string]string{
+			"0xNFT:" + supportsCall("01ffc9a7"): boolWord(true),
+			"0xNFT:" + supportsCall("ffffffff"): boolWord(false),
+			"0xNFT:" + supportsCall("80ac58cd"): boolWord(true),
+		},
+		storage: map[string]string{
+			"0xUpgradeable:" + eip1967ImplementationSlot: "0x000000000000000000000000ABABABABABABABABABABABABABABABABABABABAB",
+			// the beacon has no code, so its implementation() call fails
+			"0xBeaconProxy:" + eip1967BeaconSlot: "0x000000000000000000000000CDCDCDCDCDCDCDCDCDCDCDCDCDCDCDCDCDCDCDCD",
+		},
+	}
+	SetClient(client)
+
+	tests := map[string]ContractInfo{
+		"0xToken":       {Type: ContractTypeERC20},
+		"0xTrailing":    {Type: ContractTypeERC20},
+		"0xTruncated":   {Type: ContractTypeERC20},
+		"0xPartial":     {Type: ContractTypeContract},
+		"0xNFT":         {Type: ContractTypeERC721},
+		"0xClone":       {Type: ContractTypeProxy, Implementation: "0xbebebebebebebebebebebebebebebebebebebebe", ImplementationType: ContractTypeERC20},
+		"0xUpgradeable": {Type: ContractTypeProxy, Implementation: "0xabababababababababababababababababababab"},
+		"0xBeaconProxy": {Type: ContractTypeProxy},
+		"0xWallet":      {Type: ContractTypeEOA},
+	}
+	for address, expected := range tests {
+		info, err := ClassifyContract(context.Background(), address, "latest")
+		assert.NoError(t, err)
+		assert.Equal(t, expected, info, address)
+	}
+
+	// classifications at a block number are cached, those at a tag are not
+	info, err := ClassifyContract(context.Background(), "0xToken", "0x10")
+	assert.NoError(t, err)
+	assert.Equal(t, ContractInfo{Type: ContractTypeERC20}, info)
+	client.code["0xToken"] = "0x6001"
+	info, err = ClassifyContract(context.Background(), "0xToken", "0x10")
+	assert.NoError(t, err)
+	assert.Equal(t, ContractInfo{Type: ContractTypeERC20}, info)
+	info, err = ClassifyContract(context.Background(), "0xToken", "latest")
+	assert.NoError(t, err)
+	assert.Equal(t, ContractInfo{Type: ContractTypeContract}, info)
+
+	// failed lookups are not cached
+	client.storageErr = context.DeadlineExceeded
+	_, err = ClassifyContract(context.Background(), "0xUpgradeable", "0x10")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	client.storageErr = nil
+	info, err = ClassifyContract(context.Background(), "0xUpgradeable", "0x10")
+	assert.NoError(t, err)
+	assert.Equal(t, ContractTypeProxy, info.Type)
+}
+
+func TestGetSmartContractsMetrics(t *testing.T) {
+	ctx := context.Background()
+	client := &MockEvmosClient{
+		blocksInRange: []map[string]interface{}{
+			{
+				"number": "0x64",
+				"transactions": []interface{}{
+					map[string]interface{}{"hash": "0xTxHash1", "from": "0xAlice", "to": "0xVault", "value": "0x10"},
+					map[string]interface{}{"hash": "0xTxHash2", "from": "0xAlice", "to": "0xVault", "value": "0x5"},
+				},
+			},
+			{
+				"number": "0x66",
+				"transactions": []interface{}{
+					map[string]interface{}{"hash": "0xTxHash3", "from": "0xBob", "to": "0xVault", "value": "0x0"},
+					map[string]interface{}{"hash": "0xTxHash4", "from": "0xCarol", "to": "0xRouter", "value": "0x0"},
+				},
+			},
+		},
+		transactionTrace: map[string]interface{}{
+			"gasUsed": "0x5208",
+			"error":   "execution reverted",
+			"calls":   []interface{}{},
+		},
+		code: map[string]string{
+			"0xVault":  "0x6001",
+			"0xRouter": "0x6002",
+		},
+	}
+	SetClient(client)
+
+	contracts, err := GetSmartContracts(ctx, 100, 102, "valueReceived")
+	assert.NoError(t, err)
+	assert.Len(t, contracts, 2)
+
+	vault := contracts[0]
+	assert.Equal(t, "0xVault", vault.Address)
+	assert.Equal(t, 3, vault.Interactions)
+	assert.Equal(t, 2, vault.UniqueCallers)
+	assert.Equal(t, "21", vault.ValueReceived)
+	assert.Equal(t, uint64(3*0x5208), vault.GasUsed)
+	assert.Equal(t, 0, vault.Successes)
+	assert.Equal(t, 3, vault.Reverts)
+	assert.Equal(t, []ReasonCount{{Reason: "execution reverted", Count: 3}}, vault.RevertReasons)
+	assert.Equal(t, uint64(100), vault.FirstSeenBlock)
+	assert.Equal(t, uint64(102), vault.LastSeenBlock)
+	assert.Equal(t, []CallerCount{{"0xalice", 2}, {"0xbob", 1}}, vault.TopCallers)
+
+	contracts, err = GetSmartContracts(ctx, 100, 102, "firstSeenBlock")
+	assert.NoError(t, err)
+	assert.Equal(t, "0xRouter", contracts[0].Address)
+
+	_, err = GetSmartContracts(ctx, 100, 102, "bogus")
+	assert.ErrorIs(t, err, ErrUnknownSortField)
+}
+
+func TestGetGasStats(t *testing.T) {
+	client := &MockEvmosClient{
+		blocksInRange: []map[string]interface{}{
+			{
+				"number":   "0x64",
+				"gasUsed":  "0x7530",
+				"gasLimit": "0xea60",
+				"transactions": []interface{}{
+					map[string]interface{}{"hash": "0xTxHash1", "gasPrice": "0x64"},
+					map[string]interface{}{"hash": "0xTxHash2", "maxFeePerGas": "0x12c", "maxPriorityFeePerGas": "0xa"},
+				},
+			},
+			{
+				"number":       "0x65",
+				"gasUsed":      "0x0",
+				"gasLimit":     "0xea60",
+				"transactions": []interface{}{},
+			},
+		},
+		receipts: map[string]map[string]interface{}{
+			"0xTxHash1": {"gasUsed": "0x5208"},
+			"0xTxHash2": {"gasUsed": "0x2710", "effectiveGasPrice": "0xc8"},
+		},
+		feeHistory: map[string]interface{}{
+			"oldestBlock":   "0x64",
+			"baseFeePerGas": []interface{}{"0x64", "0x5a", "0x51"},
+		},
+	}
+	SetClient(client)
+
+	stats, err := GetGasStats(context.Background(), 100, 101)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, stats.Transactions)
+	assert.Equal(t, uint64(30000), stats.TotalGasUsed)
+	assert.Equal(t, uint64(120000), stats.TotalGasLimit)
+	assert.InDelta(t, 0.25, stats.Utilization, 1e-9)
+	assert.InDelta(t, 0.5, stats.Blocks[0].Utilization, 1e-9)
+
+	// 21000 gas at 100 plus 10000 gas at 200
+	assert.Equal(t, "4100000", stats.TotalFees)
+	assert.Equal(t, 0, big.NewInt(100).Cmp(stats.GasPricePercentiles["p50"]))
+	assert.Equal(t, 0, big.NewInt(200).Cmp(stats.GasPricePercentiles["p90"]))
+
+	assert.Equal(t, 0, big.NewInt(100).Cmp(stats.BaseFee.First))
+	assert.Equal(t, 0, big.NewInt(90).Cmp(stats.BaseFee.Last))
+	assert.InDelta(t, -10.0, stats.BaseFee.Change, 1e-9)
+}
+
+func TestCalculateChainStats(t *testing.T) {
+	tx := map[string]interface{}{"hash": "0xTxHash"}
+	blocks := []map[string]interface{}{
+		{"number": "0x64", "timestamp": "0x3e8", "transactions": []interface{}{tx, tx}},
+		{"number": "0x65", "timestamp": "0x3ea", "transactions": []interface{}{}},
+		{"number": "0x66", "timestamp": "0x3ec", "transactions": []interface{}{}},
+		{"number": "0x67", "timestamp": "0x3ee", "transactions": []interface{}{tx}},
+		{"number": "0x68", "timestamp": "0x3fa", "transactions": []interface{}{tx, tx, tx}},
+	}
+
+	stats := CalculateChainStats(100, 104, blocks)
+	assert.Equal(t, 5, stats.Blocks)
+	assert.Equal(t, 6, stats.Transactions)
+	assert.Equal(t, 3, stats.MaxTxPerBlock)
+	assert.InDelta(t, 1.2, stats.TxPerBlock, 1e-9)
+	// 4 transactions after the first block over 18 seconds
+	assert.InDelta(t, 4.0/18.0, stats.TPS, 1e-9)
+	assert.InDelta(t, 4.5, stats.BlockTime.Mean, 1e-9)
+	assert.Equal(t, uint64(2), stats.BlockTime.P50)
+	assert.Equal(t, uint64(12), stats.BlockTime.Max)
+	assert.Equal(t, 2, stats.EmptyBlocks)
+	assert.InDelta(t, 0.4, stats.EmptyBlockRatio, 1e-9)
+	assert.Equal(t, 2, stats.LongestEmptyStreak)
+	assert.Equal(t, []BlockGap{{Block: 104, Seconds: 12}}, stats.Gaps)
+}
+
+func TestGetActiveAddresses(t *testing.T) {
+	ctx := context.Background()
+	const day = 86400
+	block := func(number, timestamp int, txs ...map[string]interface{}) map[string]interface{} {
+		transactions := make([]interface{}, len(txs))
+		for i, tx := range txs {
+			transactions[i] = tx
+		}
+		return map[string]interface{}{
+			"number":       fmt.Sprintf("0x%x", number),
+			"timestamp":    fmt.Sprintf("0x%x", timestamp),
+			"transactions": transactions,
+		}
+	}
+	tx := func(from, to string) map[string]interface{} {
+		return map[string]interface{}{"hash": "0xTxHash", "from": from, "to": to}
+	}
+
+	client := &MockEvmosClient{
+		blocksInRange: []map[string]interface{}{
+			block(100, 10*day+10, tx("0xAlice", "0xBob"), tx("0xAlice", "0xContract")),
+			block(101, 10*day+20, tx("0xCarol", "0xBob")),
+			block(102, 12*day+5, tx("0xBob", "0xDave"), tx("0xalice", "0xCarol")),
+		},
+		code: map[string]string{"0xContract": "0x6001"},
+	}
+	SetClient(client)
+
+	series, err := GetActiveAddresses(ctx, 100, 102, "day")
+	assert.NoError(t, err)
+	assert.Equal(t, []ActiveAddressBucket{
+		{Start: time.Unix(10*day, 0).UTC(), Blocks: 2, Senders: 2, Recipients: 1, Active: 3, New: 3},
+		{Start: time.Unix(11*day, 0).UTC()},
+		{Start: time.Unix(12*day, 0).UTC(), Blocks: 1, Senders: 2, Recipients: 2, Active: 4, New: 1},
+	}, series)
+
+	// the second query is served from the local index
+	_, err = GetActiveAddresses(ctx, 100, 102, "hour")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, client.blockRangeCalls)
+
+	_, err = GetActiveAddresses(ctx, 100, 102, "week")
+	assert.ErrorIs(t, err, ErrUnknownInterval)
+}
+
+func TestGetAddressInfo(t *testing.T) {
+	ctx := context.Background()
+	const alice = "0x14574a6dff2ddf9e07828b4345d3040919af5652"
+	client := &MockEvmosClient{
+		blocksInRange: []map[string]interface{}{
+			{
+				"number": "0x64",
+				"transactions": []interface{}{
+					map[string]interface{}{"hash": "0xTxHash1", "from": alice, "to": "0xBob", "value": "0x1"},
+					map[string]interface{}{"hash": "0xTxHash2", "from": "0xCarol", "to": "0xRouter", "value": "0x0"},
+				},
+			},
+			{
+				"number": "0x65",
+				"transactions": []interface{}{
+					map[string]interface{}{"hash": "0xTxHash3", "from": "0xBob", "to": "0xDave", "value": "0x0"},
+				},
+			},
+		},
+		traces: map[string]map[string]interface{}{
+			"0xTxHash2": {
+				"calls": []interface{}{
+					map[string]interface{}{
+						"type": "CALL", "from": "0xRouter", "to": "0xPool", "value": "0x0",
+						"calls": []interface{}{
+							map[string]interface{}{"type": "CALL", "from": "0xPool", "to": alice, "value": "0x5"},
+							map[string]interface{}{"type": "CALL", "from": "0xPool", "to": alice, "value": "0x7", "error": "execution reverted"},
+						},
+					},
+				},
+			},
+		},
+		balances: map[string]string{alice: "0x64"},
+		nonces:   map[string]string{alice: "0x3"},
+	}
+	SetClient(client)
+
+	info, err := GetAddressInfo(ctx, "evmos1z3t55m0l9h0eupuz3dp5t5cypyv674jj7mz2jw", 100, 101, 1, 25, "wei")
+	assert.NoError(t, err)
+	assert.Equal(t, alice, info.Address)
+	assert.Equal(t, "evmos1z3t55m0l9h0eupuz3dp5t5cypyv674jj7mz2jw", info.Bech32)
+	assert.Equal(t, "100", info.Balance)
+	assert.False(t, info.IsContract)
+	assert.Equal(t, uint64(3), info.TransactionCount)
+	assert.Equal(t, 3, info.TotalActivity)
+	assert.Equal(t, "5", info.InternalReceived)
+	assert.Equal(t, "0", info.InternalSent)
+
+	// the reverted frame did not move its value
+	assert.Equal(t, ActivityInternalCall, info.Activity[0].Kind)
+	assert.True(t, info.Activity[0].Failed)
+	assert.Equal(t, ActivityInternalTransfer, info.Activity[1].Kind)
+	assert.Equal(t, "0xTxHash2", info.Activity[1].TxHash)
+	assert.Equal(t, "0xPool", info.Activity[1].From)
+	assert.Equal(t, "5", info.Activity[1].Value)
+	assert.Equal(t, ActivityTransaction, info.Activity[2].Kind)
+	assert.Equal(t, "0xTxHash1", info.Activity[2].TxHash)
+
+	page, err := GetAddressInfo(ctx, alice, 100, 101, 2, 1, "wei")
+	assert.NoError(t, err)
+	assert.Equal(t, []AddressActivity{info.Activity[1]}, page.Activity)
+
+	// amounts are rendered in the requested unit
+	info, err = GetAddressInfo(ctx, alice, 100, 101, 1, 25, "hex")
+	assert.NoError(t, err)
+	assert.Equal(t, "0x64", info.Balance)
+	assert.Equal(t, "0x5", info.InternalReceived)
+	assert.Equal(t, "0x5", info.Activity[1].Value)
+
+	_, err = GetAddressInfo(ctx, alice, 100, 101, 1, 25, "gwei")
+	assert.ErrorIs(t, err, ErrUnknownUnit)
+
+	_, err = GetAddressInfo(ctx, "0xnotanaddress", 100, 101, 1, 25, "wei")
+	assert.ErrorIs(t, err, ErrInvalidAddress)
+}
+
+func TestBech32Addresses(t *testing.T) {
+	ctx := context.Background()
+	const alice = "0x14574a6dff2ddf9e07828b4345d3040919af5652"
+	const contract = "0x00000000000000000000000000000000000000cc"
+	client := &MockEvmosClient{
+		blocksInRange: []map[string]interface{}{
+			{
+				"transactions": []interface{}{
+					map[string]interface{}{"hash": "0xTxHash1", "from": alice, "to": contract},
+				},
+			},
+		},
+		transactionTrace: map[string]interface{}{"calls": []interface{}{}},
+		code:             map[string]string{contract: "0x6001"},
+		balances:         map[string]string{alice: "0x64"},
+	}
+	SetClient(client)
+
+	balance, err := GetBalance(ctx, "evmos1z3t55m0l9h0eupuz3dp5t5cypyv674jj7mz2jw", "latest")
+	assert.NoError(t, err)
+	assert.Equal(t, "0x64", balance)
+
+	_, err = GetBalance(ctx, "evmos1invalid", "latest")
+	assert.ErrorIs(t, err, ErrInvalidAddress)
+
+	wallets, err := CalculateRichestUsers(ctx, 200, "wei")
+	assert.NoError(t, err)
+	assert.Equal(t, "evmos1z3t55m0l9h0eupuz3dp5t5cypyv674jj7mz2jw", wallets[0].Bech32)
+
+	contracts, err := GetSmartContracts(ctx, 100, 200, "interactions")
+	assert.NoError(t, err)
+	assert.Equal(t, toBech32(contract), contracts[0].Bech32)
+	assert.NotEmpty(t, contracts[0].Bech32)
+}
+
+func TestGetBalanceHistory(t *testing.T) {
+	ctx := context.Background()
+	alice := "0x14574a6dff2ddf9e07828b4345d3040919af5652"
+	client := &MockEvmosClient{
+		historicBalances: map[string]string{
+			alice + ":0x64": "0x64",  // 100
+			alice + ":0x6e": "0x96",  // 150
+			alice + ":0x78": "0x50",  // 80
+			alice + ":0x7d": "0x190", // 400
+		},
+	}
+	SetClient(client)
+
+	history, err := GetBalanceHistory(ctx, "evmos1z3t55m0l9h0eupuz3dp5t5cypyv674jj7mz2jw", 100, 125, 10, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, alice, history.Address)
+	assert.Len(t, history.Points, 4)
+
+	expected := []struct {
+		block   uint64
+		balance int64
+		delta   int64
+	}{{100, 100, 0}, {110, 150, 50}, {120, 80, -70}, {125, 400, 320}}
+	for i, point := range history.Points {
+		assert.Equal(t, expected[i].block, point.Block)
+		assert.Equal(t, NewAmount(big.NewInt(expected[i].balance)), point.Balance)
+		assert.Equal(t, NewAmount(big.NewInt(expected[i].delta)), point.Delta)
+		assert.Nil(t, point.Timestamp)
+	}
+	assert.Equal(t, 4, client.balanceRequests)
+
+	// overlapping samples are served from the cache
+	_, err = GetBalanceHistory(ctx, alice, 100, 130, 10, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, client.balanceRequests)
+
+	_, err = GetBalanceHistory(ctx, alice, 0, 100000, 1, 0)
+	assert.ErrorIs(t, err, ErrTooManyPoints)
+
+	_, err = GetBalanceHistory(ctx, "not-an-address", 100, 125, 10, 0)
+	assert.ErrorIs(t, err, ErrInvalidAddress)
+}
+
+func TestGetBalanceHistoryByTime(t *testing.T) {
+	alice := "0x14574a6dff2ddf9e07828b4345d3040919af5652"
+	client := &MockEvmosClient{
+		blocks: map[string]map[string]interface{}{
+			"0x64":  {"number": "0x64", "timestamp": "0xe10"},   // 3600
+			"0x65":  {"number": "0x65", "timestamp": "0xe1a"},   // 3610
+			"0x66":  {"number": "0x66", "timestamp": "0x1c20"},  // 7200
+			"0x67":  {"number": "0x67", "timestamp": "0x1c2a"},  // 7210
+			"0x68":  {"number": "0x68", "timestamp": "0x1c34"},  // 7220
+			"0x7d0": {"number": "0x7d0", "timestamp": "0x4e20"}, // 20000
+		},
+		historicBalances: map[string]string{alice + ":0x66": "0xa"},
+	}
+	SetClient(client)
+
+	// the range is rejected from the timestamps of its ends, before any block of it is fetched
+	_, err := GetBalanceHistory(context.Background(), alice, 100, 2000, 1, time.Second)
+	assert.ErrorIs(t, err, ErrTooManyPoints)
+	assert.Equal(t, 0, client.blockRangeCalls)
+
+	history, err := GetBalanceHistory(context.Background(), alice, 100, 104, 1, time.Hour)
+	assert.NoError(t, err)
+	assert.Len(t, history.Points, 3)
+	assert.Equal(t, []uint64{100, 102, 104}, []uint64{history.Points[0].Block, history.Points[1].Block, history.Points[2].Block})
+	assert.Equal(t, time.Unix(7200, 0).UTC(), *history.Points[1].Timestamp)
+	assert.Equal(t, "10", history.Points[1].Delta.Wei)
+	assert.Equal(t, "-10", history.Points[2].Delta.Wei)
+	assert.Equal(t, 0, client.blockRangeCalls)
+
+	// over a long range only the blocks visited by the binary searches are fetched: 20M blocks of 2 seconds
+	// sampled every 30 days take 16 searches
+	client = &MockEvmosClient{blockAt: func(number uint64) map[string]interface{} {
+		return map[string]interface{}{"number": fmt.Sprintf("0x%x", number), "timestamp": fmt.Sprintf("0x%x", 2*number)}
+	}}
+	SetClient(client)
+	history, err = GetBalanceHistory(context.Background(), alice, 0, 20000000, 1, 720*time.Hour)
+	assert.NoError(t, err)
+	assert.Len(t, history.Points, 17)
+	assert.Equal(t, uint64(1296000), history.Points[1].Block)
+	assert.Equal(t, 0, client.blockRangeCalls)
+	assert.Less(t, client.blockCalls, 17*26)
+}
+
+func TestGetBalanceChanges(t *testing.T) {
+	ctx := context.Background()
+	wallets := []string{
+		"0x1000000000000000000000000000000000000001",
+		"0x1000000000000000000000000000000000000002",
+		"0x1000000000000000000000000000000000000003",
+		"0x1000000000000000000000000000000000000004",
+		"0x1000000000000000000000000000000000000005",
+	}
+	client := &MockEvmosClient{
+		blocksInRange: []map[string]interface{}{
+			{"number": "0x64", "transactions": []interface{}{
+				map[string]interface{}{"hash": "0xTxHash1", "from": wallets[0], "to": wallets[1]},
+				map[string]interface{}{"hash": "0xTxHash2", "from": wallets[2], "to": wallets[3]},
+			}},
+			{"number": "0x65", "transactions": []interface{}{
+				map[string]interface{}{"hash": "0xTxHash3", "from": wallets[4], "to": wallets[0]},
+			}},
+		},
+		historicBalances: map[string]string{
+			wallets[0] + ":0x64": "0x64", wallets[0] + ":0x65": "0x96", // +50, +50%
+			wallets[1] + ":0x64": "0xa", wallets[1] + ":0x65": "0x28", // +30, +300%
+			wallets[2] + ":0x64": "0x3e8", wallets[2] + ":0x65": "0x320", // -200, -20%
+			wallets[3] + ":0x64": "0x0", wallets[3] + ":0x65": "0x64", // +100, no percentage
+			wallets[4] + ":0x64": "0x5", wallets[4] + ":0x65": "0x5", // unchanged
+		},
+	}
+	SetClient(client)
+
+	changes, err := GetBalanceChanges(ctx, 100, 101, "absolute", 10, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, changes.Wallets)
+	assert.Len(t, changes.Gainers, 3)
+	assert.Equal(t, []string{wallets[3], wallets[0], wallets[1]}, []string{changes.Gainers[0].Address, changes.Gainers[1].Address, changes.Gainers[2].Address})
+	assert.Nil(t, changes.Gainers[0].ChangePercent)
+	assert.Len(t, changes.Losers, 1)
+	assert.Equal(t, Amount{Wei: "-200", Hex: "-0xc8", Evmos: "-0.0000000000000002"}, changes.Losers[0].Change)
+	assert.InDelta(t, -20.0, *changes.Losers[0].ChangePercent, 1e-9)
+
+	changes, err = GetBalanceChanges(ctx, 100, 101, "percent", 2, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{wallets[1], wallets[0]}, []string{changes.Gainers[0].Address, changes.Gainers[1].Address})
+	assert.InDelta(t, 300.0, *changes.Gainers[0].ChangePercent, 1e-9)
+
+	_, err = GetBalanceChanges(ctx, 100, 101, "volume", 10, nil)
+	assert.ErrorIs(t, err, ErrUnknownSortField)
+}
+
+func TestFormatAmount(t *testing.T) {
+	wei, _ := new(big.Int).SetString("1500000000000000000", 10)
+	tests := []struct {
+		amount *big.Int
+		unit   string
+		want   string
+	}{
+		{wei, "wei", "1500000000000000000"},
+		{wei, "aevmos", "1500000000000000000"},
+		{wei, "evmos", "1.5"},
+		{wei, "hex", "0x14d1120d7b160000"},
+		{big.NewInt(1), "evmos", "0.000000000000000001"},
+		{big.NewInt(0), "evmos", "0"},
+		{new(big.Int).Mul(big.NewInt(-12), big.NewInt(1e18)), "evmos", "-12"},
+		{big.NewInt(-255), "hex", "-0xff"},
+	}
+	for _, test := range tests {
+		got, err := FormatAmount(test.amount, test.unit)
+		assert.NoError(t, err)
+		assert.Equal(t, test.want, got, "%s in %s", test.amount, test.unit)
+	}
+
+	_, err := FormatAmount(wei, "gwei")
+	assert.ErrorIs(t, err, ErrUnknownUnit)
+}
+
+func TestGetWalletBalance(t *testing.T) {
+	ctx := context.Background()
+	alice := "0x14574a6dff2ddf9e07828b4345d3040919af5652"
+	client := &MockEvmosClient{
+		balances: map[string]string{alice: "0x14d1120d7b160000"},
+	}
+	SetClient(client)
+
+	balance, err := GetWalletBalance(ctx, "evmos1z3t55m0l9h0eupuz3dp5t5cypyv674jj7mz2jw", "latest", "evmos")
+	assert.NoError(t, err)
+	assert.Equal(t, &WalletBalance{
+		Address: alice,
+		Bech32:  "evmos1z3t55m0l9h0eupuz3dp5t5cypyv674jj7mz2jw",
+		Block:   "latest",
+		Balance: "1.5",
+		Amount:  Amount{Wei: "1500000000000000000", Hex: "0x14d1120d7b160000", Evmos: "1.5"},
+		Value:   big.NewInt(1500000000000000000),
+	}, balance)
+
+	_, err = GetWalletBalance(ctx, alice, "latest", "gwei")
+	assert.ErrorIs(t, err, ErrUnknownUnit)
+}
+
+func TestGetBlockByTime(t *testing.T) {
+	ctx := context.Background()
+	// blocks 1 to 100 are produced every 6 seconds from 1000, and block 50 took a minute
+	blocks := make(map[string]map[string]interface{})
+	timestamp := uint64(1000)
+	for number := 1; number <= 100; number++ {
+		if number == 50 {
+			timestamp += 54
+		}
+		blocks[fmt.Sprintf("0x%x", number)] = map[string]interface{}{"number": fmt.Sprintf("0x%x", number), "timestamp": fmt.Sprintf("0x%x", timestamp)}
+		timestamp += 6
+	}
+	client := &MockEvmosClient{blockNumber: "0x64", blocks: blocks}
+	SetClient(client)
+
+	tests := []struct {
+		time int64
+		want uint64
+	}{
+		{0, 1},
+		{1000, 1},
+		{1001, 2},
+		{1006, 2},
+		{1294, 50}, // block 49 is at 1288, block 50 at 1348
+		{1348, 50},
+		{1648, 100},
+	}
+	for _, test := range tests {
+		block, err := GetBlockByTime(ctx, time.Unix(test.time, 0))
+		assert.NoError(t, err)
+		assert.Equal(t, test.want, block.Number, "block at %d", test.time)
+	}
+	block, err := GetBlockByTime(ctx, time.Unix(1300, 0))
+	assert.NoError(t, err)
+	assert.Equal(t, time.Unix(1348, 0).UTC(), block.Timestamp)
+
+	_, err = GetBlockByTime(ctx, time.Unix(1649, 0))
+	assert.ErrorIs(t, err, ErrNoBlockAtTime)
+
+	// timestamps are cached, so repeating a search does not query the node again
+	calls := client.blockCalls
+	_, err = GetBlockByTime(ctx, time.Unix(1001, 0))
+	assert.NoError(t, err)
+	assert.Equal(t, calls, client.blockCalls)
+
+	start, end, err := BlockRangeForTimes(ctx, time.Unix(1001, 0), time.Unix(1300, 0), 0, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{2, 49}, []int{start, end})
+
+	start, end, err = BlockRangeForTimes(ctx, time.Time{}, time.Unix(5000, 0), 10, 20)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{10, 100}, []int{start, end})
+
+	_, _, err = BlockRangeForTimes(ctx, time.Time{}, time.Unix(999, 0), 10, 20)
+	assert.ErrorIs(t, err, ErrNoBlockAtTime)
+
+	// a pruned node no longer serves blocks 1 to 40, so searches start from block 41
+	for number := 1; number <= 40; number++ {
+		delete(blocks, fmt.Sprintf("0x%x", number))
+	}
+	SetClient(client)
+	block, err = GetBlockByTime(ctx, time.Unix(1000, 0))
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(41), block.Number)
+	block, err = GetBlockByTime(ctx, time.Unix(1348, 0))
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(50), block.Number)
+	_, _, err = BlockRangeForTimes(ctx, time.Time{}, time.Unix(1100, 0), 10, 20)
+	assert.ErrorIs(t, err, ErrNoBlockAtTime)
+}
+
+func TestDecodeRevertReason(t *testing.T) {
+	errorPayload, err := errorMethod.Pack("insufficient balance")
+	assert.NoError(t, err)
+	panicPayload, err := panicMethod.Pack(big.NewInt(0x11))
+	assert.NoError(t, err)
+	unknownPanic, err := panicMethod.Pack(big.NewInt(0x99))
+	assert.NoError(t, err)
+	RegisterSignature("InsufficientLiquidity()")
+
+	assert.Equal(t, "insufficient balance", DecodeRevertReason(abi.ToHex(errorPayload)))
+	assert.Equal(t, "panic 0x11: arithmetic overflow or underflow", DecodeRevertReason(abi.ToHex(panicPayload)))
+	assert.Equal(t, "panic 0x99", DecodeRevertReason(abi.ToHex(unknownPanic)))
+	assert.Equal(t, "custom error InsufficientLiquidity()", DecodeRevertReason(abi.ToHex(abi.Selector("InsufficientLiquidity()"))))
+	assert.Equal(t, "custom error 0x12345678", DecodeRevertReason("0x12345678"))
+	assert.Equal(t, "malformed Error(string)", DecodeRevertReason(abi.ToHex(errorPayload[:40])))
+	assert.Equal(t, "malformed Panic(uint256)", DecodeRevertReason(abi.ToHex(panicPayload[:20])))
+	assert.Equal(t, "", DecodeRevertReason("0x"))
+}
+
+func TestGetTransactionDetail(t *testing.T) {
+	ctx := context.Background()
+	tokenABI := `[
+		{"type":"event","name":"Transfer","anonymous":false,"inputs":[
+			{"name":"from","type":"address","indexed":true},
+			{"name":"to","type":"address","indexed":true},
+			{"name":"value","type":"uint256","indexed":false}]},
+		{"type":"function","name":"transfer","inputs":[{"name":"to","type":"address"},{"name":"amount","type":"uint256"}],"outputs":[{"name":"","type":"bool"}]}
+	]`
+	const (
+		token  = "0x00000000000000000000000000000000000000dd"
+		pool   = "0x00000000000000000000000000000000000000ee"
+		sender = "0x00000000000000000000000000000000000000aa"
+		txHash = "0x1111111111111111111111111111111111111111111111111111111111111111"
+	)
+	assert.NoError(t, RegisterABI(token, []byte(tokenABI)))
+
+	transfer := abi.MustParseMethod("transfer(address,uint256)")
+	input, err := transfer.Pack(pool, big.NewInt(1000))
+	assert.NoError(t, err)
+	withdraw, err := abi.MustParseMethod("withdraw(uint256)").Pack(big.NewInt(5))
+	assert.NoError(t, err)
+	revert, err := errorMethod.Pack("insufficient balance")
+	assert.NoError(t, err)
+
+	client := &MockEvmosClient{
+		transactions: map[string]map[string]interface{}{
+			txHash: {"hash": txHash, "blockNumber": "0x64", "from": sender, "to": token, "value": "0x0", "nonce": "0x7", "gas": "0x30d40", "input": abi.ToHex(input)},
+		},
+		receipts: map[string]map[string]interface{}{
+			txHash: {
+				"status": "0x1", "gasUsed": "0xc350", "effectiveGasPrice": "0x2",
+				"logs": []interface{}{
+					map[string]interface{}{
+						"address":  token,
+						"logIndex": "0x0",
+						"topics": []interface{}{
+							"0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef",
+							"0x00000000000000000000000000000000000000000000000000000000000000aa",
+							"0x00000000000000000000000000000000000000000000000000000000000000ee",
+						},
+						"data": "0x00000000000000000000000000000000000000000000000000000000000003e8",
+					},
+				},
+			},
+		},
+		traces: map[string]map[string]interface{}{
+			txHash: {
+				"type": "CALL", "from": sender, "to": token, "value": "0x0", "gas": "0x30d40", "gasUsed": "0xc350", "input": abi.ToHex(input),
+				"calls": []interface{}{
+					map[string]interface{}{
+						"type": "CALL", "from": token, "to": pool, "gas": "0x1000", "gasUsed": "0x800", "input": abi.ToHex(withdraw),
+						"output": abi.ToHex(revert), "error": "execution reverted",
+					},
+				},
+			},
+		},
+	}
+	SetClient(client)
+
+	detail, err := GetTransactionDetail(ctx, txHash)
+	assert.NoError(t, err)
+	assert.True(t, detail.Success)
+	assert.Equal(t, uint64(7), detail.Nonce)
+	assert.Equal(t, "100000", detail.Fee)
+	// wei amounts are rendered as strings, which JSON clients parse without losing precision
+	encoded, err := json.Marshal(detail)
+	assert.NoError(t, err)
+	assert.Contains(t, string(encoded), `"fee":"100000"`)
+	assert.Equal(t, &DecodedInput{
+		Selector:  "0xa9059cbb",
+		Signature: "transfer(address,uint256)",
+		Args:      map[string]interface{}{"to": pool, "amount": "1000"},
+	}, detail.Input)
+
+	assert.Len(t, detail.Logs, 1)
+	assert.Equal(t, "Transfer", detail.Logs[0].Decoded.Event)
+	assert.Equal(t, "1000", detail.Logs[0].Decoded.Args["value"])
+
+	assert.Equal(t, "", detail.CallTree.RevertReason)
+	assert.Len(t, detail.CallTree.Calls, 1)
+	inner := detail.CallTree.Calls[0]
+	assert.Equal(t, "insufficient balance", inner.RevertReason)
+	assert.Equal(t, "withdraw(uint256)", inner.Method.Signature)
+	assert.Equal(t, map[string]interface{}{"arg0": "5"}, inner.Method.Args)
+
+	_, err = GetTransactionDetail(ctx, "0x1234")
+	assert.ErrorIs(t, err, ErrInvalidTxHash)
+	_, err = GetTransactionDetail(ctx, "0x2222222222222222222222222222222222222222222222222222222222222222")
+	assert.ErrorIs(t, err, ErrTransactionNotFound)
+}
+
+func TestGetFailureStats(t *testing.T) {
+	ctx := context.Background()
+	const (
+		router = "0x00000000000000000000000000000000000000a1"
+		pool   = "0x00000000000000000000000000000000000000a2"
+		token  = "0x00000000000000000000000000000000000000a3"
+	)
+	revert, err := errorMethod.Pack("slippage")
+	assert.NoError(t, err)
+	overflow, err := panicMethod.Pack(big.NewInt(0x11))
+	assert.NoError(t, err)
+
+	client := &MockEvmosClient{
+		blocksInRange: []map[string]interface{}{
+			{"number": "0x64", "transactions": []interface{}{
+				map[string]interface{}{"hash": "0xTxHash1", "from": "0xWallet1", "to": router},
+				map[string]interface{}{"hash": "0xTxHash2", "from": "0xWallet2", "to": router},
+				map[string]interface{}{"hash": "0xTxHash3", "from": "0xWallet3", "to": token},
+			}},
+		},
+		traces: map[string]map[string]interface{}{
+			// the pool reverts and the router bubbles the revert up
+			"0xTxHash1": {"to": router, "error": "execution reverted", "output": abi.ToHex(revert), "calls": []interface{}{
+				map[string]interface{}{"to": pool, "error": "execution reverted", "output": abi.ToHex(revert)},
+			}},
+			// the router catches the failed token call
+			"0xTxHash2": {"to": router, "calls": []interface{}{
+				map[string]interface{}{"to": pool, "calls": []interface{}{
+					map[string]interface{}{"to": token, "error": "execution reverted", "output": abi.ToHex(overflow)},
+				}},
+			}},
+			"0xTxHash3": {"to": token, "error": "out of gas"},
+		},
+	}
+	SetClient(client)
+
+	stats, err := GetFailureStats(ctx, 100, 100, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, stats.Transactions)
+	assert.Equal(t, 2, stats.FailedTransactions)
+	assert.InDelta(t, 2.0/3, stats.FailureRate, 1e-9)
+	assert.Equal(t, 3, stats.InternalCalls)
+	assert.Equal(t, 2, stats.FailedInternalCalls)
+	assert.Equal(t, []ReasonCount{
+		{Reason: "slippage", Count: 2},
+		{Reason: "out of gas", Count: 1},
+		{Reason: "panic 0x11: arithmetic overflow or underflow", Count: 1},
+	}, stats.TopReasons)
+
+	assert.Len(t, stats.TopRevertingContracts, 3)
+	assert.Equal(t, token, stats.TopRevertingContracts[0].Address)
+	assert.Equal(t, 2, stats.TopRevertingContracts[0].Reverts)
+	assert.Equal(t, 1.0, stats.TopRevertingContracts[0].RevertRate)
+	// ties on reverts are ordered by address
+	assert.Equal(t, router, stats.TopRevertingContracts[1].Address)
+	assert.InDelta(t, 0.5, stats.TopRevertingContracts[1].RevertRate, 1e-9)
+	assert.Equal(t, []ReasonCount{{Reason: "slippage", Count: 1}}, stats.TopRevertingContracts[1].TopReasons)
+	assert.Equal(t, pool, stats.TopRevertingContracts[2].Address)
+
+	stats, err = GetFailureStats(ctx, 100, 100, 1)
+	assert.NoError(t, err)
+	assert.Len(t, stats.TopRevertingContracts, 1)
+	assert.Len(t, stats.TopReasons, 1)
+}
+
+func TestInternalTransfers(t *testing.T) {
+	ctx := context.Background()
+	client := &MockEvmosClient{
+		blocksInRange: []map[string]interface{}{
+			{
+				"number": "0x64",
+				"transactions": []interface{}{
+					map[string]interface{}{"hash": "0xTxHash1", "from": "0xAlice", "to": "0xVault", "value": "0x0"},
+					map[string]interface{}{"hash": "0xTxHash2", "from": "0xAlice", "to": "0xVault", "value": "0x0"},
+				},
+			},
+		},
+		traces: map[string]map[string]interface{}{
+			"0xTxHash1": {
+				"type": "CALL", "from": "0xAlice", "to": "0xVault",
+				"calls": []interface{}{
+					map[string]interface{}{"type": "DELEGATECALL", "from": "0xVault", "to": "0xLogic", "value": "0x9"},
+					map[string]interface{}{"type": "CALL", "from": "0xVault", "to": "0xBob", "value": "0x4"},
+					map[string]interface{}{"type": "CALL", "from": "0xVault", "to": "0xPool", "value": "0x0", "error": "execution reverted",
+						"calls": []interface{}{
+							map[string]interface{}{"type": "CALL", "from": "0xPool", "to": "0xCarol", "value": "0x3"},
+						},
+					},
+					map[string]interface{}{"type": "SELFDESTRUCT", "from": "0xVault", "to": "0xDave", "value": "0x2"},
+				},
+			},
+			// the transaction failed, so none of its transfers happened
+			"0xTxHash2": {
+				"type": "CALL", "from": "0xAlice", "to": "0xVault", "error": "execution reverted",
+				"calls": []interface{}{
+					map[string]interface{}{"type": "CALL", "from": "0xVault", "to": "0xErin", "value": "0x1"},
+				},
+			},
+		},
+		code: map[string]string{"0xVault": "0x6001", "0xLogic": "0x6002", "0xPool": "0x6003"},
+	}
+	SetClient(client)
+
+	transfers, err := blockInternalTransfers(ctx, client.blocksInRange[0])
+	assert.NoError(t, err)
+	assert.Equal(t, []InternalTransfer{
+		{TxHash: "0xTxHash1", BlockNumber: 100, Type: "CALL", From: "0xVault", To: "0xBob", Value: "4", value: big.NewInt(4)},
+		{TxHash: "0xTxHash1", BlockNumber: 100, Type: "SELFDESTRUCT", From: "0xVault", To: "0xDave", Value: "2", value: big.NewInt(2)},
+	}, transfers)
+
+	wallets, err := ExtractWallets(ctx, client.blocksInRange)
+	assert.NoError(t, err)
+	sort.Strings(wallets)
+	assert.Equal(t, []string{"0xAlice", "0xBob", "0xDave"}, wallets)
+
+	// a trace that cannot be fetched fails the extraction instead of dropping the internal recipients
+	client.traceErr = context.DeadlineExceeded
+	SetClient(client)
+	_, err = blockInternalTransfers(ctx, client.blocksInRange[0])
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	_, err = ExtractWallets(ctx, client.blocksInRange)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestTraceRPCError(t *testing.T) {
+	// the node answers debug_traceTransaction with an error object rather than failing the request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Method string `json:"method"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&request)
+		if request.Method == "debug_traceTransaction" {
+			_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"tracing failed"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x"}`))
+	}))
+	defer server.Close()
+	SetClient(&client.EvmosClient{BaseURL: server.URL})
+	defer SetClient(&MockEvmosClient{})
+
+	blocks := []map[string]interface{}{{"number": "0x64", "transactions": []interface{}{
+		map[string]interface{}{"hash": "0xTxHash1", "from": "0xAlice", "to": "0xBob"},
+	}}}
+	_, err := ExtractWallets(context.Background(), blocks)
+	var rpcErr *client.RPCError
+	assert.ErrorAs(t, err, &rpcErr)
+	assert.Equal(t, "tracing failed", rpcErr.Message)
+}
+
+func TestGetFlowGraph(t *testing.T) {
+	const (
+		alice = "0x00000000000000000000000000000000000000a1"
+		bob   = "0x00000000000000000000000000000000000000b2"
+		vault = "0x00000000000000000000000000000000000000c3"
+	)
+	client := &MockEvmosClient{
+		blocksInRange: []map[string]interface{}{
+			{"number": "0x64", "transactions": []interface{}{
+				map[string]interface{}{"hash": "0xTxHash1", "from": alice, "to": vault},
+				map[string]interface{}{"hash": "0xTxHash2", "from": alice, "to": vault},
+				map[string]interface{}{"hash": "0xTxHash3", "from": alice, "to": bob},
+				map[string]interface{}{"hash": "0xTxHash4", "from": alice, "to": bob},
+			}},
+		},
+		traces: map[string]map[string]interface{}{
+			"0xTxHash1": {"type": "CALL", "from": alice, "to": vault, "value": "0xa", "calls": []interface{}{
+				map[string]interface{}{"type": "CALL", "from": vault, "to": bob, "value": "0x4"},
+			}},
+			"0xTxHash2": {"type": "CALL", "from": alice, "to": vault, "value": "0x5"},
+			"0xTxHash3": {"type": "CALL", "from": alice, "to": bob, "value": "0x1", "error": "out of gas"},
+			"0xTxHash4": {"type": "CALL", "from": alice, "to": bob, "value": "0x0"},
+		},
+		code: map[string]string{alice: "0x", bob: "0x", vault: "0x6001"},
+	}
+	SetClient(client)
+
+	graph, err := GetFlowGraph(context.Background(), 100, 100)
+	assert.NoError(t, err)
+	assert.Equal(t, []FlowEdge{
+		{From: alice, To: vault, Count: 2, Value: "15", value: big.NewInt(15)},
+		{From: vault, To: bob, Count: 1, Value: "4", value: big.NewInt(4)},
+	}, graph.Edges)
+	assert.Len(t, graph.Nodes, 3)
+	assert.Equal(t, vault, graph.Nodes[2].Address)
+	assert.True(t, graph.Nodes[2].IsContract)
+	assert.Equal(t, "15", graph.Nodes[2].Received)
+	assert.Equal(t, "4", graph.Nodes[2].Sent)
+
+	graphML := graph.GraphML()
+	assert.Contains(t, graphML, `<edge id="e0" source="`+alice+`" target="`+vault+`">`)
+	assert.Contains(t, graphML, `<data key="weight">0.000000000000000015</data>`)
+	assert.Contains(t, graphML, `<data key="contract">true</data>`)
+
+	dot := graph.DOT()
+	assert.True(t, strings.HasPrefix(dot, "digraph flows {\n"))
+	assert.Contains(t, dot, `"`+vault+`" [shape=box];`)
+	assert.Contains(t, dot, `"`+vault+`" -> "`+bob+`" [label="1 transfers, 0.000000000000000004 EVMOS", weight=1];`)
+
+	// nodes whose code cannot be fetched fail the graph
+	client.codeErr = context.DeadlineExceeded
+	_, err = GetFlowGraph(context.Background(), 100, 100)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestGetClusters(t *testing.T) {
+	address := func(n int) string { return fmt.Sprintf("0x%040x", n) }
+	var (
+		funder, fundedA, fundedB = address(0xf0), address(0xf1), address(0xf2)
+		veteran, returning       = address(0xf3), address(0xf4)
+		userA, userB, userC      = address(0xa1), address(0xa2), address(0xa3)
+		depositA, depositB, hub  = address(0xd1), address(0xd2), address(0xee)
+		botA, botB, dapp         = address(0xb1), address(0xb2), address(0xcc)
+	)
+	traces := make(map[string]map[string]interface{})
+	tx := func(hash, from, to, value string) map[string]interface{} {
+		traces[hash] = map[string]interface{}{"type": "CALL", "from": from, "to": to, "value": value}
+		return map[string]interface{}{"hash": hash, "from": from, "to": to, "value": value}
+	}
+	client := &MockEvmosClient{
+		blocksInRange: []map[string]interface{}{
+			{"number": "0x64", "transactions": []interface{}{
+				tx("0xTx1", funder, fundedA, "0x5"),
+				tx("0xTx2", funder, fundedB, "0x5"),
+				tx("0xTx14", funder, veteran, "0x5"),
+				tx("0xTx15", funder, returning, "0x5"),
+			}},
+			{"number": "0x65", "transactions": []interface{}{
+				tx("0xTx3", userA, depositA, "0x1"),
+				tx("0xTx4", userB, depositA, "0x2"),
+				tx("0xTx5", userC, depositB, "0x3"),
+			}},
+			{"number": "0x66", "transactions": []interface{}{
+				tx("0xTx6", depositA, hub, "0x3"),
+				tx("0xTx7", depositB, hub, "0x3"),
+			}},
+			{"number": "0x67", "transactions": []interface{}{tx("0xTx8", botA, dapp, "0x0"), tx("0xTx9", botB, dapp, "0x0")}},
+			{"number": "0x68", "transactions": []interface{}{tx("0xTx10", botA, dapp, "0x0"), tx("0xTx11", botB, dapp, "0x0")}},
+			{"number": "0x69", "transactions": []interface{}{tx("0xTx12", botA, dapp, "0x0"), tx("0xTx13", botB, dapp, "0x0")}},
+		},
+		traces: traces,
+		code:   map[string]string{dapp: "0x6001"},
+		// addresses that held EVMOS or sent a transaction before being paid by the funder are not new
+		historicBalances: map[string]string{veteran + ":0x63": "0x1"},
+		nonces:           map[string]string{returning: "0x2"},
+	}
+	SetClient(client)
+
+	clustering, err := GetClusters(context.Background(), 100, 105)
+	assert.NoError(t, err)
+	assert.Equal(t, []Cluster{
+		{ID: funder, Size: 3, Addresses: []string{funder, fundedA, fundedB}, Heuristics: []string{HeuristicFunding}},
+		{ID: userA, Size: 2, Addresses: []string{userA, userB}, Heuristics: []string{HeuristicDeposit}},
+		{ID: botA, Size: 2, Addresses: []string{botA, botB}, Heuristics: []string{HeuristicSynchronized}},
+	}, clustering.Clusters)
+	assert.Equal(t, "", clustering.ClusterOf(userC))
+	assert.Equal(t, "", clustering.ClusterOf(hub))
+
+	wallets := []WalletBalance{
+		{Address: userA, Value: big.NewInt(10)},
+		{Address: userB, Value: big.NewInt(15)},
+		{Address: userC, Value: big.NewInt(20)},
+	}
+	clustering.Annotate(wallets)
+	assert.Equal(t, userA, wallets[1].Cluster)
+	assert.Equal(t, "", wallets[2].Cluster)
+
+	entities, err := clustering.RichestEntities(wallets, "wei")
+	assert.NoError(t, err)
+	assert.Len(t, entities, 2)
+	assert.Equal(t, userA, entities[0].Cluster)
+	assert.Equal(t, []string{userA, userB}, entities[0].Addresses)
+	assert.Equal(t, "25", entities[0].Balance)
+	assert.Equal(t, []string{userC}, entities[1].Addresses)
+
+	// failed code lookups fail the clustering instead of treating addresses as contracts
+	client.codeErr = context.DeadlineExceeded
+	_, err = GetClusters(context.Background(), 100, 105)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestLabels(t *testing.T) {
+	exchange := "0x2000000000000000000000000000000000000001"
+	bridge := "0x2000000000000000000000000000000000000002"
+	user := "0x2000000000000000000000000000000000000003"
+	t.Cleanup(func() {
+		for _, address := range []string{exchange, bridge, user} {
+			_, _ = DeleteLabel(address)
+		}
+	})
+
+	dir := t.TempDir()
+	jsonFile := filepath.Join(dir, "labels.json")
+	assert.NoError(t, os.WriteFile(jsonFile, []byte(`[{"address": "`+exchange+`", "name": "Exchange Hot Wallet", "category": "Exchange"}]`), 0o600))
+	csvFile := filepath.Join(dir, "labels.csv")
+	assert.NoError(t, os.WriteFile(csvFile, []byte("address,name,category\n"+bridge+",Bridge,bridge\n"), 0o600))
+
+	assert.NoError(t, LoadLabels(jsonFile))
+	assert.NoError(t, LoadLabels(csvFile))
+	assert.Equal(t, &Label{Name: "Exchange Hot Wallet", Category: "exchange"}, labelFor(exchange))
+	assert.Equal(t, &Label{Name: "Bridge", Category: "bridge"}, labelFor(bridge))
+	assert.Nil(t, labelFor(user))
+	assert.Len(t, GetLabels(), 2)
+
+	assert.ErrorIs(t, SetLabel("0x1234", Label{Name: "Short"}), ErrInvalidAddress)
+	assert.Error(t, SetLabel(user, Label{}))
+
+	wallets := []WalletBalance{{Address: exchange}, {Address: bridge}, {Address: user}}
+	kept := ExcludeCategories(wallets, []string{"exchange", "BRIDGE"})
+	assert.Equal(t, []WalletBalance{{Address: user}}, kept)
+
+	wallet, err := newWalletBalance(exchange, big.NewInt(1), "wei")
+	assert.NoError(t, err)
+	assert.Equal(t, "Exchange Hot Wallet", wallet.Label.Name)
+
+	assert.NoError(t, SaveLabels(jsonFile))
+	deleted, err := DeleteLabel(bridge)
+	assert.NoError(t, err)
+	assert.True(t, deleted)
+	assert.Nil(t, labelFor(bridge))
+	assert.NoError(t, LoadLabels(jsonFile))
+	assert.NotNil(t, labelFor(bridge))
+
+	// edits are written back to the labels file
+	SetLabelsFile(jsonFile)
+	t.Cleanup(func() { SetLabelsFile("") })
+	assert.NoError(t, SetLabel(user, Label{Name: "User"}))
+	saved, err := os.ReadFile(jsonFile)
+	assert.NoError(t, err)
+	assert.Contains(t, string(saved), `"name": "User"`)
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2, "no temporary file is left behind")
+
+	// an edit that cannot be saved is undone
+	SetLabelsFile(filepath.Join(dir, "missing", "labels.json"))
+	assert.ErrorIs(t, SetLabel(user, Label{Name: "Renamed"}), ErrLabelsNotSaved)
+	assert.Equal(t, &Label{Name: "User"}, labelFor(user))
+	deleted, err = DeleteLabel(user)
+	assert.ErrorIs(t, err, ErrLabelsNotSaved)
+	assert.False(t, deleted)
+	assert.Equal(t, &Label{Name: "User"}, labelFor(user))
+	newcomer := "0x2000000000000000000000000000000000000004"
+	assert.ErrorIs(t, SetLabel(newcomer, Label{Name: "Newcomer"}), ErrLabelsNotSaved)
+	assert.Nil(t, labelFor(newcomer))
+}
+
+func TestSyncNewBlocks(t *testing.T) {
+	ctx := context.Background()
+	client := &MockEvmosClient{
+		blockNumber: "0x64",
+		blocksInRange: []map[string]interface{}{
+			{"number": "0x65", "transactions": []interface{}{}},
+			{"number": "0x66", "transactions": []interface{}{}},
+		},
+	}
+	SetClient(client)
+	hooks := chainFollower.hooks
+	t.Cleanup(func() { chainFollower.hooks = hooks })
+
+	var seen []uint64
+	OnNewBlock(func(_ context.Context, block map[string]interface{}) {
+		seen = append(seen, hexToUint64(block["number"]))
+	})
+
+	ingested, err := SyncNewBlocks(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, ingested)
+	assert.Equal(t, uint64(100), FollowedHead())
+
+	client.blockNumber = "0x66"
+	ingested, err = SyncNewBlocks(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, ingested)
+	assert.Equal(t, []uint64{101, 102}, seen)
+	assert.Equal(t, uint64(102), FollowedHead())
+
+	ingested, err = SyncNewBlocks(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, ingested)
+	assert.Equal(t, 1, client.blockRangeCalls)
+
+	// a head announced after a disconnect backfills every block missed since the followed head
+	client.blocksInRange = []map[string]interface{}{
+		{"number": "0x67", "transactions": []interface{}{}},
+		{"number": "0x68", "transactions": []interface{}{}},
+		{"number": "0x69", "transactions": []interface{}{}},
+	}
+	ingested, err = SyncToBlock(ctx, 105)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, ingested)
+	assert.Equal(t, []uint64{101, 102, 103, 104, 105}, seen)
+	assert.Equal(t, uint64(105), FollowedHead())
+}
+
+func TestWatchlist(t *testing.T) {
+	ctx := context.Background()
+	var (
+		whale    = "0x3000000000000000000000000000000000000001"
+		treasury = "0x3000000000000000000000000000000000000002"
+		user     = "0x3000000000000000000000000000000000000003"
+		dex      = "0x3000000000000000000000000000000000000004"
+	)
+	client := &MockEvmosClient{
+		traces: map[string]map[string]interface{}{
+			"0xTx1": {"type": "CALL", "from": whale, "to": user, "value": "0x3e8"},
+			"0xTx2": {"type": "CALL", "from": user, "to": dex, "value": "0x0"},
+		},
+		historicBalances: map[string]string{treasury + ":0x65": "0x5", treasury + ":0x66": "0x1"},
+	}
+	SetClient(client)
+	t.Cleanup(func() {
+		for _, watch := range GetWatches() {
+			RemoveWatch(watch.ID)
+		}
+	})
+
+	_, err := AddWatch(Watch{Kind: "volume", Address: whale, WebhookURL: "http://hooks.example", Secret: "s"})
+	assert.ErrorIs(t, err, ErrInvalidWatch)
+	_, err = AddWatch(Watch{Kind: WatchTransferAbove, Address: whale, Threshold: "lots", WebhookURL: "http://hooks.example", Secret: "s"})
+	assert.ErrorIs(t, err, ErrInvalidWatch)
+	_, err = AddWatch(Watch{Kind: WatchTransferAbove, Address: whale, Threshold: "1", WebhookURL: "ftp://hooks.example", Secret: "s"})
+	assert.ErrorIs(t, err, ErrInvalidWatch)
+	_, err = AddWatch(Watch{Kind: WatchTransferAbove, Address: whale, Threshold: "1", WebhookURL: "http://hooks.example"})
+	assert.ErrorIs(t, err, ErrInvalidWatch)
+
+	transfer, err := AddWatch(Watch{Kind: WatchTransferAbove, Address: whale, Threshold: "0x64", WebhookURL: "http://hooks.example", Secret: "s"})
+	assert.NoError(t, err)
+	assert.Equal(t, "100", transfer.Threshold)
+	assert.Empty(t, transfer.Secret)
+	_, err = AddWatch(Watch{Kind: WatchBalanceBelow, Address: treasury, Threshold: "3", WebhookURL: "http://hooks.example", Secret: "s"})
+	assert.NoError(t, err)
+	_, err = AddWatch(Watch{Kind: WatchContractInteraction, Address: user, Contract: dex, WebhookURL: "http://hooks.example", Secret: "s"})
+	assert.NoError(t, err)
+	assert.Len(t, GetWatches(), 3)
+
+	block := map[string]interface{}{"number": "0x65", "transactions": []interface{}{
+		map[string]interface{}{"hash": "0xTx1", "from": whale, "to": user, "value": "0x3e8"},
+		map[string]interface{}{"hash": "0xTx2", "from": user, "to": dex, "value": "0x0"},
+	}}
+	alerts := evaluateWatches(ctx, block)
+	assert.Len(t, alerts, 2)
+	assert.Equal(t, WatchTransferAbove, alerts[0].Kind)
+	assert.Equal(t, "1000", alerts[0].Value)
+	assert.Equal(t, WatchContractInteraction, alerts[1].Kind)
+	assert.Equal(t, "0xTx2", alerts[1].TxHash)
+
+	// the balance drop alerts once, when it crosses the threshold
+	next := map[string]interface{}{"number": "0x66", "transactions": []interface{}{}}
+	alerts = evaluateWatches(ctx, next)
+	assert.Len(t, alerts, 1)
+	assert.Equal(t, WatchBalanceBelow, alerts[0].Kind)
+	assert.Equal(t, "1", alerts[0].Value)
+	assert.Empty(t, evaluateWatches(ctx, next))
+
+	// a trace that cannot be fetched could hide an interaction, so it fails the watch and is counted
+	client.traceErr = context.DeadlineExceeded
+	SetClient(client)
+	nested := map[string]interface{}{"number": "0x67", "transactions": []interface{}{
+		map[string]interface{}{"hash": "0xTx3", "from": user, "to": "0xrouter", "value": "0x0"},
+	}}
+	_, err = interactionsWith(ctx, nested, user, dex)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	failed := watchErrors.Value(WatchContractInteraction)
+	assert.Empty(t, evaluateWatches(ctx, nested))
+	assert.Equal(t, failed+1, watchErrors.Value(WatchContractInteraction))
+}
+
+func TestDeliverAlert(t *testing.T) {
+	backoff := deliveryBackoff
+	deliveryBackoff = time.Millisecond
+	t.Cleanup(func() { deliveryBackoff = backoff })
+
+	var (
+		attempts  int
+		signature string
+		timestamp string
+		body      []byte
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		signature = r.Header.Get("X-Signature")
+		timestamp = r.Header.Get("X-Signature-Timestamp")
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	alert := Alert{ID: "7", WatchID: "1", Kind: WatchTransferAbove, Address: "0x3000000000000000000000000000000000000001"}
+	assert.True(t, deliverAlert(context.Background(), alert, server.URL, "secret"))
+	assert.Equal(t, 3, attempts)
+
+	sent, err := strconv.ParseInt(timestamp, 10, 64)
+	assert.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), time.Unix(sent, 0), time.Minute)
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(timestamp + "." + string(body)))
+	assert.Equal(t, "sha256="+hex.EncodeToString(mac.Sum(nil)), signature)
+
+	deliveries := GetDeliveries()
+	assert.GreaterOrEqual(t, len(deliveries), 3)
+	assert.True(t, deliveries[0].Delivered)
+	assert.Equal(t, 3, deliveries[0].Attempt)
+	assert.Equal(t, http.StatusServiceUnavailable, deliveries[1].StatusCode)
+	assert.False(t, deliveries[1].Delivered)
+
+	// deliveries are posted by the workers and stop retrying once their context is done
+	ctx, cancel := context.WithCancel(context.Background())
+	StartDeliveries(ctx)
+	attempts = 0
+	recorded := len(GetDeliveries())
+	deliveryQueue <- queuedAlert{alert: alert, webhookURL: server.URL, secret: "secret"}
+	assert.Eventually(t, func() bool {
+		deliveries := GetDeliveries()
+		return len(deliveries) == recorded+3 && deliveries[0].Delivered
+	}, time.Second, time.Millisecond)
+	cancel()
+	assert.False(t, deliverAlert(ctx, alert, server.URL, "secret"))
+}
+
+func TestStream(t *testing.T) {
+	var (
+		user = "0x4000000000000000000000000000000000000001"
+		dex  = "0x4000000000000000000000000000000000000002"
+	)
+	client := &MockEvmosClient{
+		code: map[string]string{dex: "0x6001"},
+		traces: map[string]map[string]interface{}{
+			"0xTx1": {"type": "CALL", "from": user, "to": dex, "value": "0x0", "gasUsed": "0x5208"},
+		},
+	}
+	SetClient(client)
+
+	events.mu.Lock()
+	last := events.nextID
+	events.mu.Unlock()
+
+	// new subscribers only receive the events published from then on
+	backlog, updates, cancel := Subscribe(0)
+	assert.Empty(t, backlog)
+	defer cancel()
+	block := map[string]interface{}{"number": "0x65", "hash": "0xBlock", "timestamp": "0x10", "gasUsed": "0x5208", "transactions": []interface{}{
+		map[string]interface{}{"hash": "0xTx1", "from": user, "to": dex, "value": "0x0", "input": "0xa9059cbb"},
+	}}
+	PublishBlock(context.Background(), block)
+
+	event := <-updates
+	assert.Equal(t, last+1, event.ID)
+	assert.Equal(t, StreamBlock, event.Type)
+	assert.Equal(t, BlockSummary{Number: 101, Hash: "0xBlock", Timestamp: 16, Transactions: 1, GasUsed: 21000}, event.Data)
+
+	event = <-updates
+	assert.Equal(t, StreamStats, event.Type)
+	stats := event.Data.(RollingStats)
+	assert.Equal(t, uint64(101), stats.EndBlock)
+	assert.Contains(t, stats.Contracts, InteractionCount{Address: dex, Count: 1})
+
+	// the traces are read through the index, so the watchlist evaluating the same block reuses them
+	_, err := valueTransfers(context.Background(), []map[string]interface{}{block})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, client.traceCalls)
+
+	// resuming after the block event replays the stats event only
+	backlog, _, cancelResume := Subscribe(last + 1)
+	cancelResume()
+	assert.Len(t, backlog, 1)
+	assert.Equal(t, last+2, backlog[0].ID)
+
+	// an ID from before a restart replays the whole backlog
+	backlog, _, cancelResume = Subscribe(last + 1000)
+	cancelResume()
+	assert.GreaterOrEqual(t, len(backlog), 2)
+	assert.Equal(t, last+2, backlog[len(backlog)-1].ID)
+}
+
+func TestCacheMetrics(t *testing.T) {
+	ctx := context.Background()
+	address := "0x5000000000000000000000000000000000000001"
+	SetClient(&MockEvmosClient{historicBalances: map[string]string{address + ":0x64": "0x1"}})
+	hits, misses := cacheHits.Value(cacheBalance), cacheMisses.Value(cacheBalance)
+
+	_, err := balances.balancesAt(ctx, address, []uint64{100})
+	assert.NoError(t, err)
+	_, err = balances.balancesAt(ctx, address, []uint64{100, 101})
+	assert.NoError(t, err)
+
+	assert.Equal(t, hits+1, cacheHits.Value(cacheBalance))
+	assert.Equal(t, misses+2, cacheMisses.Value(cacheBalance))
+}
+
+func TestIndexRetention(t *testing.T) {
+	ctx := context.Background()
+	blocks, traces, timestamps, cached := maxIndexedBlocks, maxIndexedTraces, maxIndexedTimestamps, maxCachedBalances
+	maxIndexedBlocks, maxIndexedTraces, maxIndexedTimestamps, maxCachedBalances = 2, 1, 1, 1
+	t.Cleanup(func() {
+		maxIndexedBlocks, maxIndexedTraces, maxIndexedTimestamps, maxCachedBalances = blocks, traces, timestamps, cached
+	})
+
+	client := &MockEvmosClient{blocksInRange: []map[string]interface{}{
+		{"number": "0x64"}, {"number": "0x65"}, {"number": "0x66"},
+	}}
+	SetClient(client)
+
+	// the whole range is returned even though it does not fit in the index
+	indexed, err := index.blocksInRange(ctx, 100, 102)
+	assert.NoError(t, err)
+	assert.Len(t, indexed, 3)
+	assert.Len(t, index.blocks, 2)
+	assert.NotContains(t, index.blocks, uint64(100))
+
+	_, err = index.blocksInRange(ctx, 101, 102)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, client.blockRangeCalls)
+	_, err = index.blocksInRange(ctx, 100, 100)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, client.blockRangeCalls)
+
+	for _, txHash := range []string{"0xa", "0xb"} {
+		_, err = index.trace(ctx, txHash)
+		assert.NoError(t, err)
+	}
+	assert.Len(t, index.traces, 1)
+	assert.Contains(t, index.traces, "0xb")
+
+	_, err = balances.balancesAt(ctx, "0x1", []uint64{100, 101})
+	assert.NoError(t, err)
+	assert.Len(t, balances.balances, 1)
+
+	// timestamps of blocks looked up on their own are bounded as well
+	client.blockAt = func(number uint64) map[string]interface{} {
+		return map[string]interface{}{"number": fmt.Sprintf("0x%x", number), "timestamp": fmt.Sprintf("0x%x", number*6)}
+	}
+	for _, number := range []uint64{200, 201} {
+		_, err = index.timestamp(ctx, number)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, map[uint64]uint64{201: 1206}, index.timestamps)
+
+	// the first block addresses were seen in is evicted with the block
+	withParticipants := []map[string]interface{}{
+		{"number": "0x64", "transactions": []interface{}{map[string]interface{}{"hash": "0xTx1", "from": "0xAlice", "to": "0xBob"}}},
+		{"number": "0x65", "transactions": []interface{}{map[string]interface{}{"hash": "0xTx2", "from": "0xAlice", "to": "0xCarol"}}},
+		{"number": "0x66", "transactions": []interface{}{map[string]interface{}{"hash": "0xTx3", "from": "0xDave", "to": "0xBob"}}},
+	}
+	client = &MockEvmosClient{}
+	SetClient(client)
+	for i, block := range withParticipants {
+		client.blocksInRange = []map[string]interface{}{block}
+		_, err = index.blocksInRange(ctx, 100+i, 100+i)
+		assert.NoError(t, err)
+		_, err = index.participantsOf(ctx, block)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, map[string]uint64{"0xcarol": 101, "0xdave": 102, "0xbob": 102}, index.firstSeen)
+
+	// nor are the participants of blocks no longer indexed remembered
+	_, err = index.participantsOf(ctx, withParticipants[0])
+	assert.NoError(t, err)
+	assert.NotContains(t, index.participants, uint64(100))
+	assert.NotContains(t, index.firstSeen, "0xalice")
+}
+
+func TestParticipantsLookupFailure(t *testing.T) {
+	ctx := context.Background()
+	block := map[string]interface{}{"number": "0x64", "transactions": []interface{}{
+		map[string]interface{}{"hash": "0xTx", "from": "0xAlice", "to": "0xBob", "value": "0x1"},
+	}}
+	client := &MockEvmosClient{blocksInRange: []map[string]interface{}{block}, codeErr: context.Canceled}
+	SetClient(client)
+	_, err := index.blocksInRange(ctx, 100, 100)
+	assert.NoError(t, err)
+
+	_, err = index.participantsOf(ctx, block)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Empty(t, index.participants)
+
+	client.codeErr = nil
+	participants, err := index.participantsOf(ctx, block)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"0xbob"}, participants.recipients)
+	assert.Contains(t, index.participants, uint64(100))
 }
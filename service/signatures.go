@@ -0,0 +1,165 @@
+package service
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"onchain-stats/abi"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// constructorSelector marks contract creations, which carry init code instead of calldata.
+	constructorSelector = "constructor"
+	// fallbackSelector marks calls without calldata, handled by receive() or fallback().
+	fallbackSelector = "0x"
+)
+
+type MethodCount struct {
+	Selector  string `json:"selector"`
+	Signature string `json:"signature,omitempty"`
+	Count     int    `json:"count"`
+}
+
+// defaultSignatures are common token and DEX functions resolved without loading a signature database.
+var defaultSignatures = []string{
+	"transfer(address,uint256)",
+	"transferFrom(address,address,uint256)",
+	"approve(address,uint256)",
+	"balanceOf(address)",
+	"allowance(address,address)",
+	"totalSupply()",
+	"deposit()",
+	"withdraw(uint256)",
+	"mint(address,uint256)",
+	"burn(uint256)",
+	"safeTransferFrom(address,address,uint256)",
+	"safeTransferFrom(address,address,uint256,bytes)",
+	"safeTransferFrom(address,address,uint256,uint256,bytes)",
+	"setApprovalForAll(address,bool)",
+	"multicall(bytes[])",
+	"swapExactTokensForTokens(uint256,uint256,address[],address,uint256)",
+	"swapTokensForExactTokens(uint256,uint256,address[],address,uint256)",
+	"swapExactETHForTokens(uint256,address[],address,uint256)",
+	"swapExactTokensForETH(uint256,uint256,address[],address,uint256)",
+	"addLiquidity(address,address,uint256,uint256,uint256,uint256,address,uint256)",
+	"removeLiquidity(address,address,uint256,uint256,uint256,address,uint256)",
+}
+
+var (
+	signaturesMu sync.RWMutex
+	signatures   = make(map[string]string)
+)
+
+func init() {
+	for _, signature := range defaultSignatures {
+		RegisterSignature(signature)
+	}
+}
+
+// RegisterSignature adds a canonical function signature to the local signature database.
+func RegisterSignature(signature string) {
+	selector := abi.ToHex(abi.Selector(signature))
+
+	signaturesMu.Lock()
+	defer signaturesMu.Unlock()
+	signatures[selector] = signature
+}
+
+// LoadSignatures loads function signatures from a text file with one signature per line.
+// Lines may optionally be prefixed with their selector ("0xa9059cbb transfer(address,uint256)"),
+// in which case the selector is verified. Empty lines and lines starting with # are ignored.
+func LoadSignatures(path string) error {
+	file, err := os.Open(path) // #nosec G304 -- path comes from configuration
+	if err != nil {
+		return err
+	}
+	defer closeFile(file)
+
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		signature := line
+		if fields := strings.Fields(line); len(fields) == 2 && strings.HasPrefix(fields[0], "0x") {
+			signature = fields[1]
+			if computed := abi.ToHex(abi.Selector(signature)); computed != strings.ToLower(fields[0]) {
+				return fmt.Errorf("%s:%d: selector %s does not match %s (%s)", path, lineNumber, fields[0], signature, computed)
+			}
+		}
+		if _, err := abi.ParseMethod(signature); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, lineNumber, err)
+		}
+		RegisterSignature(signature)
+	}
+
+	return scanner.Err()
+}
+
+func closeFile(file *os.File) {
+	if err := file.Close(); err != nil {
+		slog.Warn("closing file", "file", file.Name(), "error", err)
+	}
+}
+
+// ResolveSelector returns the signature of a 4-byte selector, preferring the ABI registered for the contract
+// over the signature database. It returns an empty string when the selector is unknown.
+func ResolveSelector(contractABI *abi.ABI, selector string) string {
+	if contractABI != nil {
+		if raw, err := abi.FromHex(selector); err == nil {
+			if method, exists := contractABI.MethodByID(raw); exists {
+				return method.Signature()
+			}
+		}
+	}
+
+	signaturesMu.RLock()
+	defer signaturesMu.RUnlock()
+	return signatures[selector]
+}
+
+// inputSelector extracts the lowercase 4-byte selector from transaction or call frame input.
+func inputSelector(input interface{}) string {
+	data, _ := input.(string)
+	if len(data) < 10 {
+		return fallbackSelector
+	}
+	return strings.ToLower(data[:10])
+}
+
+func contractABIFor(address string) *abi.ABI {
+	contractABI, _ := GetContractABI(address)
+	return contractABI
+}
+
+// methodBreakdown resolves the counted selectors and sorts them by number of calls.
+func methodBreakdown(contractABI *abi.ABI, counts map[string]int) []MethodCount {
+	methods := make([]MethodCount, 0, len(counts))
+	for selector, count := range counts {
+		method := MethodCount{Selector: selector, Count: count}
+		switch selector {
+		case constructorSelector:
+			method.Selector, method.Signature = "", constructorSelector
+		case fallbackSelector:
+			method.Signature = "fallback"
+		default:
+			method.Signature = ResolveSelector(contractABI, selector)
+		}
+		methods = append(methods, method)
+	}
+
+	sort.Slice(methods, func(i, j int) bool {
+		if methods[i].Count != methods[j].Count {
+			return methods[i].Count > methods[j].Count
+		}
+		return methods[i].Selector < methods[j].Selector
+	})
+
+	return methods
+}
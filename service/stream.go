@@ -0,0 +1,188 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"sync"
+)
+
+// Types of stream events.
+const (
+	StreamBlock = "block"
+	StreamStats = "stats"
+	StreamAlert = "alert"
+)
+
+const (
+	// maxStreamBacklog is the number of recent events kept for clients resuming with Last-Event-ID.
+	maxStreamBacklog = 1000
+	// streamBuffer is the number of events a subscriber may fall behind before it is dropped. Dropped clients
+	// reconnect and resume from the backlog.
+	streamBuffer = 64
+	// rollingWindow is the number of recent blocks covered by the rolling contract interaction counts.
+	rollingWindow = 100
+	// topStreamContracts is the number of contracts listed in stats events.
+	topStreamContracts = 10
+)
+
+// StreamEvent is an event pushed to stream subscribers. IDs increase by one with every event.
+type StreamEvent struct {
+	ID   uint64      `json:"id"`
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+}
+
+type BlockSummary struct {
+	Number       uint64 `json:"number"`
+	Hash         string `json:"hash"`
+	Timestamp    uint64 `json:"timestamp"`
+	Transactions int    `json:"transactions"`
+	GasUsed      uint64 `json:"gasUsed"`
+}
+
+type InteractionCount struct {
+	Address string `json:"address"`
+	Count   int    `json:"count"`
+}
+
+// RollingStats counts the contract interactions of the last blocks ingested, up to rollingWindow.
+type RollingStats struct {
+	StartBlock   uint64             `json:"startBlock"`
+	EndBlock     uint64             `json:"endBlock"`
+	Transactions int                `json:"transactions"`
+	Contracts    []InteractionCount `json:"contracts"`
+}
+
+type blockCounts struct {
+	number       uint64
+	transactions int
+	interactions map[string]int
+}
+
+type stream struct {
+	mu          sync.Mutex
+	nextID      uint64
+	backlog     []StreamEvent
+	subscribers map[chan StreamEvent]struct{}
+
+	window       []blockCounts
+	interactions map[string]int
+}
+
+var events = &stream{subscribers: make(map[chan StreamEvent]struct{}), interactions: make(map[string]int)}
+
+// Subscribe returns the backlog of events after lastEventID and a channel receiving the events published from
+// then on, which is closed when the subscriber falls behind. cancel must be called once done.
+// A lastEventID of 0 subscribes to new events only. When lastEventID is older than the backlog, or newer than
+// any event published, as for clients resuming across a restart that reset the IDs, the whole backlog is returned.
+func Subscribe(lastEventID uint64) (backlog []StreamEvent, updates <-chan StreamEvent, cancel func()) {
+	events.mu.Lock()
+	defer events.mu.Unlock()
+
+	if lastEventID > 0 {
+		if lastEventID > events.nextID {
+			lastEventID = 0
+		}
+		for _, event := range events.backlog {
+			if event.ID > lastEventID {
+				backlog = append(backlog, event)
+			}
+		}
+	}
+
+	ch := make(chan StreamEvent, streamBuffer)
+	events.subscribers[ch] = struct{}{}
+	cancel = func() {
+		events.mu.Lock()
+		defer events.mu.Unlock()
+		if _, subscribed := events.subscribers[ch]; subscribed {
+			delete(events.subscribers, ch)
+			close(ch)
+		}
+	}
+	return backlog, ch, cancel
+}
+
+// publish assigns the next ID to an event, keeps it in the backlog and sends it to every subscriber.
+func publish(eventType string, data interface{}) {
+	events.mu.Lock()
+	defer events.mu.Unlock()
+
+	events.nextID++
+	event := StreamEvent{ID: events.nextID, Type: eventType, Data: data}
+	events.backlog = append(events.backlog, event)
+	if len(events.backlog) > maxStreamBacklog {
+		events.backlog = events.backlog[len(events.backlog)-maxStreamBacklog:]
+	}
+
+	for ch := range events.subscribers {
+		select {
+		case ch <- event:
+		default:
+			delete(events.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// PublishBlock pushes the summary of a new block to stream subscribers, followed by the contract interaction
+// counts of the last rollingWindow blocks. It is meant to be registered with OnNewBlock.
+func PublishBlock(ctx context.Context, block map[string]interface{}) {
+	transactions, _ := block["transactions"].([]interface{})
+	summary := BlockSummary{
+		Number:       hexToUint64(block["number"]),
+		Hash:         stringValue(block["hash"]),
+		Timestamp:    hexToUint64(block["timestamp"]),
+		Transactions: len(transactions),
+		GasUsed:      hexToUint64(block["gasUsed"]),
+	}
+	publish(StreamBlock, summary)
+
+	counts := blockCounts{number: summary.Number, transactions: summary.Transactions, interactions: make(map[string]int)}
+	contracts, err := ExtractSmartContracts(ctx, []map[string]interface{}{block})
+	if err != nil {
+		slog.WarnContext(ctx, "extracting contracts of block", "block", summary.Number, "error", err)
+	}
+	for address, stats := range contracts {
+		counts.interactions[address] = stats.Interactions
+	}
+	publish(StreamStats, events.roll(counts))
+}
+
+// roll adds the counts of a block to the rolling window, dropping the oldest block once it is full.
+func (s *stream) roll(counts blockCounts) RollingStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.window = append(s.window, counts)
+	for address, count := range counts.interactions {
+		s.interactions[address] += count
+	}
+	if len(s.window) > rollingWindow {
+		for address, count := range s.window[0].interactions {
+			if s.interactions[address] -= count; s.interactions[address] <= 0 {
+				delete(s.interactions, address)
+			}
+		}
+		s.window = s.window[1:]
+	}
+
+	stats := RollingStats{StartBlock: s.window[0].number, EndBlock: counts.number, Contracts: []InteractionCount{}}
+	for _, block := range s.window {
+		stats.Transactions += block.transactions
+	}
+	for address, count := range s.interactions {
+		stats.Contracts = append(stats.Contracts, InteractionCount{Address: address, Count: count})
+	}
+	sort.Slice(stats.Contracts, func(i, j int) bool {
+		if stats.Contracts[i].Count != stats.Contracts[j].Count {
+			return stats.Contracts[i].Count > stats.Contracts[j].Count
+		}
+		return stats.Contracts[i].Address < stats.Contracts[j].Address
+	})
+	if len(stats.Contracts) > topStreamContracts {
+		stats.Contracts = stats.Contracts[:topStreamContracts]
+	}
+	return stats
+}
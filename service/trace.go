@@ -0,0 +1,26 @@
+package service
+
+// walkCalls visits every nested frame of a callTracer trace depth-first, in execution order.
+// The root frame, which describes the transaction itself, is not visited.
+func walkCalls(frame map[string]interface{}, visit func(call map[string]interface{})) {
+	walkCallOutcomes(frame, func(call map[string]interface{}, _ bool) { visit(call) })
+}
+
+// walkCallOutcomes is walkCalls additionally reporting whether the effects of each frame were reverted,
+// which is the case when the frame itself, its parent frames or the transaction failed.
+func walkCallOutcomes(frame map[string]interface{}, visit func(call map[string]interface{}, reverted bool)) {
+	var walk func(frame map[string]interface{}, reverted bool)
+	walk = func(frame map[string]interface{}, reverted bool) {
+		calls, _ := frame["calls"].([]interface{})
+		for _, call := range calls {
+			callMap, ok := call.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			callReverted := reverted || frameFailed(callMap)
+			visit(callMap, callReverted)
+			walk(callMap, callReverted)
+		}
+	}
+	walk(frame, frameFailed(frame))
+}
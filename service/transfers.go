@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+)
+
+// InternalTransfer is native value moved by a contract within a transaction, as opposed to the value of
+// the transaction itself.
+type InternalTransfer struct {
+	TxHash      string `json:"transactionHash"`
+	BlockNumber uint64 `json:"blockNumber"`
+	Type        string `json:"type"`
+	From        string `json:"from"`
+	To          string `json:"to"`
+	// Value is the value moved in wei, as a decimal string.
+	Value string `json:"value"`
+
+	value *big.Int
+}
+
+// newInternalTransfer describes the value moved by a callTracer frame.
+func newInternalTransfer(frame map[string]interface{}, txHash string, blockNumber uint64) InternalTransfer {
+	value := hexToBigInt(frame["value"])
+	return InternalTransfer{
+		TxHash:      txHash,
+		BlockNumber: blockNumber,
+		Type:        stringValue(frame["type"]),
+		From:        stringValue(frame["from"]),
+		To:          stringValue(frame["to"]),
+		Value:       value.String(),
+		value:       value,
+	}
+}
+
+// internalTransfers returns the value moving frames nested in a callTracer trace, in execution order.
+func internalTransfers(trace map[string]interface{}, txHash string, blockNumber uint64) []InternalTransfer {
+	var transfers []InternalTransfer
+	walkCallOutcomes(trace, func(call map[string]interface{}, reverted bool) {
+		if movesValue(call, reverted) {
+			transfers = append(transfers, newInternalTransfer(call, txHash, blockNumber))
+		}
+	})
+	return transfers
+}
+
+// movesValue reports whether a nested frame transferred native value. Reverted frames did not, and
+// DELEGATECALL frames report the value of their parent without moving it.
+func movesValue(frame map[string]interface{}, reverted bool) bool {
+	frameType := stringValue(frame["type"])
+	return !reverted && frameType != "DELEGATECALL" && frameType != "STATICCALL" && hexToBigInt(frame["value"]).Sign() > 0
+}
+
+// blockInternalTransfers returns the internal transfers of every transaction in a block, reading the traces
+// through the local index. It fails when a trace cannot be fetched, rather than returning a partial list.
+func blockInternalTransfers(ctx context.Context, block map[string]interface{}) ([]InternalTransfer, error) {
+	blockNumber := hexToUint64(block["number"])
+	transactions, _ := block["transactions"].([]interface{})
+
+	var transfers []InternalTransfer
+	for _, tx := range transactions {
+		txMap, ok := tx.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		txHash := stringValue(txMap["hash"])
+		trace, err := index.trace(ctx, txHash)
+		if err != nil {
+			return nil, fmt.Errorf("tracing %s: %w", txHash, err)
+		}
+		transfers = append(transfers, internalTransfers(trace, txHash, blockNumber)...)
+	}
+	return transfers, nil
+}
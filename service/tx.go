@@ -0,0 +1,218 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"onchain-stats/abi"
+	"regexp"
+	"strings"
+)
+
+var (
+	ErrInvalidTxHash       = errors.New("invalid transaction hash")
+	ErrTransactionNotFound = errors.New("transaction not found")
+)
+
+var txHashPattern = regexp.MustCompile(`^0x[0-9a-fA-F]{64}$`)
+
+// DecodedInput is the calldata of a call resolved to a method. Args are only present when the signature is
+// known, keyed by argument name when the contract ABI is registered and by "argN" otherwise.
+type DecodedInput struct {
+	Selector  string                 `json:"selector"`
+	Signature string                 `json:"signature,omitempty"`
+	Args      map[string]interface{} `json:"args,omitempty"`
+}
+
+// CallFrame is a node of the call tree of a transaction. Value is in wei, as a decimal string.
+type CallFrame struct {
+	Type         string        `json:"type"`
+	From         string        `json:"from"`
+	To           string        `json:"to"`
+	Value        string        `json:"value"`
+	Gas          uint64        `json:"gas"`
+	GasUsed      uint64        `json:"gasUsed"`
+	Input        string        `json:"input"`
+	Output       string        `json:"output,omitempty"`
+	Method       *DecodedInput `json:"method,omitempty"`
+	Error        string        `json:"error,omitempty"`
+	RevertReason string        `json:"revertReason,omitempty"`
+	Calls        []CallFrame   `json:"calls"`
+}
+
+type TransactionLog struct {
+	Address  string        `json:"address"`
+	LogIndex uint64        `json:"logIndex"`
+	Topics   []string      `json:"topics"`
+	Data     string        `json:"data"`
+	Decoded  *DecodedEvent `json:"decoded,omitempty"`
+}
+
+// TransactionDetail is a transaction with its receipt and call tree. Value and Fee are in wei, as decimal
+// strings.
+type TransactionDetail struct {
+	Hash              string           `json:"hash"`
+	BlockNumber       uint64           `json:"blockNumber"`
+	From              string           `json:"from"`
+	To                string           `json:"to,omitempty"`
+	ContractAddress   string           `json:"contractAddress,omitempty"`
+	Value             string           `json:"value"`
+	Nonce             uint64           `json:"nonce"`
+	GasLimit          uint64           `json:"gasLimit"`
+	GasUsed           uint64           `json:"gasUsed"`
+	EffectiveGasPrice *big.Int         `json:"effectiveGasPrice"`
+	Fee               string           `json:"fee"`
+	Success           bool             `json:"success"`
+	RevertReason      string           `json:"revertReason,omitempty"`
+	Input             *DecodedInput    `json:"input,omitempty"`
+	Logs              []TransactionLog `json:"logs"`
+	CallTree          *CallFrame       `json:"callTree"`
+}
+
+// GetTransactionDetail combines a transaction, its receipt and its call trace. Input and logs are decoded
+// with the registered ABIs or the signature database, and failed frames carry their decoded revert reason.
+func GetTransactionDetail(ctx context.Context, txHash string) (*TransactionDetail, error) {
+	if !txHashPattern.MatchString(txHash) {
+		return nil, fmt.Errorf("%w %q", ErrInvalidTxHash, txHash)
+	}
+	txHash = strings.ToLower(txHash)
+
+	tx, err := evmosClient.GetTransactionByHash(ctx, txHash)
+	if err != nil {
+		return nil, err
+	}
+	if tx == nil {
+		return nil, fmt.Errorf("%w: %s", ErrTransactionNotFound, txHash)
+	}
+
+	receipt, err := evmosClient.GetTransactionReceipt(ctx, txHash)
+	if err != nil {
+		return nil, err
+	}
+	if receipt == nil {
+		return nil, fmt.Errorf("%w: %s is pending", ErrTransactionNotFound, txHash)
+	}
+
+	trace, err := index.trace(ctx, txHash)
+	if err != nil {
+		return nil, err
+	}
+
+	gasUsed := hexToUint64(receipt["gasUsed"])
+	price := effectiveGasPrice(tx, receipt, new(big.Int))
+	detail := &TransactionDetail{
+		Hash:              txHash,
+		BlockNumber:       hexToUint64(tx["blockNumber"]),
+		From:              stringValue(tx["from"]),
+		To:                stringValue(tx["to"]),
+		ContractAddress:   stringValue(receipt["contractAddress"]),
+		Value:             hexToBigInt(tx["value"]).String(),
+		Nonce:             hexToUint64(tx["nonce"]),
+		GasLimit:          hexToUint64(tx["gas"]),
+		GasUsed:           gasUsed,
+		EffectiveGasPrice: price,
+		Fee:               new(big.Int).Mul(price, new(big.Int).SetUint64(gasUsed)).String(),
+		Success:           hexToUint64(receipt["status"]) == 1,
+		Logs:              []TransactionLog{},
+	}
+	if detail.To != "" {
+		detail.Input = decodeInput(detail.To, stringValue(tx["input"]))
+	}
+
+	if trace != nil {
+		root := callFrame(trace)
+		detail.CallTree = &root
+		detail.RevertReason = root.RevertReason
+	}
+
+	logs, _ := receipt["logs"].([]interface{})
+	for _, rawLog := range logs {
+		log, ok := rawLog.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		entry := TransactionLog{
+			Address:  stringValue(log["address"]),
+			LogIndex: hexToUint64(log["logIndex"]),
+			Topics:   []string{},
+			Data:     stringValue(log["data"]),
+		}
+		topics, _ := log["topics"].([]interface{})
+		for _, topic := range topics {
+			entry.Topics = append(entry.Topics, stringValue(topic))
+		}
+		if contractABI := contractABIFor(entry.Address); contractABI != nil {
+			if event, ok := decodeLog(contractABI, log); ok {
+				entry.Decoded = &event
+			}
+		}
+		detail.Logs = append(detail.Logs, entry)
+	}
+
+	return detail, nil
+}
+
+// callFrame converts a callTracer frame and its nested calls into a CallFrame tree.
+func callFrame(frame map[string]interface{}) CallFrame {
+	node := CallFrame{
+		Type:         stringValue(frame["type"]),
+		From:         stringValue(frame["from"]),
+		To:           stringValue(frame["to"]),
+		Value:        hexToBigInt(frame["value"]).String(),
+		Gas:          hexToUint64(frame["gas"]),
+		GasUsed:      hexToUint64(frame["gasUsed"]),
+		Input:        stringValue(frame["input"]),
+		Output:       stringValue(frame["output"]),
+		Error:        stringValue(frame["error"]),
+		RevertReason: frameRevertReason(frame),
+		Calls:        []CallFrame{},
+	}
+	if !strings.HasPrefix(node.Type, "CREATE") {
+		node.Method = decodeInput(node.To, node.Input)
+	}
+
+	calls, _ := frame["calls"].([]interface{})
+	for _, call := range calls {
+		if callMap, ok := call.(map[string]interface{}); ok {
+			node.Calls = append(node.Calls, callFrame(callMap))
+		}
+	}
+	return node
+}
+
+// decodeInput resolves the selector of calldata sent to address and decodes its arguments when the method
+// is known. Calls without calldata return nil.
+func decodeInput(address, input string) *DecodedInput {
+	selector := inputSelector(input)
+	if selector == fallbackSelector {
+		return nil
+	}
+
+	contractABI := contractABIFor(address)
+	decoded := &DecodedInput{Selector: selector, Signature: ResolveSelector(contractABI, selector)}
+	if decoded.Signature == "" {
+		return decoded
+	}
+
+	data, err := abi.FromHex(input)
+	if err != nil {
+		return decoded
+	}
+	method, exists := abi.Method{}, false
+	if contractABI != nil {
+		method, exists = contractABI.MethodByID(data[:4])
+	}
+	if !exists {
+		if method, err = abi.ParseMethod(decoded.Signature); err != nil {
+			return decoded
+		}
+	}
+	if args, err := method.DecodeInput(data); err == nil {
+		for name, value := range args {
+			args[name] = jsonValue(value)
+		}
+		decoded.Args = args
+	}
+	return decoded
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// evmosDecimals is the number of decimals of EVMOS, whose base denomination aevmos equals wei.
+const evmosDecimals = 18
+
+var ErrUnknownUnit = errors.New("unknown unit")
+
+// Units lists the values accepted by FormatAmount.
+var Units = []string{"wei", "aevmos", "evmos", "hex"}
+
+// Amount is a wei amount rendered as decimal wei, hex and EVMOS.
+type Amount struct {
+	Wei   string `json:"wei"`
+	Hex   string `json:"hex"`
+	Evmos string `json:"evmos"`
+}
+
+type WalletBalance struct {
+	Address string `json:"address"`
+	Bech32  string `json:"bech32,omitempty"`
+	Block   string `json:"block,omitempty"`
+	// Cluster is the ID of the cluster of the wallet, when clustering was requested and found one.
+	Cluster string `json:"cluster,omitempty"`
+	Label   *Label `json:"label,omitempty"`
+	// Balance is the balance in the requested unit.
+	Balance string `json:"balance"`
+	Amount
+	Value *big.Int `json:"-"`
+}
+
+// NewAmount renders a wei amount in every unit.
+func NewAmount(wei *big.Int) Amount {
+	return Amount{Wei: wei.String(), Hex: toHexAmount(wei), Evmos: formatDecimals(wei, evmosDecimals)}
+}
+
+// FormatAmount renders a wei amount in the given unit: wei or aevmos as a decimal integer, evmos with up to
+// 18 decimals and hex as a 0x prefixed quantity.
+func FormatAmount(wei *big.Int, unit string) (string, error) {
+	switch unit {
+	case "wei", "aevmos":
+		return wei.String(), nil
+	case "evmos":
+		return formatDecimals(wei, evmosDecimals), nil
+	case "hex":
+		return toHexAmount(wei), nil
+	}
+	return "", fmt.Errorf("%w %q, expected one of %v", ErrUnknownUnit, unit, Units)
+}
+
+func newWalletBalance(address string, wei *big.Int, unit string) (WalletBalance, error) {
+	balance, err := FormatAmount(wei, unit)
+	if err != nil {
+		return WalletBalance{}, err
+	}
+	return WalletBalance{
+		Address: address,
+		Bech32:  toBech32(address),
+		Label:   labelFor(address),
+		Balance: balance,
+		Amount:  NewAmount(wei),
+		Value:   wei,
+	}, nil
+}
+
+func toHexAmount(wei *big.Int) string {
+	if wei.Sign() < 0 {
+		return "-0x" + new(big.Int).Neg(wei).Text(16)
+	}
+	return "0x" + wei.Text(16)
+}
+
+// formatDecimals renders an integer amount of base units as a decimal number with the given number of
+// decimals, dropping trailing zeros of the fraction.
+func formatDecimals(amount *big.Int, decimals int) string {
+	digits := new(big.Int).Abs(amount).String()
+	if len(digits) <= decimals {
+		digits = strings.Repeat("0", decimals-len(digits)+1) + digits
+	}
+
+	whole, fraction := digits[:len(digits)-decimals], strings.TrimRight(digits[len(digits)-decimals:], "0")
+	formatted := whole
+	if fraction != "" {
+		formatted += "." + fraction
+	}
+	if amount.Sign() < 0 {
+		formatted = "-" + formatted
+	}
+	return formatted
+}
@@ -0,0 +1,467 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/url"
+	"onchain-stats/bech32"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kinds of watches.
+const (
+	// WatchBalanceBelow alerts when the balance of the address drops below the threshold.
+	WatchBalanceBelow = "balanceBelow"
+	// WatchTransferAbove alerts on every transfer of more than the threshold from or to the address.
+	WatchTransferAbove = "transferAbove"
+	// WatchContractInteraction alerts on every call from the address to the contract.
+	WatchContractInteraction = "contractInteraction"
+)
+
+const (
+	// maxDeliveryAttempts is the number of times a webhook is posted before the alert is dropped.
+	maxDeliveryAttempts = 5
+	// maxDeliveryLog bounds the number of delivery attempts remembered.
+	maxDeliveryLog = 500
+	// deliveryWorkers is the number of alerts posted to webhooks concurrently.
+	deliveryWorkers = 4
+	// maxQueuedDeliveries bounds the alerts waiting for a worker. Alerts raised while it is full are dropped.
+	maxQueuedDeliveries = 1000
+)
+
+var ErrInvalidWatch = errors.New("invalid watch")
+
+var (
+	webhookClient = &http.Client{Timeout: 10 * time.Second}
+	// deliveryBackoff is the delay before the first retry of a failed delivery, doubled for every retry.
+	deliveryBackoff = time.Second
+)
+
+// Watch is a condition on an address evaluated against every new block, whose alerts are posted to
+// WebhookURL. Thresholds are amounts of wei, in decimal or 0x prefixed hex.
+type Watch struct {
+	ID         string `json:"id"`
+	Kind       string `json:"kind"`
+	Address    string `json:"address"`
+	Threshold  string `json:"threshold,omitempty"`
+	Contract   string `json:"contract,omitempty"`
+	WebhookURL string `json:"webhookUrl"`
+	// Secret signs the webhook payloads and is required. It is never listed back.
+	Secret string `json:"secret,omitempty"`
+
+	threshold *big.Int
+	// below remembers that the balance was below the threshold, so a drop alerts once until it recovers.
+	below bool
+}
+
+type Alert struct {
+	ID          string `json:"id"`
+	WatchID     string `json:"watchId"`
+	Kind        string `json:"kind"`
+	Address     string `json:"address"`
+	BlockNumber uint64 `json:"blockNumber"`
+	TxHash      string `json:"transactionHash,omitempty"`
+	From        string `json:"from,omitempty"`
+	To          string `json:"to,omitempty"`
+	// Value is the amount of wei transferred, or the balance that dropped below the threshold, as a decimal
+	// string.
+	Value     string `json:"value,omitempty"`
+	Threshold string `json:"threshold,omitempty"`
+}
+
+// Delivery is a single attempt at posting an alert to a webhook.
+type Delivery struct {
+	AlertID    string    `json:"alertId"`
+	WatchID    string    `json:"watchId"`
+	URL        string    `json:"url"`
+	Attempt    int       `json:"attempt"`
+	StatusCode int       `json:"statusCode,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Delivered  bool      `json:"delivered"`
+	Time       time.Time `json:"time"`
+}
+
+type watchlist struct {
+	mu         sync.Mutex
+	watches    map[string]*Watch
+	nextID     int
+	nextAlert  int
+	deliveries []Delivery
+}
+
+var watches = &watchlist{watches: make(map[string]*Watch)}
+
+// queuedAlert is an alert waiting to be posted to the webhook of its watch.
+type queuedAlert struct {
+	alert      Alert
+	webhookURL string
+	secret     string
+}
+
+var deliveryQueue = make(chan queuedAlert, maxQueuedDeliveries)
+
+// AddWatch validates and registers a watch, returning it with its assigned ID.
+func AddWatch(watch Watch) (Watch, error) {
+	address, err := bech32.NormalizeAddress(watch.Address)
+	if err != nil {
+		return Watch{}, fmt.Errorf("%w: %v", ErrInvalidAddress, err)
+	}
+	watch.Address = strings.ToLower(address)
+
+	switch watch.Kind {
+	case WatchBalanceBelow, WatchTransferAbove:
+		threshold, ok := new(big.Int).SetString(watch.Threshold, 0)
+		if !ok || threshold.Sign() < 0 {
+			return Watch{}, fmt.Errorf("%w: threshold %q is not an amount of wei", ErrInvalidWatch, watch.Threshold)
+		}
+		watch.threshold = threshold
+		watch.Threshold = threshold.String()
+		watch.Contract = ""
+	case WatchContractInteraction:
+		contract, err := bech32.NormalizeAddress(watch.Contract)
+		if err != nil {
+			return Watch{}, fmt.Errorf("%w: contract: %v", ErrInvalidAddress, err)
+		}
+		watch.Contract = strings.ToLower(contract)
+		watch.Threshold = ""
+	default:
+		return Watch{}, fmt.Errorf("%w: unknown kind %q, expected %s, %s or %s", ErrInvalidWatch, watch.Kind,
+			WatchBalanceBelow, WatchTransferAbove, WatchContractInteraction)
+	}
+
+	webhook, err := url.Parse(watch.WebhookURL)
+	if err != nil || (webhook.Scheme != "http" && webhook.Scheme != "https") || webhook.Host == "" {
+		return Watch{}, fmt.Errorf("%w: webhook URL %q is not an http(s) URL", ErrInvalidWatch, watch.WebhookURL)
+	}
+	if watch.Secret == "" {
+		return Watch{}, fmt.Errorf("%w: a secret is required to sign the webhook payloads", ErrInvalidWatch)
+	}
+
+	watches.mu.Lock()
+	defer watches.mu.Unlock()
+	watches.nextID++
+	watch.ID = strconv.Itoa(watches.nextID)
+	watch.below = false
+	watches.watches[watch.ID] = &watch
+	return watch.redacted(), nil
+}
+
+// RemoveWatch removes a watch, reporting whether it existed.
+func RemoveWatch(id string) bool {
+	watches.mu.Lock()
+	defer watches.mu.Unlock()
+	_, exists := watches.watches[id]
+	delete(watches.watches, id)
+	return exists
+}
+
+// GetWatches returns the registered watches in the order they were added, without their secrets.
+func GetWatches() []Watch {
+	watches.mu.Lock()
+	defer watches.mu.Unlock()
+
+	list := make([]Watch, 0, len(watches.watches))
+	for _, watch := range watches.watches {
+		list = append(list, watch.redacted())
+	}
+	sortWatches(list)
+	return list
+}
+
+// sortWatches sorts watches in the order they were added.
+func sortWatches(list []Watch) {
+	sort.Slice(list, func(i, j int) bool {
+		a, _ := strconv.Atoi(list[i].ID)
+		b, _ := strconv.Atoi(list[j].ID)
+		return a < b
+	})
+}
+
+func (w *Watch) redacted() Watch {
+	redacted := *w
+	redacted.Secret = ""
+	return redacted
+}
+
+// GetDeliveries returns the most recent webhook delivery attempts, newest first.
+func GetDeliveries() []Delivery {
+	watches.mu.Lock()
+	defer watches.mu.Unlock()
+
+	deliveries := make([]Delivery, len(watches.deliveries))
+	for i, delivery := range watches.deliveries {
+		deliveries[len(deliveries)-1-i] = delivery
+	}
+	return deliveries
+}
+
+// CheckWatches evaluates the watches against a new block, pushes the resulting alerts to stream subscribers
+// and queues them for the workers started by StartDeliveries. It is meant to be registered with OnNewBlock.
+func CheckWatches(ctx context.Context, block map[string]interface{}) {
+	for _, alert := range evaluateWatches(ctx, block) {
+		publish(StreamAlert, alert)
+
+		watches.mu.Lock()
+		watch, exists := watches.watches[alert.WatchID]
+		var webhookURL, secret string
+		if exists {
+			webhookURL, secret = watch.WebhookURL, watch.Secret
+		}
+		watches.mu.Unlock()
+		if !exists {
+			continue
+		}
+		select {
+		case deliveryQueue <- queuedAlert{alert: alert, webhookURL: webhookURL, secret: secret}:
+		default:
+			slog.WarnContext(ctx, "webhook delivery queue full, dropping alert", "alert", alert.ID, "watch", alert.WatchID)
+			recordDelivery(Delivery{AlertID: alert.ID, WatchID: alert.WatchID, URL: webhookURL,
+				Error: "delivery queue full", Time: time.Now().UTC()})
+		}
+	}
+}
+
+// StartDeliveries starts deliveryWorkers workers posting queued alerts to their webhooks until ctx is done,
+// which also aborts the deliveries in flight.
+func StartDeliveries(ctx context.Context) {
+	for i := 0; i < deliveryWorkers; i++ {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case queued := <-deliveryQueue:
+					deliverAlert(ctx, queued.alert, queued.webhookURL, queued.secret)
+				}
+			}
+		}()
+	}
+}
+
+// evaluateWatches returns the alerts raised by a block, in the order of the watches.
+func evaluateWatches(ctx context.Context, block map[string]interface{}) []Alert {
+	watches.mu.Lock()
+	list := make([]Watch, 0, len(watches.watches))
+	for _, watch := range watches.watches {
+		list = append(list, *watch)
+	}
+	watches.mu.Unlock()
+	if len(list) == 0 {
+		return nil
+	}
+	sortWatches(list)
+
+	blockNumber := hexToUint64(block["number"])
+	var (
+		alerts    []Alert
+		transfers []InternalTransfer
+		traced    bool
+		traceErr  error
+	)
+	for _, watch := range list {
+		switch watch.Kind {
+		case WatchBalanceBelow:
+			alerts = append(alerts, checkBalance(ctx, watch, blockNumber)...)
+		case WatchTransferAbove:
+			if !traced {
+				if transfers, traceErr = valueTransfers(ctx, []map[string]interface{}{block}); traceErr != nil {
+					slog.WarnContext(ctx, "tracing block for watches", "block", blockNumber, "error", traceErr)
+				}
+				traced = true
+			}
+			if traceErr != nil {
+				watchErrors.Inc(WatchTransferAbove)
+				continue
+			}
+			for _, transfer := range transfers {
+				touches := strings.EqualFold(transfer.From, watch.Address) || strings.EqualFold(transfer.To, watch.Address)
+				if touches && transfer.value.Cmp(watch.threshold) > 0 {
+					alert := newAlert(watch, blockNumber)
+					alert.TxHash, alert.From, alert.To, alert.Value = transfer.TxHash, transfer.From, transfer.To, transfer.Value
+					alerts = append(alerts, alert)
+				}
+			}
+		case WatchContractInteraction:
+			txHashes, err := interactionsWith(ctx, block, watch.Address, watch.Contract)
+			if err != nil {
+				slog.WarnContext(ctx, "tracing block for watch", "block", blockNumber, "watch", watch.ID, "error", err)
+				watchErrors.Inc(WatchContractInteraction)
+				continue
+			}
+			for _, txHash := range txHashes {
+				alert := newAlert(watch, blockNumber)
+				alert.TxHash, alert.From, alert.To = txHash, watch.Address, watch.Contract
+				alerts = append(alerts, alert)
+			}
+		}
+	}
+	return alerts
+}
+
+// checkBalance alerts when the balance of a balanceBelow watch crossed below its threshold at blockNumber.
+func checkBalance(ctx context.Context, watch Watch, blockNumber uint64) []Alert {
+	walletBalances, err := balances.balancesAt(ctx, watch.Address, []uint64{blockNumber})
+	if err != nil {
+		slog.WarnContext(ctx, "fetching balance for watch", "address", watch.Address, "watch", watch.ID, "error", err)
+		watchErrors.Inc(WatchBalanceBelow)
+		return nil
+	}
+	below := walletBalances[0].Cmp(watch.threshold) < 0
+
+	watches.mu.Lock()
+	defer watches.mu.Unlock()
+	current, exists := watches.watches[watch.ID]
+	if !exists || current.below == below {
+		return nil
+	}
+	current.below = below
+	if !below {
+		return nil
+	}
+	alert := newAlertLocked(watch, blockNumber)
+	alert.Value = walletBalances[0].String()
+	return []Alert{alert}
+}
+
+// interactionsWith returns the hashes of the transactions of a block in which address called contract,
+// directly or from within the call tree. It fails when a trace cannot be fetched, since the call could be
+// nested in it.
+func interactionsWith(ctx context.Context, block map[string]interface{}, address, contract string) ([]string, error) {
+	calls := func(from, to interface{}) bool {
+		return strings.EqualFold(stringValue(from), address) && strings.EqualFold(stringValue(to), contract)
+	}
+
+	var txHashes []string
+	transactions, _ := block["transactions"].([]interface{})
+	for _, tx := range transactions {
+		txMap, ok := tx.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		txHash := stringValue(txMap["hash"])
+		interacted := calls(txMap["from"], txMap["to"])
+		if !interacted {
+			trace, err := index.trace(ctx, txHash)
+			if err != nil {
+				return nil, fmt.Errorf("tracing %s: %w", txHash, err)
+			}
+			walkCalls(trace, func(call map[string]interface{}) {
+				interacted = interacted || calls(call["from"], call["to"])
+			})
+		}
+		if interacted {
+			txHashes = append(txHashes, txHash)
+		}
+	}
+	return txHashes, nil
+}
+
+func newAlert(watch Watch, blockNumber uint64) Alert {
+	watches.mu.Lock()
+	defer watches.mu.Unlock()
+	return newAlertLocked(watch, blockNumber)
+}
+
+func newAlertLocked(watch Watch, blockNumber uint64) Alert {
+	watches.nextAlert++
+	return Alert{
+		ID:          strconv.Itoa(watches.nextAlert),
+		WatchID:     watch.ID,
+		Kind:        watch.Kind,
+		Address:     watch.Address,
+		BlockNumber: blockNumber,
+		Threshold:   watch.Threshold,
+	}
+}
+
+// deliverAlert posts an alert to a webhook, retrying with exponential backoff until it is accepted with a
+// 2xx status, maxDeliveryAttempts is reached or ctx is done. Every attempt is signed, see signPayload.
+func deliverAlert(ctx context.Context, alert Alert, webhookURL, secret string) bool {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return false
+	}
+
+	delay := deliveryBackoff
+	for attempt := 1; attempt <= maxDeliveryAttempts; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-ctx.Done():
+				return false
+			case <-time.After(delay):
+			}
+			delay *= 2
+		}
+
+		delivery := Delivery{AlertID: alert.ID, WatchID: alert.WatchID, URL: webhookURL, Attempt: attempt, Time: time.Now().UTC()}
+		timestamp := strconv.FormatInt(delivery.Time.Unix(), 10)
+		delivery.StatusCode, err = postWebhook(ctx, webhookURL, body, alert.ID, timestamp, signPayload(secret, timestamp, body))
+		if err != nil {
+			delivery.Error = err.Error()
+		}
+		delivery.Delivered = err == nil && delivery.StatusCode >= 200 && delivery.StatusCode < 300
+		recordDelivery(delivery)
+		if delivery.Delivered {
+			return true
+		}
+	}
+	slog.WarnContext(ctx, "webhook delivery failed", "alert", alert.ID, "watch", alert.WatchID, "attempts", maxDeliveryAttempts)
+	return false
+}
+
+// signPayload signs "<timestamp>.<body>" with HMAC-SHA256, returned hex encoded as "sha256=<signature>".
+// The timestamp, in unix seconds, is sent in the X-Signature-Timestamp header so receivers can verify the
+// signature and reject stale deliveries, which would otherwise be replayable forever.
+func signPayload(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func postWebhook(ctx context.Context, webhookURL string, body []byte, alertID, timestamp, signature string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Alert-ID", alertID)
+	req.Header.Set("X-Signature-Timestamp", timestamp)
+	req.Header.Set("X-Signature", signature)
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer closeBody(resp.Body)
+	return resp.StatusCode, nil
+}
+
+func closeBody(body io.Closer) {
+	if err := body.Close(); err != nil {
+		slog.Warn("closing response body", "error", err)
+	}
+}
+
+func recordDelivery(delivery Delivery) {
+	watches.mu.Lock()
+	defer watches.mu.Unlock()
+	watches.deliveries = append(watches.deliveries, delivery)
+	if len(watches.deliveries) > maxDeliveryLog {
+		watches.deliveries = watches.deliveries[len(watches.deliveries)-maxDeliveryLog:]
+	}
+}